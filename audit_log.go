@@ -0,0 +1,155 @@
+package kit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/leporo/sqlf"
+	"github.com/neoxelox/errors"
+
+	"github.com/neoxelox/kit/util"
+)
+
+const (
+	_AUDIT_LOG_MIGRATION_UP = `CREATE TABLE IF NOT EXISTS %[1]s (
+	"id" BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	"actor" TEXT NOT NULL,
+	"action" TEXT NOT NULL,
+	"entity" TEXT NOT NULL,
+	"entity_id" TEXT,
+	"before" JSONB,
+	"after" JSONB,
+	"request_id" TEXT,
+	"created_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s ("entity", "entity_id", "created_at");
+`
+	_AUDIT_LOG_MIGRATION_DOWN = `DROP TABLE IF EXISTS %[1]s;
+`
+)
+
+var (
+	ErrAuditLogGeneric = errors.New("audit log failed")
+)
+
+var (
+	_AUDIT_LOG_DEFAULT_CONFIG = AuditLogConfig{
+		Table: util.Pointer("audit_log"),
+	}
+)
+
+// AuditLogConfig Table is the name of the audit table, which can be qualified with its schema.
+type AuditLogConfig struct {
+	Table *string
+}
+
+// AuditEntry is who, the Actor, did what, the Action, to which entity, the Entity and its EntityID. Before and
+// After are the states of the entity around the action, encoded as JSON, and are left empty when there is none.
+type AuditEntry struct {
+	Actor    string
+	Action   string
+	Entity   string
+	EntityID string
+	Before   any
+	After    any
+}
+
+// AuditLog writes the audit entries into the audit table, created with the migration of AuditLogMigration.
+type AuditLog struct {
+	config   AuditLogConfig
+	observer *Observer
+	database *Database
+	table    string
+}
+
+func NewAuditLog(observer *Observer, database *Database, config AuditLogConfig) *AuditLog {
+	util.Merge(&config, _AUDIT_LOG_DEFAULT_CONFIG)
+
+	if *config.Table == "" {
+		observer.Panic(context.Background(), ErrAuditLogGeneric.Raise().With("audit log config table is empty"))
+	}
+
+	return &AuditLog{
+		config:   config,
+		observer: observer,
+		database: database,
+		table:    _dbIdentifier(*config.Table),
+	}
+}
+
+// AuditLogMigration returns the up and down SQL of the migration creating the audit table, by default
+// "audit_log", to be written into the files of a migration created with Migrator.Create.
+func AuditLogMigration(table ...string) (string, string) {
+	_table := util.Optional(table, *_AUDIT_LOG_DEFAULT_CONFIG.Table)
+	index := pgx.Identifier{strings.ReplaceAll(_table, ".", "_") + "_entity_idx"}.Sanitize()
+
+	return fmt.Sprintf(_AUDIT_LOG_MIGRATION_UP, _dbIdentifier(_table), index),
+		fmt.Sprintf(_AUDIT_LOG_MIGRATION_DOWN, _dbIdentifier(_table))
+}
+
+// Record writes the entry along with the request ID of ctx. Within a Transaction the entry is written
+// in the same transaction, so that it is only kept if the audited change is committed.
+func (self *AuditLog) Record(ctx context.Context, entry AuditEntry) error {
+	switch {
+	case entry.Actor == "":
+		return ErrAuditLogGeneric.Raise().With("audit entry actor is empty")
+	case entry.Action == "":
+		return ErrAuditLogGeneric.Raise().With("audit entry action is empty")
+	case entry.Entity == "":
+		return ErrAuditLogGeneric.Raise().With("audit entry entity is empty")
+	}
+
+	before, err := _auditLogState(entry.Before)
+	if err != nil {
+		return ErrAuditLogGeneric.Raise().With("cannot encode audit entry before state").Cause(err)
+	}
+
+	after, err := _auditLogState(entry.After)
+	if err != nil {
+		return ErrAuditLogGeneric.Raise().With("cannot encode audit entry after state").Cause(err)
+	}
+
+	var entityID *string
+	if entry.EntityID != "" {
+		entityID = &entry.EntityID
+	}
+
+	var requestID *string
+	if id, ok := Context.RequestID(ctx); ok {
+		requestID = &id
+	}
+
+	_, err = self.database.Exec(ctx, sqlf.InsertInto(self.table).
+		Set(`"actor"`, entry.Actor).
+		Set(`"action"`, entry.Action).
+		Set(`"entity"`, entry.Entity).
+		Set(`"entity_id"`, entityID).
+		Set(`"before"`, before).
+		Set(`"after"`, after).
+		Set(`"request_id"`, requestID))
+	if err != nil {
+		return ErrAuditLogGeneric.Raise().With("cannot record audit entry").Cause(err)
+	}
+
+	return nil
+}
+
+// _auditLogState encodes the state as JSON, or nil when there is none, for the JSONB columns.
+func _auditLogState(state any) (*string, error) {
+	if state == nil {
+		return nil, nil // nolint:nilnil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := string(data)
+
+	return &encoded, nil
+}
@@ -0,0 +1,74 @@
+package kit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/leporo/sqlf"
+
+	"github.com/neoxelox/kit/util"
+)
+
+func TestAuditLogMigration(t *testing.T) {
+	up, down := AuditLogMigration("audit.log")
+
+	if !strings.Contains(up, `CREATE TABLE IF NOT EXISTS "audit"."log"`) ||
+		!strings.Contains(up, `CREATE INDEX IF NOT EXISTS "audit_log_entity_idx" ON "audit"."log"`) {
+		t.Fatalf("expected the up migration to create the qualified table, got %s", up)
+	}
+
+	if down != "DROP TABLE IF EXISTS \"audit\".\"log\";\n" {
+		t.Fatalf("expected the down migration to drop the qualified table, got %s", down)
+	}
+}
+
+func TestAuditLogRecord(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t, DatabaseConfig{})
+
+	up, down := AuditLogMigration("kit_audit_log")
+
+	_, err := database.Exec(ctx, sqlf.New(up))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Exec(ctx, sqlf.New(down)) // nolint:errcheck
+
+	auditLog := NewAuditLog(database.observer, database, AuditLogConfig{Table: util.Pointer("kit_audit_log")})
+
+	entry := AuditEntry{
+		Actor:    "user:1",
+		Action:   "update",
+		Entity:   "post",
+		EntityID: "1",
+		Before:   map[string]any{"title": "before"},
+		After:    map[string]any{"title": "after"},
+	}
+
+	rollback := errors.New("rollback")
+
+	err = database.Transaction(ctx, nil, func(ctx context.Context) error {
+		err := auditLog.Record(ctx, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return rollback
+	})
+	if !ErrDatabaseTransactionFailed.Is(err) {
+		t.Fatalf("expected rollback error, got %v", err)
+	}
+
+	err = auditLog.Record(Context.WithRequestID(ctx, "request"), entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := database.Count(ctx, sqlf.From("kit_audit_log").Select("*").
+		Where(`"request_id" = ?`, "request").Where(`"after"->>'title' = ?`, "after"))
+	if err != nil || count != 1 {
+		t.Fatalf("expected only the entry outside the rolled back transaction, got %d %v", count, err)
+	}
+}
@@ -1,6 +1,11 @@
 package kit
 
 import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/neoxelox/errors"
 
@@ -12,30 +17,65 @@ var (
 )
 
 var (
-	_BINDER_DEFAULT_CONFIG = BinderConfig{}
+	_BINDER_DEFAULT_CONFIG = BinderConfig{
+		Validate: util.Pointer(false),
+	}
 )
 
+// BinderConfig Validate runs the validate struct tags of go-playground/validator right after binding, failing
+// with HTTPErrValidation detailing the invalid fields by their json names. It is meant for simple request
+// validation only, so it is disabled by default as the validation should be at domain level.
 type BinderConfig struct {
+	Validate *bool
 }
 
 type Binder struct {
-	config   BinderConfig
-	observer *Observer
-	binder   *echo.DefaultBinder
+	config    BinderConfig
+	observer  *Observer
+	binder    *echo.DefaultBinder
+	validator *validator.Validate
 }
 
 func NewBinder(observer *Observer, config BinderConfig) *Binder {
 	util.Merge(&config, _BINDER_DEFAULT_CONFIG)
 
-	return &Binder{
+	binder := &Binder{
 		observer: observer,
 		config:   config,
 		binder:   &echo.DefaultBinder{},
 	}
+
+	if *config.Validate {
+		binder.validator = validator.New()
+		binder.validator.RegisterTagNameFunc(_binderFieldName)
+	}
+
+	return binder
 }
 
+// _binderFieldName names the fields after their json tags, as seen by the clients, skipping the ignored ones.
+func _binderFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+
+	return name
+}
+
+// Bind decodes the request body as MessagePack instead of JSON when its Content-Type says so.
 func (self *Binder) Bind(i any, c echo.Context) error {
-	err := self.binder.Bind(i, c)
+	var err error
+
+	if _serializerIsMessagePack(c.Request().Header.Get(echo.HeaderContentType)) {
+		err = self.bindMessagePack(i, c)
+	} else {
+		err = self.binder.Bind(i, c)
+	}
+
 	if err != nil {
 		return ErrBinderGeneric.Raise().Cause(err)
 	}
@@ -45,5 +85,70 @@ func (self *Binder) Bind(i any, c echo.Context) error {
 		return ErrBinderGeneric.Raise().Cause(err)
 	}
 
+	if self.validator != nil {
+		return self.validate(i)
+	}
+
+	return nil
+}
+
+func (self *Binder) validate(i any) error {
+	err := self.validator.Struct(i)
+	if err == nil {
+		return nil
+	}
+
+	validationErrors, ok := err.(validator.ValidationErrors) // nolint:errorlint
+	if !ok {
+		// Only structs are validated, other values such as maps and slices are bound as they are
+		if _, ok := err.(*validator.InvalidValidationError); ok { // nolint:errorlint
+			return nil
+		}
+
+		return ErrBinderGeneric.Raise().Cause(err)
+	}
+
+	fields := make(map[string]string, len(validationErrors))
+
+	for _, fieldError := range validationErrors {
+		// The namespace starts with the name of the struct type, which clients do not know about
+		_, name, _ := strings.Cut(fieldError.Namespace(), ".")
+
+		reason := fieldError.Tag()
+		if fieldError.Param() != "" {
+			reason += "=" + fieldError.Param()
+		}
+
+		fields[name] = reason
+	}
+
+	return HTTPErrValidation.Cause(err).WithFields(fields)
+}
+
+func (self *Binder) bindMessagePack(i any, c echo.Context) error {
+	err := self.binder.BindPathParams(c, i)
+	if err != nil {
+		return err
+	}
+
+	request := c.Request()
+
+	// Follow the echo default binder which only binds the query params for these methods
+	if request.Method == http.MethodGet || request.Method == http.MethodDelete || request.Method == http.MethodHead {
+		err = self.binder.BindQueryParams(c, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	if request.ContentLength == 0 {
+		return nil
+	}
+
+	err = _serializerDecodeMessagePack(request.Body, i)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+
 	return nil
 }
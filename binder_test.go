@@ -0,0 +1,70 @@
+package kit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/neoxelox/kit/util"
+)
+
+type _binderTestAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type _binderTestRequest struct {
+	Name    string             `json:"name" validate:"required"`
+	Age     int                `json:"age" validate:"gte=18"`
+	Address _binderTestAddress `json:"address"`
+}
+
+func bindTestRequest(binder *Binder, body string) error {
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	return binder.Bind(&_binderTestRequest{}, echo.New().NewContext(request, httptest.NewRecorder()))
+}
+
+func TestBinderValidate(t *testing.T) {
+	body := `{"age": 17, "address": {}}`
+
+	err := bindTestRequest(&Binder{binder: &echo.DefaultBinder{}}, body)
+	if err != nil {
+		t.Fatalf("expected no validation by default, got %v", err)
+	}
+
+	binder := NewBinder(nil, BinderConfig{Validate: util.Pointer(true)})
+
+	err = bindTestRequest(binder, body)
+
+	httpError, ok := err.(*HTTPError) // nolint:errorlint
+	if !ok || !HTTPErrValidation.Is(httpError) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	expected := map[string]string{"name": "required", "age": "gte=18", "address.city": "required"}
+	if !reflect.DeepEqual(httpError.Fields(), expected) {
+		t.Fatalf("expected fields %v, got %v", expected, httpError.Fields())
+	}
+
+	httpError.Redact()
+
+	data, err := json.Marshal(httpError)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `"fields":{"address.city":"required"`) {
+		t.Fatalf("expected fields in the serialized error, got %s", data)
+	}
+
+	err = bindTestRequest(binder, `{"name": "kit", "age": 18, "address": {"city": "Barcelona"}}`)
+	if err != nil {
+		t.Fatalf("expected valid request, got %v", err)
+	}
+}
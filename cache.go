@@ -1,75 +1,241 @@
 package kit
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/neoxelox/errors"
 
 	"github.com/go-redis/cache/v8"
 	"github.com/go-redis/redis/v8"
+	"github.com/vmihailenco/msgpack/v5"
 
 	"github.com/neoxelox/kit/util"
 )
 
 const (
-	_CACHE_REDIS_DSN = "%s:%d"
+	_CACHE_REDIS_DSN                = "%s:%d"
+	_CACHE_NAMESPACE_GENERATION_KEY = "%s:generation"
+	_CACHE_NAMESPACE_KEY            = "%s:%d:%s"
+	_CACHE_STALE_REVALIDATION_KEY   = "%s:revalidating"
+	_CACHE_VERSION_KEY              = "%s:version"
 )
 
 var (
-	ErrCacheGeneric   = errors.New("cache failed")
-	ErrCacheTimedOut  = errors.New("cache timed out")
-	ErrCacheUnhealthy = errors.New("cache unhealthy")
-	ErrCacheMiss      = errors.New("cache key not found")
+	ErrCacheGeneric       = errors.New("cache failed")
+	ErrCacheTimedOut      = errors.New("cache timed out")
+	ErrCacheUnhealthy     = errors.New("cache unhealthy")
+	ErrCacheUnavailable   = errors.New("cache unavailable")
+	ErrCacheMiss          = errors.New("cache key not found")
+	ErrCacheSerialization = errors.New("cache serialization failed")
 )
 
+// _CACHE_SET_IF_NEWER_SCRIPT stores the value and its version, with the same TTL, only
+// if the version is greater than the stored one, which is missing for unversioned values.
+var _CACHE_SET_IF_NEWER_SCRIPT = redis.NewScript(`
+local current = redis.call("GET", KEYS[2])
+if current and tonumber(current) >= tonumber(ARGV[2]) then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[3])
+	redis.call("SET", KEYS[2], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+	redis.call("SET", KEYS[2], ARGV[2])
+end
+return 1
+`)
+
 var (
 	_CACHE_DEFAULT_CONFIG = CacheConfig{
-		MinConns:        util.Pointer(1),
-		MaxConns:        util.Pointer(max(8, 4*runtime.GOMAXPROCS(-1))),
-		MaxConnIdleTime: util.Pointer(30 * time.Minute),
-		MaxConnLifeTime: util.Pointer(1 * time.Hour),
-		ReadTimeout:     util.Pointer(30 * time.Second),
-		WriteTimeout:    util.Pointer(30 * time.Second),
-		DialTimeout:     util.Pointer(30 * time.Second),
+		MinConns:             util.Pointer(1),
+		MaxConns:             util.Pointer(max(8, 4*runtime.GOMAXPROCS(-1))),
+		MaxConnIdleTime:      util.Pointer(30 * time.Minute),
+		MaxConnLifeTime:      util.Pointer(1 * time.Hour),
+		ReadTimeout:          util.Pointer(30 * time.Second),
+		WriteTimeout:         util.Pointer(30 * time.Second),
+		DialTimeout:          util.Pointer(30 * time.Second),
+		ScanCount:            util.Pointer(100),
+		StaleRevalidationTTL: util.Pointer(30 * time.Second),
 	}
 
 	_CACHE_DEFAULT_RETRY_CONFIG = RetryConfig{
 		Attempts:     1,
 		InitialDelay: 0 * time.Second,
 		LimitDelay:   0 * time.Second,
-		Retriables:   []error{},
+		Retriables:   NetworkRetriables,
 	}
 )
 
+// Cacher is implemented by Cache so that code depending on it can be tested with fakes.
+type Cacher interface {
+	Set(ctx context.Context, key string, value any, ttl *time.Duration) error
+	Get(ctx context.Context, key string, dest any) error
+	TryGet(ctx context.Context, key string, dest any) (bool, error)
+	GetOrSet(ctx context.Context, key string, dest any, ttl *time.Duration, load func() (any, error)) error
+	SetNX(ctx context.Context, key string, value any, ttl *time.Duration) (bool, error)
+	SetIfNewer(ctx context.Context, key string, value any, version int64, ttl *time.Duration) (bool, error)
+	Increment(ctx context.Context, key string, delta int, ttl *time.Duration) (int, error)
+	Counter(ctx context.Context, key string) (int, error)
+	Delete(ctx context.Context, key string) error
+	Find(ctx context.Context, pattern string) ([]string, error)
+	Scan(ctx context.Context, pattern string, fn func(key string) error) error
+}
+
+var _ Cacher = (*Cache)(nil)
+
+// CacheCodec serializes the cached values, for example to share them with services written in other languages.
+type CacheCodec interface {
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte, dest any) error
+}
+
+var (
+	CacheCodecJSON    CacheCodec = _cacheJSONCodec{}
+	CacheCodecMsgPack CacheCodec = _cacheMsgPackCodec{}
+	CacheCodecGob     CacheCodec = _cacheGobCodec{}
+)
+
+type _cacheJSONCodec struct{}
+
+func (self _cacheJSONCodec) Marshal(value any) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (self _cacheJSONCodec) Unmarshal(data []byte, dest any) error {
+	return json.Unmarshal(data, dest)
+}
+
+type _cacheMsgPackCodec struct{}
+
+func (self _cacheMsgPackCodec) Marshal(value any) ([]byte, error) {
+	return msgpack.Marshal(value)
+}
+
+func (self _cacheMsgPackCodec) Unmarshal(data []byte, dest any) error {
+	return msgpack.Unmarshal(data, dest)
+}
+
+type _cacheGobCodec struct{}
+
+func (self _cacheGobCodec) Marshal(value any) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	err := gob.NewEncoder(&buffer).Encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (self _cacheGobCodec) Unmarshal(data []byte, dest any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(dest)
+}
+
+// CacheConfig Codec serializes the cached values. When it is not set values are encoded
+// with MessagePack and compressed with S2 when large, which is only readable by go-redis/cache.
+// ScanCount is the number of keys hinted to Redis for each batch of Scan and Find.
+// Local enables an in-memory tier on each instance in front of Redis, see CacheLocalConfig.
+// StaleRevalidationTTL bounds how long GetStale holds the revalidation lock of a key, so that a revalidation
+// that dies midway does not block the next ones beyond it.
 type CacheConfig struct {
-	Host            string
-	Port            int
-	SSLMode         bool
-	Password        string
-	MinConns        *int
-	MaxConns        *int
-	MaxConnIdleTime *time.Duration
-	MaxConnLifeTime *time.Duration
-	ReadTimeout     *time.Duration
-	WriteTimeout    *time.Duration
-	DialTimeout     *time.Duration
+	Host                 string
+	Port                 int
+	SSLMode              bool
+	Password             string
+	MinConns             *int
+	MaxConns             *int
+	MaxConnIdleTime      *time.Duration
+	MaxConnLifeTime      *time.Duration
+	ReadTimeout          *time.Duration
+	WriteTimeout         *time.Duration
+	DialTimeout          *time.Duration
+	CircuitBreaker       *CircuitBreakerConfig
+	Codec                CacheCodec
+	ScanCount            *int
+	Local                *CacheLocalConfig
+	StaleRevalidationTTL *time.Duration
+}
+
+// Validate returns the first invalid field of the config, nil pointers being left to the defaults.
+func (self CacheConfig) Validate() error {
+	switch {
+	case self.Host == "":
+		return ErrCacheGeneric.Raise().With("cache config host is empty")
+	case !_isValidPort(self.Port):
+		return ErrCacheGeneric.Raise().With("cache config port %d is out of range", self.Port)
+	case self.MinConns != nil && *self.MinConns < 0:
+		return ErrCacheGeneric.Raise().With("cache config min conns %d is negative", *self.MinConns)
+	case self.MaxConns != nil && *self.MaxConns < 1:
+		return ErrCacheGeneric.Raise().With("cache config max conns %d is not positive", *self.MaxConns)
+	case self.MinConns != nil && self.MaxConns != nil && *self.MinConns > *self.MaxConns:
+		return ErrCacheGeneric.Raise().With(
+			"cache config min conns %d is greater than max conns %d", *self.MinConns, *self.MaxConns)
+	case !_isValidTimeout(self.MaxConnIdleTime):
+		return ErrCacheGeneric.Raise().With("cache config max conn idle time is not positive")
+	case !_isValidTimeout(self.MaxConnLifeTime):
+		return ErrCacheGeneric.Raise().With("cache config max conn life time is not positive")
+	case !_isValidTimeout(self.ReadTimeout):
+		return ErrCacheGeneric.Raise().With("cache config read timeout is not positive")
+	case !_isValidTimeout(self.WriteTimeout):
+		return ErrCacheGeneric.Raise().With("cache config write timeout is not positive")
+	case !_isValidTimeout(self.DialTimeout):
+		return ErrCacheGeneric.Raise().With("cache config dial timeout is not positive")
+	case self.ScanCount != nil && *self.ScanCount < 1:
+		return ErrCacheGeneric.Raise().With("cache config scan count %d is not positive", *self.ScanCount)
+	case !_isValidTimeout(self.StaleRevalidationTTL):
+		return ErrCacheGeneric.Raise().With("cache config stale revalidation ttl is not positive")
+	case self.Local != nil:
+		return self.Local.Validate()
+	}
+
+	return nil
 }
 
 type Cache struct {
-	config   CacheConfig
-	observer *Observer
-	pool     *redis.Client
-	cache    *cache.Cache
+	config           CacheConfig
+	observer         *Observer
+	pool             *redis.Client
+	cache            *cache.Cache
+	breaker          *util.CircuitBreaker
+	loads            *util.Group[[]byte]
+	inFlight         *sync.WaitGroup
+	mutex            *sync.Mutex
+	closing          bool
+	instance         string
+	stopInvalidation context.CancelFunc
+	listened         chan struct{}
 }
 
 func NewCache(ctx context.Context, observer *Observer, config CacheConfig, retry ...RetryConfig) (*Cache, error) {
 	util.Merge(&config, _CACHE_DEFAULT_CONFIG)
 	_retry := util.Optional(retry, _CACHE_DEFAULT_RETRY_CONFIG)
 
+	if config.Local != nil {
+		local := *config.Local
+		util.Merge(&local, _CACHE_LOCAL_DEFAULT_CONFIG)
+		config.Local = &local
+	}
+
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only retry transient network errors by default so that, for example, authentication failures fail fast
+	if len(_retry.Retriables) == 0 {
+		_retry.Retriables = NetworkRetriables
+	}
+
 	redis.SetLogger(_newRedisLogger(observer))
 
 	dsn := fmt.Sprintf(_CACHE_REDIS_DSN, config.Host, config.Port)
@@ -97,13 +263,14 @@ func NewCache(ctx context.Context, observer *Observer, config CacheConfig, retry
 
 	var pool *redis.Client
 
-	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
-		return util.ExponentialRetry(
-			_retry.Attempts, _retry.InitialDelay, _retry.LimitDelay,
+	err = util.Deadline(ctx, func(exceeded <-chan struct{}) error {
+		return util.BudgetedExponentialRetry(
+			ctx, _retry.Attempts, _retry.InitialDelay, _retry.LimitDelay, _retry.Jitter, _retry.MaxElapsed,
 			_retry.Retriables, func(attempt int) error {
 				var err error
 
-				observer.Infof(ctx, "Trying to connect to the cache %d/%d", attempt, _retry.Attempts)
+				observer.WithLevelf(ctx, _retryAttemptLevel(attempt, _retry.Attempts),
+					"Trying to connect to the cache %d/%d", attempt, _retry.Attempts)
 
 				pool = redis.NewClient(poolConfig)
 
@@ -125,22 +292,69 @@ func NewCache(ctx context.Context, observer *Observer, config CacheConfig, retry
 
 	observer.Info(ctx, "Connected to the cache")
 
-	cache := cache.New(&cache.Options{
+	options := &cache.Options{
 		Redis:        pool,
 		LocalCache:   nil,
 		StatsEnabled: false,
-	})
+	}
+
+	if config.Local != nil {
+		options.LocalCache = cache.NewTinyLFU(*config.Local.Size, *config.Local.TTL)
+	}
+
+	// The go-redis/cache Cache is also the default codec as it has no Redis configured
+	var codec CacheCodec = cache.New(&cache.Options{})
+	if config.Codec != nil {
+		codec = config.Codec
+	}
 
-	return &Cache{
+	options.Marshal = func(value any) ([]byte, error) {
+		data, err := codec.Marshal(value)
+		if err != nil {
+			return nil, _cacheSerializationError{err}
+		}
+
+		return data, nil
+	}
+
+	options.Unmarshal = func(data []byte, dest any) error {
+		err := codec.Unmarshal(data, dest)
+		if err != nil {
+			return _cacheSerializationError{err}
+		}
+
+		return nil
+	}
+
+	cache := &Cache{
 		observer: observer,
 		config:   config,
 		pool:     pool,
-		cache:    cache,
-	}, nil
+		cache:    cache.New(options),
+		breaker:  _newCircuitBreaker(config.CircuitBreaker),
+		loads:    &util.Group[[]byte]{},
+		inFlight: &sync.WaitGroup{},
+		mutex:    &sync.Mutex{},
+		instance: util.RandomString(_CACHE_LOCAL_INSTANCE_LENGTH),
+	}
+
+	if cache.broadcasting() {
+		invalidationCtx, stopInvalidation := context.WithCancel(context.WithoutCancel(ctx))
+		cache.stopInvalidation = stopInvalidation
+		cache.listened = make(chan struct{})
+
+		go cache.listenInvalidations(invalidationCtx)
+	}
+
+	return cache, nil
 }
 
 func (self *Cache) Health(ctx context.Context) error {
 	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
+		if self.breaker != nil && self.breaker.State() == util.CircuitBreakerOpen {
+			return ErrCacheUnhealthy.Raise().With("circuit breaker open")
+		}
+
 		currentConns := self.pool.PoolStats().TotalConns
 		if currentConns < uint32(*self.config.MinConns) {
 			return ErrCacheUnhealthy.Raise().With("current conns %d below minimum %d",
@@ -170,11 +384,24 @@ func (self *Cache) Health(ctx context.Context) error {
 	return nil
 }
 
+// _cacheSerializationError marks the codec errors so that they are not mistaken for infrastructure errors.
+type _cacheSerializationError struct {
+	error
+}
+
+func (self _cacheSerializationError) Unwrap() error {
+	return self.error
+}
+
 func _chErrToError(err error) *errors.Error {
 	if err == nil {
 		return nil
 	}
 
+	if serializationErr, ok := err.(_cacheSerializationError); ok { // nolint:errorlint
+		return ErrCacheSerialization.Raise().Skip(2).Cause(serializationErr.error)
+	}
+
 	switch err {
 	case cache.ErrCacheMiss:
 		return ErrCacheMiss.Raise().Skip(2).Cause(err)
@@ -183,63 +410,434 @@ func _chErrToError(err error) *errors.Error {
 	}
 }
 
+// _chSerializationErrToError adds the key and the Go type of the value to the serialization errors.
+func _chSerializationErrToError(err *errors.Error, key string, value any) *errors.Error {
+	if ErrCacheSerialization.Is(err) {
+		return err.Extra(map[string]any{"key": key, "type": fmt.Sprintf("%T", value)})
+	}
+
+	return err
+}
+
+// protect runs fn through the circuit breaker, if enabled, only accounting connection
+// failures and not the cache misses nor caller cancellation and deadline errors.
+// Operations are tracked so that Close waits for them and rejected once closing.
+func (self *Cache) protect(fn func() error) error {
+	self.mutex.Lock()
+	if self.closing {
+		self.mutex.Unlock()
+		return ErrCacheUnavailable.Raise().Skip(1).With("cache closing")
+	}
+	self.inFlight.Add(1)
+	self.mutex.Unlock()
+
+	defer self.inFlight.Done()
+
+	if self.breaker == nil {
+		return fn()
+	}
+
+	var err error
+
+	errB := self.breaker.Run(func() error {
+		err = fn()
+		if !_isConnectionFailure(err) {
+			return nil
+		}
+
+		return err
+	})
+	if util.ErrCircuitBreakerOpen.Is(errB) {
+		return ErrCacheUnavailable.Raise().Skip(1).Cause(errB)
+	}
+
+	return err
+}
+
 func (self *Cache) Set(ctx context.Context, key string, value any, ttl *time.Duration) error {
 	if ttl == nil {
 		ttl = util.Pointer(0 * time.Second)
 	}
 
-	err := self.cache.Set(&cache.Item{
-		Ctx:            ctx,
-		Key:            key,
-		Value:          value,
-		TTL:            *ttl,
-		SkipLocalCache: false,
+	return self.protect(func() error {
+		err := self.cache.Set(&cache.Item{
+			Ctx:            ctx,
+			Key:            key,
+			Value:          value,
+			TTL:            *ttl,
+			SkipLocalCache: false,
+		})
+		if err != nil {
+			return _chSerializationErrToError(_chErrToError(err), key, value)
+		}
+
+		self.broadcast(ctx, key)
+
+		return nil
 	})
+}
+
+func (self *Cache) Get(ctx context.Context, key string, dest any) error {
+	return self.protect(func() error {
+		err := self.cache.Get(ctx, key, dest)
+		if err != nil {
+			return _chSerializationErrToError(_chErrToError(err), key, dest)
+		}
+
+		return nil
+	})
+}
+
+// TryGet is like Get but reports a miss as not being a hit instead of as ErrCacheMiss,
+// so that the returned error is always a real failure.
+func (self *Cache) TryGet(ctx context.Context, key string, dest any) (bool, error) {
+	err := self.Get(ctx, key, dest)
 	if err != nil {
-		return _chErrToError(err)
+		if ErrCacheMiss.Is(err) {
+			return false, nil
+		}
+
+		return false, err
 	}
 
-	return nil
+	return true, nil
 }
 
-func (self *Cache) Get(ctx context.Context, key string, dest any) error {
-	err := self.cache.Get(ctx, key, dest)
+// GetOrSet fills dest from the cached key or, on a miss, from the value returned by load, which is cached for ttl.
+// Concurrent misses of the same key within the instance share a single load.
+func (self *Cache) GetOrSet(ctx context.Context, key string, dest any, ttl *time.Duration,
+	load func() (any, error)) error {
+	hit, err := self.TryGet(ctx, key, dest)
+	if err != nil || hit {
+		return err
+	}
+
+	data, _, err := self.loads.Do(key, func() ([]byte, error) {
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		err = self.Set(ctx, key, value, ttl)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := self.cache.Marshal(value)
+		if err != nil {
+			return nil, _chSerializationErrToError(_chErrToError(err), key, value)
+		}
+
+		return data, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = self.cache.Unmarshal(data, dest)
 	if err != nil {
-		return _chErrToError(err)
+		return _chSerializationErrToError(_chErrToError(err), key, dest)
 	}
 
 	return nil
 }
 
-func (self *Cache) Delete(ctx context.Context, key string) error {
-	err := self.cache.Delete(ctx, key)
+func (self *Cache) SetNX(ctx context.Context, key string, value any, ttl *time.Duration) (bool, error) {
+	if ttl == nil {
+		ttl = util.Pointer(0 * time.Second)
+	}
+
+	var set bool
+
+	err := self.protect(func() error {
+		data, err := self.cache.Marshal(value)
+		if err != nil {
+			return _chSerializationErrToError(_chErrToError(err), key, value)
+		}
+
+		set, err = self.pool.SetNX(ctx, key, data, *ttl).Result()
+		if err != nil {
+			return _chErrToError(err)
+		}
+
+		// The key is set bypassing the local tier, which may still hold it after it expired in Redis
+		if set {
+			self.cache.DeleteFromLocalCache(key)
+			self.broadcast(ctx, key)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return _chErrToError(err)
+		return false, err
 	}
 
-	return nil
+	return set, nil
+}
+
+// SetIfNewer stores value only if version is greater than the version of the stored value, atomically, so
+// that a slow writer cannot overwrite a newer value. It reports whether the value was stored or the race lost.
+func (self *Cache) SetIfNewer(ctx context.Context, key string, value any, version int64,
+	ttl *time.Duration) (bool, error) {
+	if ttl == nil {
+		ttl = util.Pointer(0 * time.Second)
+	}
+
+	var set bool
+
+	err := self.protect(func() error {
+		data, err := self.cache.Marshal(value)
+		if err != nil {
+			return _chSerializationErrToError(_chErrToError(err), key, value)
+		}
+
+		result, err := _CACHE_SET_IF_NEWER_SCRIPT.Run(ctx, self.pool,
+			[]string{key, fmt.Sprintf(_CACHE_VERSION_KEY, key)}, data, version, ttl.Milliseconds()).Int()
+		if err != nil {
+			return _chErrToError(err)
+		}
+
+		set = result == 1
+
+		if set {
+			self.cache.DeleteFromLocalCache(key)
+			self.broadcast(ctx, key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return set, nil
+}
+
+func (self *Cache) Increment(ctx context.Context, key string, delta int, ttl *time.Duration) (int, error) {
+	var increment *redis.IntCmd
+
+	err := self.protect(func() error {
+		pipeline := self.pool.TxPipeline()
+
+		increment = pipeline.IncrBy(ctx, key, int64(delta))
+		if ttl != nil {
+			pipeline.Expire(ctx, key, *ttl)
+		}
+
+		_, err := pipeline.Exec(ctx)
+		if err != nil {
+			return _chErrToError(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(increment.Val()), nil
+}
+
+func (self *Cache) Counter(ctx context.Context, key string) (int, error) {
+	var counter int
+
+	err := self.protect(func() error {
+		var err error
+
+		counter, err = self.pool.Get(ctx, key).Int()
+		if err != nil && err != redis.Nil {
+			return _chErrToError(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return counter, nil
+}
+
+func (self *Cache) Delete(ctx context.Context, key string) error {
+	return self.protect(func() error {
+		err := self.cache.Delete(ctx, key)
+
+		// The rest of the instances may still hold the key locally after it expired in Redis
+		if err == nil || err == cache.ErrCacheMiss {
+			self.broadcast(ctx, key)
+		}
+
+		if err != nil {
+			return _chErrToError(err)
+		}
+
+		return nil
+	})
 }
 
 func (self *Cache) Find(ctx context.Context, pattern string) ([]string, error) {
 	keys := []string{}
 
-	iter := self.pool.Scan(ctx, 0, pattern, 0).Iterator()
-	for iter.Next(ctx) {
-		keys = append(keys, iter.Val())
+	err := self.Scan(ctx, pattern, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Scan calls fn with each key matching the pattern, paginating with SCAN cursors so that neither the keys are
+// loaded all at once nor Redis is blocked as with KEYS. It stops at the first error of fn, which is returned
+// as is. Keys may be passed more than once, and the ones added or deleted while scanning may be missed.
+func (self *Cache) Scan(ctx context.Context, pattern string, fn func(key string) error) error {
+	var errFn error
+
+	err := self.protect(func() error {
+		iter := self.pool.Scan(ctx, 0, pattern, int64(*self.config.ScanCount)).Iterator()
+		for iter.Next(ctx) {
+			errFn = fn(iter.Val())
+			if errFn != nil {
+				return nil
+			}
+		}
+
+		err := iter.Err()
+		if err != nil {
+			return _chErrToError(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	err := iter.Err()
+	return errFn
+}
+
+type _cacheStaleItem struct {
+	Value   []byte    `json:"value" msgpack:"value"`
+	StaleAt time.Time `json:"stale_at" msgpack:"stale_at"`
+}
+
+// SetStale stores value to be served by GetStale, fresh until softTTL and stale until hardTTL.
+func (self *Cache) SetStale(ctx context.Context, key string, value any, softTTL time.Duration,
+	hardTTL time.Duration) error {
+	data, err := self.cache.Marshal(value)
 	if err != nil {
-		return nil, _chErrToError(err)
+		return _chSerializationErrToError(_chErrToError(err), key, value)
 	}
 
-	return keys, nil
+	return self.Set(ctx, key, _cacheStaleItem{
+		Value:   data,
+		StaleAt: time.Now().Add(softTTL),
+	}, &hardTTL)
+}
+
+// GetStale fills dest with the value stored by SetStale. Past its soft TTL the stale value is still
+// served while revalidate, which should refresh it through SetStale, runs asynchronously once at a time.
+// Past its hard TTL the key is missing so the caller has to block on refreshing it.
+func (self *Cache) GetStale(ctx context.Context, key string, dest any, revalidate func()) error {
+	var item _cacheStaleItem
+
+	err := self.Get(ctx, key, &item)
+	if err != nil {
+		return err
+	}
+
+	err = self.cache.Unmarshal(item.Value, dest)
+	if err != nil {
+		return _chSerializationErrToError(_chErrToError(err), key, dest)
+	}
+
+	if time.Now().Before(item.StaleAt) {
+		return nil
+	}
+
+	lock := fmt.Sprintf(_CACHE_STALE_REVALIDATION_KEY, key)
+
+	// Only one revalidation is run at a time across all instances, the rest keep serving the stale value
+	locked, err := self.SetNX(ctx, lock, true, self.config.StaleRevalidationTTL)
+	if err != nil || !locked {
+		return nil // nolint:nilerr
+	}
+
+	// The revalidation is tracked as an operation so that Close waits for it,
+	// the lock being left to expire when the cache started closing meanwhile
+	self.mutex.Lock()
+	if self.closing {
+		self.mutex.Unlock()
+		return nil
+	}
+	self.inFlight.Add(1)
+	self.mutex.Unlock()
+
+	go func() {
+		defer self.inFlight.Done()
+
+		ctx := context.WithoutCancel(ctx)
+		defer self.observer.Recover(ctx)
+
+		defer func() {
+			err := self.Delete(ctx, lock)
+			if err != nil {
+				self.observer.Error(ctx, err)
+			}
+		}()
+
+		revalidate()
+	}()
+
+	return nil
+}
+
+// NamespaceKey prefixes key with the namespace and its current generation, so that all
+// the keys of the namespace can be invalidated at once by bumping the generation.
+func (self *Cache) NamespaceKey(ctx context.Context, namespace string, key string) (string, error) {
+	generation, err := self.Counter(ctx, fmt.Sprintf(_CACHE_NAMESPACE_GENERATION_KEY, namespace))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(_CACHE_NAMESPACE_KEY, namespace, generation, key), nil
+}
+
+// BumpNamespace increments the generation of the namespace in O(1), orphaning its current keys. Orphaned
+// keys are not deleted but are no longer reachable through NamespaceKey, so they should have a TTL to expire.
+func (self *Cache) BumpNamespace(ctx context.Context, namespace string) error {
+	_, err := self.Increment(ctx, fmt.Sprintf(_CACHE_NAMESPACE_GENERATION_KEY, namespace), 1, nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FlushNamespace invalidates all the keys of the namespace with a single INCR rather than a SCAN and DEL.
+func (self *Cache) FlushNamespace(ctx context.Context, namespace string) error {
+	return self.BumpNamespace(ctx, namespace)
 }
 
 func (self *Cache) Close(ctx context.Context) error {
 	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
 		self.observer.Info(ctx, "Closing cache")
 
+		// The invalidations subscription must be closed before rejecting new operations
+		if self.stopInvalidation != nil {
+			self.stopInvalidation()
+			<-self.listened
+		}
+
+		// Stop accepting new operations and wait for the outstanding ones before closing the pool
+		self.mutex.Lock()
+		self.closing = true
+		self.mutex.Unlock()
+
+		self.inFlight.Wait()
+
 		err := self.pool.Close()
 		if err != nil {
 			return ErrCacheGeneric.Raise().Cause(err)
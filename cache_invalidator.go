@@ -0,0 +1,170 @@
+package kit
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/neoxelox/errors"
+
+	"github.com/neoxelox/kit/util"
+)
+
+const (
+	_CACHE_INVALIDATOR_PATTERN_CHARS = "*?["
+)
+
+var (
+	ErrCacheInvalidatorGeneric  = errors.New("cache invalidator failed")
+	ErrCacheInvalidatorTimedOut = errors.New("cache invalidator timed out")
+)
+
+var (
+	_CACHE_INVALIDATOR_DEFAULT_CONFIG = CacheInvalidatorConfig{
+		Channel:       util.Pointer("kit_cache_invalidation"),
+		RelistenDelay: util.Pointer(5 * time.Second),
+	}
+)
+
+// CacheInvalidatorConfig Channel is the Postgres NOTIFY channel listened to and RelistenDelay
+// the time waited before listening again after the listening connection fails.
+type CacheInvalidatorConfig struct {
+	Channel       *string
+	RelistenDelay *time.Duration
+}
+
+// Validate returns the first invalid field of the config, nil pointers being left to the defaults.
+func (self CacheInvalidatorConfig) Validate() error {
+	switch {
+	case self.Channel != nil && *self.Channel == "":
+		return ErrCacheInvalidatorGeneric.Raise().With("cache invalidator config channel is empty")
+	case !_isValidTimeout(self.RelistenDelay):
+		return ErrCacheInvalidatorGeneric.Raise().With("cache invalidator config relisten delay is not positive")
+	}
+
+	return nil
+}
+
+// CacheInvalidator deletes the cached keys notified by the database, so that the caches of all the instances
+// stay coherent with the rows whatever instance, or migration, changed them. Each notification payload is
+// either a key or, when it has any of the glob characters *, ? or [, a pattern of keys as in Cache.Find.
+// A trigger such as the following notifies the keys of the changed rows on commit:
+//
+//	CREATE OR REPLACE FUNCTION "invalidate_user_cache"() RETURNS TRIGGER AS $$
+//	BEGIN
+//		PERFORM pg_notify('kit_cache_invalidation', 'user:' || COALESCE(NEW."id", OLD."id"));
+//		RETURN NULL;
+//	END;
+//	$$ LANGUAGE plpgsql;
+//
+//	CREATE TRIGGER "user_cache_invalidation"
+//	AFTER INSERT OR UPDATE OR DELETE ON "user"
+//	FOR EACH ROW EXECUTE FUNCTION "invalidate_user_cache"();
+//
+// Notifications sent while relistening are lost, so the cached keys should still have a TTL.
+type CacheInvalidator struct {
+	config     CacheInvalidatorConfig
+	observer   *Observer
+	database   *Database
+	cache      Cacher
+	stopListen context.CancelFunc
+	listened   chan struct{}
+}
+
+func NewCacheInvalidator(ctx context.Context, observer *Observer, database *Database, cache Cacher,
+	config CacheInvalidatorConfig) (*CacheInvalidator, error) {
+	util.Merge(&config, _CACHE_INVALIDATOR_DEFAULT_CONFIG)
+
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	invalidator := &CacheInvalidator{
+		config:   config,
+		observer: observer,
+		database: database,
+		cache:    cache,
+		listened: make(chan struct{}),
+	}
+
+	listenCtx, stopListen := context.WithCancel(context.WithoutCancel(ctx))
+	invalidator.stopListen = stopListen
+
+	go invalidator.listen(listenCtx)
+
+	return invalidator, nil
+}
+
+func (self *CacheInvalidator) listen(ctx context.Context) {
+	defer close(self.listened)
+	defer self.observer.Recover(ctx)
+
+	for {
+		self.observer.Infof(ctx, "Listening to cache invalidations on channel %s", *self.config.Channel)
+
+		err := self.database.Listen(ctx, *self.config.Channel, func(payload string) {
+			err := self.Invalidate(ctx, payload)
+			if err != nil {
+				self.observer.Error(ctx, err)
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			self.observer.Error(ctx, ErrCacheInvalidatorGeneric.Raise().
+				With("cannot listen to channel %s", *self.config.Channel).Cause(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*self.config.RelistenDelay):
+		}
+	}
+}
+
+// Invalidate deletes the key, or all the keys matching the pattern, of the notification payload.
+func (self *CacheInvalidator) Invalidate(ctx context.Context, payload string) error {
+	keys := []string{payload}
+
+	if strings.ContainsAny(payload, _CACHE_INVALIDATOR_PATTERN_CHARS) {
+		var err error
+
+		keys, err = self.cache.Find(ctx, payload)
+		if err != nil {
+			return ErrCacheInvalidatorGeneric.Raise().With("cannot find keys of pattern %s", payload).Cause(err)
+		}
+	}
+
+	for _, key := range keys {
+		err := self.cache.Delete(ctx, key)
+		if err != nil && !ErrCacheMiss.Is(err) {
+			return ErrCacheInvalidatorGeneric.Raise().With("cannot delete key %s", key).Cause(err)
+		}
+	}
+
+	self.observer.Debugf(ctx, "Invalidated %d cached keys of %s", len(keys), payload)
+
+	return nil
+}
+
+func (self *CacheInvalidator) Close(ctx context.Context) error {
+	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
+		self.observer.Info(ctx, "Closing cache invalidator")
+
+		self.stopListen()
+		<-self.listened
+
+		self.observer.Info(ctx, "Closed cache invalidator")
+
+		return nil
+	})
+	if err != nil {
+		if util.ErrDeadlineExceeded.Is(err) {
+			return ErrCacheInvalidatorTimedOut.Raise().Cause(err)
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package kit
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// _testInvalidatedCache only implements the Cacher methods used to invalidate keys.
+type _testInvalidatedCache struct {
+	Cacher
+	keys map[string]bool
+}
+
+func (self *_testInvalidatedCache) Delete(ctx context.Context, key string) error {
+	delete(self.keys, key)
+	return nil
+}
+
+func (self *_testInvalidatedCache) Find(ctx context.Context, pattern string) ([]string, error) {
+	keys := []string{}
+
+	for key := range self.keys {
+		if match, _ := path.Match(pattern, key); match {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func TestCacheInvalidatorInvalidate(t *testing.T) {
+	ctx := context.Background()
+
+	observer, err := NewObserver(ctx, ObserverConfig{
+		Environment: EnvIntegration,
+		Service:     "kit",
+		Level:       LvlNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := &_testInvalidatedCache{keys: map[string]bool{
+		"user:1": true, "user:2": true, "user:1:posts": true, "post:1": true,
+	}}
+
+	invalidator := &CacheInvalidator{observer: observer, cache: cache}
+
+	err = invalidator.Invalidate(ctx, "user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = invalidator.Invalidate(ctx, "user:*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, _ := cache.Find(ctx, "*")
+	sort.Strings(keys)
+
+	if !reflect.DeepEqual(keys, []string{"post:1"}) {
+		t.Fatalf("expected only post:1 to be kept, got %v", keys)
+	}
+}
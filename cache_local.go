@@ -0,0 +1,143 @@
+package kit
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/neoxelox/kit/util"
+)
+
+const (
+	_CACHE_LOCAL_INSTANCE_LENGTH        = 16
+	_CACHE_LOCAL_INVALIDATION_SEPARATOR = " "
+)
+
+var (
+	_CACHE_LOCAL_DEFAULT_CONFIG = CacheLocalConfig{
+		Size:                      util.Pointer(10000),
+		TTL:                       util.Pointer(1 * time.Minute),
+		Broadcast:                 util.Pointer(false),
+		BroadcastChannel:          util.Pointer("kit:cache:invalidations"),
+		BroadcastBufferSize:       util.Pointer(1000),
+		BroadcastResubscribeDelay: util.Pointer(5 * time.Second),
+	}
+)
+
+// CacheLocalConfig Size is the maximum number of keys kept in the local tier of each instance, for at most TTL.
+// Broadcast publishes the keys set or deleted by the instance to BroadcastChannel so that the rest of the
+// instances drop them from their local tier, buffering up to BroadcastBufferSize received keys, the oldest being
+// dropped beyond. The subscription is retried every BroadcastResubscribeDelay when it fails. Keys whose broadcast
+// is lost, for example while the subscription reconnects, are only coherent again once they expire locally.
+type CacheLocalConfig struct {
+	Size                      *int
+	TTL                       *time.Duration
+	Broadcast                 *bool
+	BroadcastChannel          *string
+	BroadcastBufferSize       *int
+	BroadcastResubscribeDelay *time.Duration
+}
+
+// Validate returns the first invalid field of the config, nil pointers being left to the defaults.
+func (self CacheLocalConfig) Validate() error {
+	switch {
+	case self.Size != nil && *self.Size < 1:
+		return ErrCacheGeneric.Raise().With("cache local config size %d is not positive", *self.Size)
+	case !_isValidTimeout(self.TTL):
+		return ErrCacheGeneric.Raise().With("cache local config ttl is not positive")
+	case self.BroadcastChannel != nil && *self.BroadcastChannel == "":
+		return ErrCacheGeneric.Raise().With("cache local config broadcast channel is empty")
+	case self.BroadcastBufferSize != nil && *self.BroadcastBufferSize < 1:
+		return ErrCacheGeneric.Raise().With(
+			"cache local config broadcast buffer size %d is not positive", *self.BroadcastBufferSize)
+	case !_isValidTimeout(self.BroadcastResubscribeDelay):
+		return ErrCacheGeneric.Raise().With("cache local config broadcast resubscribe delay is not positive")
+	}
+
+	return nil
+}
+
+// broadcasting reports whether the keys changed by the instance are broadcast to the rest of the instances.
+func (self *Cache) broadcasting() bool {
+	return self.config.Local != nil && *self.config.Local.Broadcast
+}
+
+// broadcast publishes the key so that the rest of the instances drop it from their local tier. It is called
+// within protect, once the key has been changed, and its failures are only reported, as the key is still
+// coherent once it expires locally.
+func (self *Cache) broadcast(ctx context.Context, key string) {
+	if !self.broadcasting() {
+		return
+	}
+
+	err := self.pool.Publish(ctx, *self.config.Local.BroadcastChannel,
+		self.instance+_CACHE_LOCAL_INVALIDATION_SEPARATOR+key).Err()
+	if err != nil {
+		self.observer.Warnf(ctx, "Cannot broadcast the invalidation of cached key %s: %s", key, err)
+	}
+}
+
+// invalidateLocal drops the key of the invalidation message from the local tier,
+// unless the message was broadcast by the instance itself, whose local tier is up to date.
+func (self *Cache) invalidateLocal(ctx context.Context, message string) {
+	instance, key, ok := strings.Cut(message, _CACHE_LOCAL_INVALIDATION_SEPARATOR)
+	if !ok || instance == self.instance {
+		return
+	}
+
+	self.cache.DeleteFromLocalCache(key)
+
+	self.observer.Debugf(ctx, "Invalidated locally cached key %s", key)
+}
+
+// listenInvalidations drops the keys broadcast by the rest of the instances from the local tier until ctx is done,
+// subscribing again whenever the subscription cannot be made. Dropped connections are resubscribed by go-redis.
+func (self *Cache) listenInvalidations(ctx context.Context) {
+	defer close(self.listened)
+	defer self.observer.Recover(ctx)
+
+	channel := *self.config.Local.BroadcastChannel
+
+	for {
+		subscription, err := self.Subscribe(ctx, channel, CacheSubscriptionConfig{
+			BufferSize: self.config.Local.BroadcastBufferSize,
+			Overflow:   util.Pointer(CacheOverflowDropOldest),
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				self.observer.Warnf(ctx, "Cannot subscribe to cache invalidations on channel %s, "+
+					"falling back to the local ttl: %s", channel, err)
+			}
+		} else {
+			self.observer.Infof(ctx, "Listening to cache invalidations on channel %s", channel)
+
+			self.consumeInvalidations(ctx, subscription)
+
+			err = subscription.Close(context.WithoutCancel(ctx))
+			if err != nil {
+				self.observer.Error(ctx, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*self.config.Local.BroadcastResubscribeDelay):
+		}
+	}
+}
+
+func (self *Cache) consumeInvalidations(ctx context.Context, subscription *CacheSubscription) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-subscription.Messages():
+			if !ok {
+				return
+			}
+
+			self.invalidateLocal(ctx, message)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package kit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/cache/v8"
+
+	"github.com/neoxelox/kit/util"
+)
+
+func TestCacheLocalInvalidation(t *testing.T) {
+	ctx := context.Background()
+
+	observer, err := NewObserver(ctx, ObserverConfig{
+		Environment: EnvIntegration,
+		Service:     "kit",
+		Level:       LvlNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := cache.NewTinyLFU(10, 1*time.Minute)
+	local.Set("user:1", []byte("1"))
+	local.Set("user:2", []byte("2"))
+
+	instance := &Cache{
+		observer: observer,
+		cache:    cache.New(&cache.Options{LocalCache: local}),
+		instance: "local",
+	}
+
+	instance.invalidateLocal(ctx, "remote user:1")
+	instance.invalidateLocal(ctx, "local user:2")
+	instance.invalidateLocal(ctx, "user:2")
+
+	if _, ok := local.Get("user:1"); ok {
+		t.Fatalf("expected key broadcast by another instance to be dropped")
+	}
+
+	if _, ok := local.Get("user:2"); !ok {
+		t.Fatalf("expected key broadcast by the instance itself to be kept")
+	}
+}
+
+func TestCacheLocalConfigValidate(t *testing.T) {
+	err := CacheLocalConfig{Size: util.Pointer(0)}.Validate()
+	if !ErrCacheGeneric.Is(err) {
+		t.Fatalf("expected non positive size to be invalid, got %v", err)
+	}
+
+	err = CacheLocalConfig{BroadcastChannel: util.Pointer("")}.Validate()
+	if !ErrCacheGeneric.Is(err) {
+		t.Fatalf("expected empty broadcast channel to be invalid, got %v", err)
+	}
+
+	err = _CACHE_LOCAL_DEFAULT_CONFIG.Validate()
+	if err != nil {
+		t.Fatalf("expected default config to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package kit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/neoxelox/kit/util"
+)
+
+const (
+	_CACHE_SUBSCRIPTION_DROPPED_REPORT_INTERVAL = 10 * time.Second
+)
+
+// CacheOverflowPolicy decides what happens to the messages of a subscription whose buffer is full.
+type CacheOverflowPolicy string
+
+var (
+	// CacheOverflowDropOldest drops the oldest buffered message to make room for the new one.
+	CacheOverflowDropOldest CacheOverflowPolicy = "drop-oldest"
+	// CacheOverflowBlock waits up to the block timeout for room and then drops the new message.
+	CacheOverflowBlock CacheOverflowPolicy = "block"
+)
+
+var (
+	_CACHE_SUBSCRIPTION_DEFAULT_CONFIG = CacheSubscriptionConfig{
+		BufferSize:   util.Pointer(100),
+		Overflow:     util.Pointer(CacheOverflowDropOldest),
+		BlockTimeout: util.Pointer(1 * time.Second),
+	}
+)
+
+// CacheSubscriptionConfig BufferSize is the number of messages buffered for a slow consumer
+// before applying the Overflow policy, BlockTimeout being only used by CacheOverflowBlock.
+type CacheSubscriptionConfig struct {
+	BufferSize   *int
+	Overflow     *CacheOverflowPolicy
+	BlockTimeout *time.Duration
+}
+
+// Validate returns the first invalid field of the config, nil pointers being left to the defaults.
+func (self CacheSubscriptionConfig) Validate() error {
+	switch {
+	case self.BufferSize != nil && *self.BufferSize < 1:
+		return ErrCacheGeneric.Raise().With("cache subscription config buffer size %d is not positive", *self.BufferSize)
+	case self.Overflow != nil && *self.Overflow != CacheOverflowDropOldest && *self.Overflow != CacheOverflowBlock:
+		return ErrCacheGeneric.Raise().With("cache subscription config overflow %s is unknown", *self.Overflow)
+	case !_isValidTimeout(self.BlockTimeout):
+		return ErrCacheGeneric.Raise().With("cache subscription config block timeout is not positive")
+	}
+
+	return nil
+}
+
+func (self *Cache) Publish(ctx context.Context, channel string, message string) error {
+	return self.protect(func() error {
+		err := self.pool.Publish(ctx, channel, message).Err()
+		if err != nil {
+			return _chErrToError(err)
+		}
+
+		return nil
+	})
+}
+
+// Subscribe receives the messages published to the channel until the subscription is closed, which must be
+// done before closing the Cache. Messages are buffered so that a slow consumer never blocks the reader, the
+// messages dropped by the overflow policy being counted and periodically reported through the observer.
+func (self *Cache) Subscribe(ctx context.Context, channel string,
+	config ...CacheSubscriptionConfig) (*CacheSubscription, error) {
+	_config := util.Optional(config, CacheSubscriptionConfig{})
+	util.Merge(&_config, _CACHE_SUBSCRIPTION_DEFAULT_CONFIG)
+
+	err := _config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var pubsub *redis.PubSub
+
+	err = self.protect(func() error {
+		pubsub = self.pool.Subscribe(ctx, channel)
+
+		// Wait for the confirmation so that the messages published after subscribing are not missed
+		_, err := pubsub.Receive(ctx)
+		if err != nil {
+			pubsub.Close() // nolint:errcheck
+			return _chErrToError(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	subscription := &CacheSubscription{
+		config:    _config,
+		observer:  self.observer,
+		channel:   channel,
+		pubsub:    pubsub,
+		messages:  make(chan string, *_config.BufferSize),
+		dropped:   &atomic.Int64{},
+		forwarded: make(chan struct{}),
+	}
+
+	forwardCtx, stopForward := context.WithCancel(context.WithoutCancel(ctx))
+	subscription.stopForward = stopForward
+
+	go subscription.forward(forwardCtx)
+
+	return subscription, nil
+}
+
+type CacheSubscription struct {
+	config      CacheSubscriptionConfig
+	observer    *Observer
+	channel     string
+	pubsub      *redis.PubSub
+	messages    chan string
+	dropped     *atomic.Int64
+	stopForward context.CancelFunc
+	forwarded   chan struct{}
+}
+
+// Messages returns the buffered messages of the subscription, closed once the subscription is closed.
+func (self *CacheSubscription) Messages() <-chan string {
+	return self.messages
+}
+
+// Dropped returns the number of messages dropped by the overflow policy so far.
+func (self *CacheSubscription) Dropped() int64 {
+	return self.dropped.Load()
+}
+
+func (self *CacheSubscription) forward(ctx context.Context) {
+	defer close(self.forwarded)
+	defer close(self.messages)
+	defer self.observer.Recover(ctx)
+
+	messages := self.pubsub.Channel()
+
+	reported := int64(0)
+	var reportedAt time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			self.deliver(ctx, message.Payload)
+		}
+
+		// Dropped messages are reported at most once per interval so that the backpressure does not flood logs
+		if dropped := self.dropped.Load(); dropped > reported &&
+			time.Since(reportedAt) >= _CACHE_SUBSCRIPTION_DROPPED_REPORT_INTERVAL {
+			self.observer.Warnf(ctx, "Cache subscription to %s dropped %d messages as its consumer is slow",
+				self.channel, dropped-reported)
+			reported = dropped
+			reportedAt = time.Now()
+		}
+	}
+}
+
+// deliver buffers the message applying the overflow policy when the buffer is full.
+// It is only called by the forwarding goroutine, which is the only sender of the messages.
+func (self *CacheSubscription) deliver(ctx context.Context, message string) {
+	switch *self.config.Overflow {
+	case CacheOverflowBlock:
+		select {
+		case self.messages <- message:
+			return
+		default:
+		}
+
+		timer := time.NewTimer(*self.config.BlockTimeout)
+		defer timer.Stop()
+
+		select {
+		case self.messages <- message:
+		case <-timer.C:
+			self.dropped.Add(1)
+		case <-ctx.Done():
+		}
+	default:
+		for {
+			select {
+			case self.messages <- message:
+				return
+			default:
+			}
+
+			// The consumer may have drained the buffer in the meantime so nothing is dropped then
+			select {
+			case <-self.messages:
+				self.dropped.Add(1)
+			default:
+			}
+		}
+	}
+}
+
+func (self *CacheSubscription) Close(ctx context.Context) error {
+	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
+		self.stopForward()
+
+		err := self.pubsub.Close()
+		if err != nil {
+			return _chErrToError(err)
+		}
+
+		<-self.forwarded
+
+		if dropped := self.dropped.Load(); dropped > 0 {
+			self.observer.Infof(ctx, "Cache subscription to %s dropped %d messages in total", self.channel, dropped)
+		}
+
+		return nil
+	})
+	if err != nil {
+		if util.ErrDeadlineExceeded.Is(err) {
+			return ErrCacheTimedOut.Raise().Cause(err)
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package kit
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neoxelox/kit/util"
+)
+
+func TestCacheSubscriptionOverflow(t *testing.T) {
+	ctx := context.Background()
+
+	subscription := &CacheSubscription{
+		config:   CacheSubscriptionConfig{Overflow: util.Pointer(CacheOverflowDropOldest)},
+		messages: make(chan string, 2),
+		dropped:  &atomic.Int64{},
+	}
+
+	for _, message := range []string{"1", "2", "3", "4"} {
+		subscription.deliver(ctx, message)
+	}
+
+	if subscription.Dropped() != 2 || <-subscription.messages != "3" || <-subscription.messages != "4" {
+		t.Fatalf("expected the oldest messages to be dropped")
+	}
+
+	subscription = &CacheSubscription{
+		config: CacheSubscriptionConfig{
+			Overflow:     util.Pointer(CacheOverflowBlock),
+			BlockTimeout: util.Pointer(10 * time.Millisecond),
+		},
+		messages: make(chan string, 1),
+		dropped:  &atomic.Int64{},
+	}
+
+	subscription.deliver(ctx, "1")
+
+	start := time.Now()
+	subscription.deliver(ctx, "2")
+
+	if time.Since(start) < 10*time.Millisecond || subscription.Dropped() != 1 || <-subscription.messages != "1" {
+		t.Fatalf("expected the new message to be dropped after blocking")
+	}
+}
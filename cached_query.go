@@ -0,0 +1,72 @@
+package kit
+
+import (
+	"context"
+	"time"
+
+	"github.com/leporo/sqlf"
+)
+
+// CachedQuerier implements the cache-aside pattern over a Database and a Cache.
+type CachedQuerier struct {
+	cache    Cacher
+	database Querier
+}
+
+func CachedQuery(cache Cacher, database Querier) *CachedQuerier {
+	return &CachedQuerier{
+		cache:    cache,
+		database: database,
+	}
+}
+
+// Get fills dest from the cached key or, on a miss, runs stmt into dest and caches it for ttl.
+// Cache failures fall back to the database so that the cache is never a hard dependency,
+// and queries within a transaction bypass the cache as they can see uncommitted rows.
+func (self *CachedQuerier) Get(ctx context.Context, key string, ttl *time.Duration, stmt *sqlf.Stmt, dest any) error {
+	if self.database.InTransaction(ctx) {
+		return self.database.Query(ctx, stmt.To(dest))
+	}
+
+	err := self.cache.Get(ctx, key, dest)
+	if err == nil {
+		stmt.Close()
+		return nil
+	}
+
+	err = self.database.Query(ctx, stmt.To(dest))
+	if err != nil {
+		return err
+	}
+
+	// Populating the cache is best effort, the next read will try again
+	_ = self.cache.Set(ctx, key, dest, ttl)
+
+	return nil
+}
+
+// Exec runs stmt and then invalidates the cached keys that it affects.
+func (self *CachedQuerier) Exec(ctx context.Context, stmt *sqlf.Stmt, keys ...string) (int, error) {
+	affected, err := self.database.Exec(ctx, stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	err = self.Invalidate(ctx, keys...)
+	if err != nil {
+		return affected, err
+	}
+
+	return affected, nil
+}
+
+func (self *CachedQuerier) Invalidate(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		err := self.cache.Delete(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package kit
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog"
+	"golang.org/x/text/language"
+)
+
+// _contextKey is unexported so that the context values of kit cannot collide with the ones of other
+// packages, nor be set with the wrong type, as they can only be accessed through Context.
+type _contextKey string
+
+const (
+	_contextKeyDatabaseTransaction        _contextKey = "database:transaction"
+	_contextKeyDatabasePrimaryRead        _contextKey = "database:primary:read"
+	_contextKeyDatabaseTransactionAttempt _contextKey = "database:transaction:attempt"
+	_contextKeyLocalizerLocale            _contextKey = "localizer:locale"
+	_contextKeyTraceID                    _contextKey = "trace:id"
+	_contextKeyTraceState                 _contextKey = "trace:state"
+	_contextKeyObserverLogger             _contextKey = "observer:logger"
+	_contextKeyRequestID                  _contextKey = "request:id"
+)
+
+// Context sets and gets the typed request-scoped values that kit keeps in a context.Context.
+// Getters report whether the value is present and also read the values set with the deprecated keys.
+var Context _context
+
+type _context struct{}
+
+func _contextValue[T any](ctx context.Context, key _contextKey, deprecated Key) (T, bool) {
+	if value, ok := ctx.Value(key).(T); ok {
+		return value, true
+	}
+
+	value, ok := ctx.Value(deprecated).(T)
+
+	return value, ok
+}
+
+func (self _context) WithTransaction(ctx context.Context, transaction pgx.Tx) context.Context {
+	return context.WithValue(ctx, _contextKeyDatabaseTransaction, transaction)
+}
+
+func (self _context) Transaction(ctx context.Context) (pgx.Tx, bool) {
+	return _contextValue[pgx.Tx](ctx, _contextKeyDatabaseTransaction, KeyDatabaseTransaction)
+}
+
+func (self _context) WithTransactionAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, _contextKeyDatabaseTransactionAttempt, attempt)
+}
+
+// TransactionAttempt returns the attempt, starting at 1, of the Transaction being run, or 0 outside of one.
+func (self _context) TransactionAttempt(ctx context.Context) int {
+	attempt, _ := ctx.Value(_contextKeyDatabaseTransactionAttempt).(int)
+	return attempt
+}
+
+func (self _context) WithPrimaryRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, _contextKeyDatabasePrimaryRead, true)
+}
+
+func (self _context) PrimaryRead(ctx context.Context) bool {
+	primary, _ := _contextValue[bool](ctx, _contextKeyDatabasePrimaryRead, KeyDatabasePrimaryRead)
+	return primary
+}
+
+func (self _context) WithLocale(ctx context.Context, locale language.Tag) context.Context {
+	return context.WithValue(ctx, _contextKeyLocalizerLocale, locale)
+}
+
+func (self _context) Locale(ctx context.Context) (language.Tag, bool) {
+	return _contextValue[language.Tag](ctx, _contextKeyLocalizerLocale, KeyLocalizerLocale)
+}
+
+func (self _context) WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, _contextKeyTraceID, traceID)
+}
+
+func (self _context) TraceID(ctx context.Context) (string, bool) {
+	return _contextValue[string](ctx, _contextKeyTraceID, KeyTraceID)
+}
+
+// WithTraceState keeps the vendor specific W3C trace state to be propagated to the downstream services.
+func (self _context) WithTraceState(ctx context.Context, traceState string) context.Context {
+	return context.WithValue(ctx, _contextKeyTraceState, traceState)
+}
+
+func (self _context) TraceState(ctx context.Context) (string, bool) {
+	return _contextValue[string](ctx, _contextKeyTraceState, KeyTraceState)
+}
+
+func (self _context) WithLogger(ctx context.Context, logger *zerolog.Logger) context.Context {
+	return context.WithValue(ctx, _contextKeyObserverLogger, logger)
+}
+
+func (self _context) Logger(ctx context.Context) (*zerolog.Logger, bool) {
+	return _contextValue[*zerolog.Logger](ctx, _contextKeyObserverLogger, KeyObserverLogger)
+}
+
+func (self _context) WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, _contextKeyRequestID, requestID)
+}
+
+func (self _context) RequestID(ctx context.Context) (string, bool) {
+	return _contextValue[string](ctx, _contextKeyRequestID, KeyRequestID)
+}
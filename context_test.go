@@ -0,0 +1,29 @@
+package kit
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	ctx := Context.WithRequestID(context.Background(), "request")
+
+	if requestID, ok := Context.RequestID(ctx); !ok || requestID != "request" {
+		t.Fatalf("expected request ID to be set, got %s", requestID)
+	}
+
+	if _, ok := Context.TraceID(ctx); ok || Context.PrimaryRead(ctx) {
+		t.Fatalf("expected unset values to be missing")
+	}
+
+	// Values set by the callers of the deprecated keys are still read
+	ctx = context.WithValue(ctx, KeyTraceID, "trace") // nolint:staticcheck
+
+	if traceID, ok := Context.TraceID(ctx); !ok || traceID != "trace" {
+		t.Fatalf("expected trace ID set with the deprecated key, got %s", traceID)
+	}
+
+	if ctx.Value(KeyRequestID) != nil { // nolint:staticcheck
+		t.Fatalf("expected request ID not to collide with the deprecated key")
+	}
+}
@@ -2,41 +2,60 @@ package kit
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"regexp"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/leporo/sqlf"
 	"github.com/neoxelox/errors"
 	"github.com/randallmlough/pgxscan"
+	"github.com/vmihailenco/msgpack/v5"
 
 	"github.com/neoxelox/kit/util"
 )
 
 const (
-	_DATABASE_POSTGRES_DSN = "postgresql://%s:%s@%s:%d/%s?sslmode=%s"
+	_DATABASE_POSTGRES_DSN              = "postgresql://%s:%s@%s:%d/%s?sslmode=%s"
+	_DATABASE_LIFE_TIME_JITTER_FRACTION = 10
+	_DATABASE_QUERY_CACHE_KEY           = "kit:database:query:%s"
 )
 
 var (
 	_DATABASE_ERR_PGCODE = regexp.MustCompile(`\(SQLSTATE (.*)\)`)
 
+	// Deprecated: KeyDatabaseTransaction is no longer set by kit, use Context.Transaction instead.
 	KeyDatabaseTransaction Key = KeyBase + "database:transaction"
+	// Deprecated: KeyDatabasePrimaryRead is no longer set by kit, use Context.PrimaryRead instead.
+	KeyDatabasePrimaryRead Key = KeyBase + "database:primary:read"
 )
 
 var (
 	ErrDatabaseGeneric            = errors.New("database failed")
 	ErrDatabaseTimedOut           = errors.New("database timed out")
 	ErrDatabaseUnhealthy          = errors.New("database unhealthy")
+	ErrDatabaseUnavailable        = errors.New("database unavailable")
 	ErrDatabaseTransactionFailed  = errors.New("database transaction failed")
 	ErrDatabaseNoRows             = errors.New("database no rows in result set")
+	ErrDatabaseMultipleRows       = errors.New("database multiple rows in result set")
 	ErrDatabaseIntegrityViolation = errors.New("database integrity constraint violation")
+	ErrDatabaseSerialization      = errors.New("database serialization failure")
 	ErrDatabaseUnexpectedEffect   = errors.New("database affected %d out of %d expected rows")
+	ErrDatabaseInvalidCursor      = errors.New("database invalid pagination cursor")
 )
 
 var _KlevelToPlevel = map[Level]pgx.LogLevel{
@@ -55,18 +74,36 @@ var (
 		MaxConnIdleTime:       util.Pointer(30 * time.Minute),
 		MaxConnLifeTime:       util.Pointer(1 * time.Hour),
 		DialTimeout:           util.Pointer(30 * time.Second),
+		AcquireTimeout:        util.Pointer(10 * time.Second),
 		StatementTimeout:      util.Pointer(30 * time.Second),
 		DefaultIsolationLevel: util.Pointer(IsoLvlReadCommitted),
 	}
 
+	_DATABASE_RECONNECT_DEFAULT_CONFIG = DatabaseReconnectConfig{
+		Interval: util.Pointer(10 * time.Second),
+		Failures: util.Pointer(3),
+		Timeout:  util.Pointer(5 * time.Second),
+	}
+
 	_DATABASE_DEFAULT_RETRY_CONFIG = RetryConfig{
 		Attempts:     1,
 		InitialDelay: 0 * time.Second,
 		LimitDelay:   0 * time.Second,
-		Retriables:   []error{},
+		Retriables:   NetworkRetriables,
 	}
 )
 
+// Querier is implemented by Database so that code depending on it can be tested with fakes.
+type Querier interface {
+	Query(ctx context.Context, stmt *sqlf.Stmt) error
+	QueryRow(ctx context.Context, stmt *sqlf.Stmt, dest ...any) error
+	Exec(ctx context.Context, stmt *sqlf.Stmt) (int, error)
+	Transaction(ctx context.Context, level *IsolationLevel, fn func(ctx context.Context) error) error
+	InTransaction(ctx context.Context) bool
+}
+
+var _ Querier = (*Database)(nil)
+
 type IsolationLevel int
 
 var (
@@ -83,6 +120,12 @@ var _KisoLevelToPisoLevel = map[IsolationLevel]pgx.TxIsoLevel{
 	IsoLvlSerializable:    pgx.Serializable,
 }
 
+// DatabaseConfig ReplicaHost, when set, routes the reads of Query and QueryRow, and so of Count, Exists and
+// QueryCached, outside of a Transaction to a read replica, on ReplicaPort or else Port, with the same credentials.
+// Reads within a context from WithPrimaryRead are served by the primary, which is also needed by the statements
+// writing through Query, for example with RETURNING. TransactionRetry, when set, retries the whole Transaction
+// on serialization failures and deadlocks, or on its Retriables, rerunning fn, which must not have side effects
+// outside the transaction. The attempt being run is available to fn through Context.TransactionAttempt.
 type DatabaseConfig struct {
 	Host                  string
 	Port                  int
@@ -95,15 +138,118 @@ type DatabaseConfig struct {
 	MaxConns              *int
 	MaxConnIdleTime       *time.Duration
 	MaxConnLifeTime       *time.Duration
+	MaxConnLifeTimeJitter *time.Duration
 	DialTimeout           *time.Duration
+	AcquireTimeout        *time.Duration
 	StatementTimeout      *time.Duration
 	DefaultIsolationLevel *IsolationLevel
+	CircuitBreaker        *CircuitBreakerConfig
+	Reconnect             *DatabaseReconnectConfig
+	EnumTypes             []string
+	QueryCache            Cacher
+	TransactionRetry      *RetryConfig
+	ReplicaHost           string
+	ReplicaPort           int
+}
+
+// DatabaseReconnectConfig enables rebuilding the pool in the background once the database health check fails
+// Failures consecutive times, checked every Interval, instead of waiting for the lazy per-query reconnection.
+type DatabaseReconnectConfig struct {
+	Interval *time.Duration
+	Failures *int
+	Timeout  *time.Duration
+}
+
+// Validate returns the first invalid field of the config, nil pointers being left to the defaults.
+func (self DatabaseConfig) Validate() error {
+	switch {
+	case self.Host == "":
+		return ErrDatabaseGeneric.Raise().With("database config host is empty")
+	case !_isValidPort(self.Port):
+		return ErrDatabaseGeneric.Raise().With("database config port %d is out of range", self.Port)
+	case self.User == "":
+		return ErrDatabaseGeneric.Raise().With("database config user is empty")
+	case self.Database == "":
+		return ErrDatabaseGeneric.Raise().With("database config database is empty")
+	case self.MinConns != nil && *self.MinConns < 0:
+		return ErrDatabaseGeneric.Raise().With("database config min conns %d is negative", *self.MinConns)
+	case self.MaxConns != nil && *self.MaxConns < 1:
+		return ErrDatabaseGeneric.Raise().With("database config max conns %d is not positive", *self.MaxConns)
+	case self.MinConns != nil && self.MaxConns != nil && *self.MinConns > *self.MaxConns:
+		return ErrDatabaseGeneric.Raise().With(
+			"database config min conns %d is greater than max conns %d", *self.MinConns, *self.MaxConns)
+	case !_isValidTimeout(self.MaxConnIdleTime):
+		return ErrDatabaseGeneric.Raise().With("database config max conn idle time is not positive")
+	case !_isValidTimeout(self.MaxConnLifeTime):
+		return ErrDatabaseGeneric.Raise().With("database config max conn life time is not positive")
+	case self.MaxConnLifeTimeJitter != nil && *self.MaxConnLifeTimeJitter < 0:
+		return ErrDatabaseGeneric.Raise().With("database config max conn life time jitter is negative")
+	case !_isValidTimeout(self.DialTimeout):
+		return ErrDatabaseGeneric.Raise().With("database config dial timeout is not positive")
+	case !_isValidTimeout(self.AcquireTimeout):
+		return ErrDatabaseGeneric.Raise().With("database config acquire timeout is not positive")
+	case !_isValidTimeout(self.StatementTimeout):
+		return ErrDatabaseGeneric.Raise().With("database config statement timeout is not positive")
+	case self.ReplicaPort != 0 && !_isValidPort(self.ReplicaPort):
+		return ErrDatabaseGeneric.Raise().With("database config replica port %d is out of range", self.ReplicaPort)
+	}
+
+	if self.Reconnect != nil {
+		switch {
+		case !_isValidTimeout(self.Reconnect.Interval):
+			return ErrDatabaseGeneric.Raise().With("database config reconnect interval is not positive")
+		case self.Reconnect.Failures != nil && *self.Reconnect.Failures < 1:
+			return ErrDatabaseGeneric.Raise().With(
+				"database config reconnect failures %d is not positive", *self.Reconnect.Failures)
+		case !_isValidTimeout(self.Reconnect.Timeout):
+			return ErrDatabaseGeneric.Raise().With("database config reconnect timeout is not positive")
+		}
+	}
+
+	if self.TransactionRetry != nil && self.TransactionRetry.Attempts < 1 {
+		return ErrDatabaseGeneric.Raise().With(
+			"database config transaction retry attempts %d is not positive", self.TransactionRetry.Attempts)
+	}
+
+	if self.DefaultIsolationLevel != nil {
+		if _, ok := _KisoLevelToPisoLevel[*self.DefaultIsolationLevel]; !ok {
+			return ErrDatabaseGeneric.Raise().With(
+				"database config default isolation level %d is unknown", *self.DefaultIsolationLevel)
+		}
+	}
+
+	return nil
+}
+
+// _registerEnumTypes registers the custom enum types, unknown to pgx, so that their values
+// and arrays can be scanned into strings and string slices respectively.
+func _registerEnumTypes(ctx context.Context, conn *pgx.Conn, enumTypes []string) error {
+	for _, enumType := range enumTypes {
+		var oid, arrayOID uint32
+
+		err := conn.QueryRow(ctx, "SELECT oid, typarray FROM pg_type WHERE typname = $1", enumType).
+			Scan(&oid, &arrayOID)
+		if err != nil {
+			return ErrDatabaseGeneric.Raise().With("cannot find enum type %s", enumType).Cause(err)
+		}
+
+		conn.ConnInfo().RegisterDataType(pgtype.DataType{Value: &pgtype.GenericText{}, Name: enumType, OID: oid})
+		conn.ConnInfo().RegisterDataType(pgtype.DataType{Value: &pgtype.EnumArray{}, Name: "_" + enumType, OID: arrayOID})
+	}
+
+	return nil
 }
 
 type Database struct {
-	config   DatabaseConfig
-	observer *Observer
-	pool     *pgxpool.Pool
+	config     DatabaseConfig
+	observer   *Observer
+	pool       *atomic.Pointer[pgxpool.Pool]
+	poolConfig *pgxpool.Config
+	replica    *pgxpool.Pool
+	breaker    *util.CircuitBreaker
+	prepared   *sync.Map
+	stopWatch  context.CancelFunc
+	watched    chan struct{}
 }
 
 func NewDatabase(ctx context.Context, observer *Observer, config DatabaseConfig,
@@ -111,6 +257,21 @@ func NewDatabase(ctx context.Context, observer *Observer, config DatabaseConfig,
 	util.Merge(&config, _DATABASE_DEFAULT_CONFIG)
 	_retry := util.Optional(retry, _DATABASE_DEFAULT_RETRY_CONFIG)
 
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// Spread the expiration of the connections opened together, e.g. at startup, to avoid reconnection storms
+	if config.MaxConnLifeTimeJitter == nil {
+		config.MaxConnLifeTimeJitter = util.Pointer(*config.MaxConnLifeTime / _DATABASE_LIFE_TIME_JITTER_FRACTION)
+	}
+
+	// Only retry transient network errors by default so that, for example, authentication failures fail fast
+	if len(_retry.Retriables) == 0 {
+		_retry.Retriables = NetworkRetriables
+	}
+
 	dsn := fmt.Sprintf(
 		_DATABASE_POSTGRES_DSN,
 		config.User,
@@ -130,6 +291,7 @@ func NewDatabase(ctx context.Context, observer *Observer, config DatabaseConfig,
 	poolConfig.MaxConns = int32(*config.MaxConns)
 	poolConfig.MaxConnIdleTime = *config.MaxConnIdleTime
 	poolConfig.MaxConnLifetime = *config.MaxConnLifeTime
+	poolConfig.MaxConnLifetimeJitter = *config.MaxConnLifeTimeJitter
 	poolConfig.ConnConfig.ConnectTimeout = *config.DialTimeout
 	poolConfig.ConnConfig.RuntimeParams["standard_conforming_strings"] = "on"
 	poolConfig.ConnConfig.RuntimeParams["application_name"] = config.Service
@@ -138,6 +300,12 @@ func NewDatabase(ctx context.Context, observer *Observer, config DatabaseConfig,
 	poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.Itoa(int(config.StatementTimeout.Milliseconds()))
 	poolConfig.ConnConfig.RuntimeParams["lock_timeout"] = strconv.Itoa(int(config.StatementTimeout.Milliseconds()))
 
+	if len(config.EnumTypes) > 0 {
+		poolConfig.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			return _registerEnumTypes(ctx, conn, config.EnumTypes)
+		}
+	}
+
 	pgxLogger := _newPgxLogger(observer)
 	pgxLogLevel := _KlevelToPlevel[pgxLogger.observer.Level()]
 
@@ -149,16 +317,29 @@ func NewDatabase(ctx context.Context, observer *Observer, config DatabaseConfig,
 	poolConfig.ConnConfig.Logger = pgxLogger
 	poolConfig.ConnConfig.LogLevel = pgxLogLevel
 
+	var replicaConfig *pgxpool.Config
+	if config.ReplicaHost != "" {
+		replicaConfig = poolConfig.Copy()
+		replicaConfig.ConnConfig.Host = config.ReplicaHost
+		replicaConfig.ConnConfig.Port = uint16(config.Port)
+		replicaConfig.ConnConfig.Fallbacks = nil
+
+		if config.ReplicaPort != 0 {
+			replicaConfig.ConnConfig.Port = uint16(config.ReplicaPort)
+		}
+	}
+
 	var pool *pgxpool.Pool
+	var replica *pgxpool.Pool
 
 	err = util.Deadline(ctx, func(exceeded <-chan struct{}) error {
-		return util.ExponentialRetry(
-			_retry.Attempts, _retry.InitialDelay, _retry.LimitDelay,
+		return util.BudgetedExponentialRetry(
+			ctx, _retry.Attempts, _retry.InitialDelay, _retry.LimitDelay, _retry.Jitter, _retry.MaxElapsed,
 			_retry.Retriables, func(attempt int) error {
 				var err error // nolint:govet
 
-				observer.Infof(ctx, "Trying to connect to the %s database %d/%d",
-					config.Database, attempt, _retry.Attempts)
+				observer.WithLevelf(ctx, _retryAttemptLevel(attempt, _retry.Attempts),
+					"Trying to connect to the %s database %d/%d", config.Database, attempt, _retry.Attempts)
 
 				pool, err = pgxpool.ConnectConfig(ctx, poolConfig)
 				if err != nil {
@@ -170,6 +351,21 @@ func NewDatabase(ctx context.Context, observer *Observer, config DatabaseConfig,
 					return ErrDatabaseGeneric.Raise().Cause(err)
 				}
 
+				if replicaConfig != nil {
+					replica, err = pgxpool.ConnectConfig(ctx, replicaConfig)
+					if err == nil {
+						err = replica.Ping(ctx)
+						if err != nil {
+							replica.Close()
+						}
+					}
+
+					if err != nil {
+						pool.Close()
+						return ErrDatabaseGeneric.Raise().With("cannot connect to the replica").Cause(err)
+					}
+				}
+
 				return nil
 			})
 	})
@@ -185,26 +381,151 @@ func NewDatabase(ctx context.Context, observer *Observer, config DatabaseConfig,
 
 	sqlf.SetDialect(sqlf.PostgreSQL)
 
-	return &Database{
-		observer: observer,
-		config:   config,
-		pool:     pool,
-	}, nil
+	database := &Database{
+		observer:   observer,
+		config:     config,
+		pool:       &atomic.Pointer[pgxpool.Pool]{},
+		poolConfig: poolConfig,
+		replica:    replica,
+		breaker:    _newCircuitBreaker(config.CircuitBreaker),
+		prepared:   &sync.Map{},
+	}
+
+	database.pool.Store(pool)
+
+	if config.Reconnect != nil {
+		reconnect := *config.Reconnect
+		util.Merge(&reconnect, _DATABASE_RECONNECT_DEFAULT_CONFIG)
+
+		watchCtx, stopWatch := context.WithCancel(context.WithoutCancel(ctx))
+		database.stopWatch = stopWatch
+		database.watched = make(chan struct{})
+
+		go database.watch(watchCtx, reconnect)
+	}
+
+	return database, nil
+}
+
+// watch rebuilds the pool once the health check fails the configured consecutive times, e.g. after a long
+// primary failover, and keeps retrying on every interval until the new pool connects or the database is closed.
+func (self *Database) watch(ctx context.Context, config DatabaseReconnectConfig) {
+	defer close(self.watched)
+	defer self.observer.Recover(ctx)
+
+	ticker := time.NewTicker(*config.Interval)
+	defer ticker.Stop()
+
+	failures := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		healthCtx, cancel := context.WithTimeout(ctx, *config.Timeout)
+		err := self.Health(healthCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			if failures >= *config.Failures {
+				self.observer.Infof(ctx, "Recovered the %s database", self.config.Database)
+			}
+
+			failures = 0
+
+			continue
+		}
+
+		failures++
+
+		if failures < *config.Failures {
+			self.observer.Warnf(ctx, "Database %s health check failed %d/%d: %v",
+				self.config.Database, failures, *config.Failures, err)
+
+			continue
+		}
+
+		self.observer.Error(ctx, err)
+
+		err = self.reconnect(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			self.observer.Error(ctx, err)
+
+			continue
+		}
+
+		failures = 0
+	}
+}
+
+// reconnect replaces the pool with a newly connected one, closing the old pool once its acquired
+// connections are released so that in-flight queries are not interrupted.
+func (self *Database) reconnect(ctx context.Context) error {
+	self.observer.Warnf(ctx, "Reconnecting to the %s database", self.config.Database)
+
+	connectCtx, cancel := context.WithTimeout(ctx, *self.config.DialTimeout)
+	defer cancel()
+
+	pool, err := pgxpool.ConnectConfig(connectCtx, self.poolConfig.Copy())
+	if err != nil {
+		return ErrDatabaseUnavailable.Raise().With("cannot reconnect to the %s database", self.config.Database).
+			Cause(err)
+	}
+
+	err = pool.Ping(connectCtx)
+	if err != nil {
+		pool.Close()
+		return ErrDatabaseUnavailable.Raise().With("cannot reconnect to the %s database", self.config.Database).
+			Cause(err)
+	}
+
+	old := self.pool.Swap(pool)
+
+	go func() {
+		defer self.observer.Recover(ctx)
+		old.Close()
+	}()
+
+	self.observer.Infof(ctx, "Reconnected to the %s database", self.config.Database)
+
+	return nil
 }
 
 func (self *Database) Health(ctx context.Context) error {
 	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
-		currentConns := self.pool.Stat().TotalConns()
+		if self.breaker != nil && self.breaker.State() == util.CircuitBreakerOpen {
+			return ErrDatabaseUnhealthy.Raise().With("circuit breaker open")
+		}
+
+		currentConns := self.pool.Load().Stat().TotalConns()
 		if currentConns < int32(*self.config.MinConns) {
 			return ErrDatabaseUnhealthy.Raise().With("current conns %d below minimum %d",
 				currentConns, *self.config.MinConns)
 		}
 
-		err := self.pool.Ping(ctx)
+		err := self.pool.Load().Ping(ctx)
 		if err != nil {
 			return ErrDatabaseUnhealthy.Raise().Cause(err)
 		}
 
+		if self.replica != nil {
+			err = self.replica.Ping(ctx)
+			if err != nil {
+				return ErrDatabaseUnhealthy.Raise().With("replica").Cause(err)
+			}
+		}
+
 		err = ctx.Err()
 		if err != nil {
 			return ErrDatabaseUnhealthy.Raise().Cause(err)
@@ -228,12 +549,19 @@ func _dbErrToError(err error) *errors.Error {
 		return nil
 	}
 
+	// Context deadlines (e.g. set by the timeout middleware) and cancellations cancel in-flight queries
+	if err == context.DeadlineExceeded || err == context.Canceled || pgconn.Timeout(err) {
+		return ErrDatabaseTimedOut.Raise().Skip(2).Cause(err)
+	}
+
 	if code := _DATABASE_ERR_PGCODE.FindStringSubmatch(err.Error()); len(code) == 2 {
 		switch code[1] {
 		case pgerrcode.IntegrityConstraintViolation, pgerrcode.RestrictViolation, pgerrcode.NotNullViolation,
 			pgerrcode.ForeignKeyViolation, pgerrcode.UniqueViolation, pgerrcode.CheckViolation,
 			pgerrcode.ExclusionViolation:
 			return ErrDatabaseIntegrityViolation.Raise().Skip(2).Cause(err)
+		case pgerrcode.SerializationFailure, pgerrcode.DeadlockDetected:
+			return ErrDatabaseSerialization.Raise().Skip(2).Cause(err)
 		}
 	}
 
@@ -245,6 +573,83 @@ func _dbErrToError(err error) *errors.Error {
 	}
 }
 
+// _dbIsConnectionFailure also accounts the server errors meaning that it cannot serve any connection.
+func _dbIsConnectionFailure(err error) bool {
+	if _isConnectionFailure(err) {
+		return true
+	}
+
+	for cause := err; cause != nil; cause = util.Unwrap(cause) {
+		if pgErr, ok := cause.(*pgconn.PgError); ok { // nolint:errorlint
+			return pgerrcode.IsConnectionException(pgErr.Code) || pgErr.Code == pgerrcode.TooManyConnections ||
+				pgErr.Code == pgerrcode.AdminShutdown || pgErr.Code == pgerrcode.CrashShutdown ||
+				pgErr.Code == pgerrcode.CannotConnectNow
+		}
+	}
+
+	return false
+}
+
+// protect runs fn through the circuit breaker, if enabled, only accounting connection failures
+// and not the query outcome, input nor caller cancellation and deadline errors.
+func (self *Database) protect(fn func() error) error {
+	if self.breaker == nil {
+		return fn()
+	}
+
+	var err error
+
+	errB := self.breaker.Run(func() error {
+		err = fn()
+		if !_dbIsConnectionFailure(err) {
+			return nil
+		}
+
+		return err
+	})
+	if util.ErrCircuitBreakerOpen.Is(errB) {
+		return ErrDatabaseUnavailable.Raise().Skip(1).Cause(errB)
+	}
+
+	return err
+}
+
+// acquire waits for a free connection of the pool for at most the acquire timeout, so that an exhausted
+// pool fails with ErrDatabaseTimedOut instead of blocking until the statement or caller deadline.
+func (self *Database) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	return self.acquireFrom(ctx, self.pool.Load())
+}
+
+func (self *Database) acquireRead(ctx context.Context) (*pgxpool.Conn, error) {
+	return self.acquireFrom(ctx, self.readPool(ctx))
+}
+
+// readPool returns the replica, if any, unless the reads of ctx must be served by the primary.
+func (self *Database) readPool(ctx context.Context) *pgxpool.Pool {
+	if self.replica == nil || Context.PrimaryRead(ctx) {
+		return self.pool.Load()
+	}
+
+	return self.replica
+}
+
+func (self *Database) acquireFrom(ctx context.Context, pool *pgxpool.Pool) (*pgxpool.Conn, error) {
+	acquireCtx, cancel := context.WithTimeout(ctx, *self.config.AcquireTimeout)
+	defer cancel()
+
+	conn, err := pool.Acquire(acquireCtx)
+	if err != nil {
+		if acquireCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return nil, ErrDatabaseTimedOut.Raise().
+				With("cannot acquire a connection within %s", *self.config.AcquireTimeout).Cause(err)
+		}
+
+		return nil, _dbErrToError(err)
+	}
+
+	return conn, nil
+}
+
 func (self *Database) Query(ctx context.Context, stmt *sqlf.Stmt) error {
 	defer stmt.Close()
 
@@ -255,36 +660,257 @@ func (self *Database) Query(ctx context.Context, stmt *sqlf.Stmt) error {
 	ctx, endTraceQuery := self.observer.TraceQuery(ctx, sql, args...)
 	defer endTraceQuery()
 
-	var rows pgx.Rows
-	var err error
+	return self.protect(func() error {
+		var rows pgx.Rows
+		var err error
+
+		if transaction, ok := _databaseTransaction(ctx); ok {
+			rows, err = transaction.Query(ctx, sql, args...)
+		} else {
+			conn, errA := self.acquireRead(ctx)
+			if errA != nil {
+				return errA
+			}
+			defer conn.Release()
+
+			rows, err = conn.Query(ctx, sql, args...)
+		}
 
-	if ctx.Value(KeyDatabaseTransaction) != nil {
-		rows, err = ctx.Value(KeyDatabaseTransaction).(pgx.Tx).Query(ctx, sql, args...)
-	} else {
-		rows, err = self.pool.Query(ctx, sql, args...)
+		if rows != nil {
+			defer rows.Close()
+		}
+
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		scratch := _databaseScratch(dest)
+
+		err = pgxscan.NewScanner(rows).Scan(scratch...)
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		err = ctx.Err()
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		_databaseCommit(dest, scratch)
+
+		return nil
+	})
+}
+
+// _databaseQueryKey hashes the SQL and the type and value of each arg so that equal statements
+// share the same key regardless of the args formatting and different ones never collide.
+func _databaseQueryKey(stmt *sqlf.Stmt) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(stmt.String()))
+
+	for _, arg := range stmt.Args() {
+		data, err := json.Marshal(arg)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(hash, "\x00%T\x00%s", arg, data)
 	}
 
-	if rows != nil {
-		defer rows.Close()
+	return fmt.Sprintf(_DATABASE_QUERY_CACHE_KEY, hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// QueryCached runs stmt into dest, a pointer such as to a struct or a slice of structs, caching the scanned
+// result for ttl in the configured query cache, keyed by a hash of the SQL and its args. Cached results are
+// decoded into dest with the cache codec, so dest has to round-trip through it, as with Cache.Set. Cache
+// failures fall back to the database and queries within a transaction bypass the cache as they can see
+// uncommitted rows.
+func (self *Database) QueryCached(ctx context.Context, stmt *sqlf.Stmt, dest any, ttl *time.Duration) error {
+	if self.config.QueryCache == nil {
+		stmt.Close()
+		return ErrDatabaseGeneric.Raise().With("database config query cache is not set")
 	}
 
-	if err != nil {
-		return _dbErrToError(err)
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		stmt.Close()
+		return ErrDatabaseGeneric.Raise().With("query cached dest %T is not a non-nil pointer", dest)
 	}
 
-	err = ctx.Err()
+	if self.InTransaction(ctx) {
+		return self.Query(ctx, stmt.To(dest))
+	}
+
+	key, err := _databaseQueryKey(stmt)
 	if err != nil {
-		return _dbErrToError(err)
+		self.observer.Warnf(ctx, "Cannot cache query with args %v: %v", stmt.Args(), err)
+		return self.Query(ctx, stmt.To(dest))
+	}
+
+	found, err := self.config.QueryCache.TryGet(ctx, key, dest)
+	if err == nil && found {
+		stmt.Close()
+		return nil
 	}
 
-	err = pgxscan.NewScanner(rows).Scan(dest...)
+	// Scan into a zeroed dest, as pgx would, in case it was partially decoded from the cache
+	value.Elem().SetZero()
+
+	err = self.Query(ctx, stmt.To(dest))
 	if err != nil {
-		return _dbErrToError(err)
+		return err
 	}
 
+	// Populating the cache is best effort, the next read will try again
+	_ = self.config.QueryCache.Set(ctx, key, dest, ttl)
+
 	return nil
 }
 
+// _databaseScratch returns shallow copies of dest to scan into so that a scan interrupted, for example by a
+// cancellation, never leaks a partially populated dest to the caller. They are copied back with _databaseCommit.
+func _databaseScratch(dest []any) []any {
+	scratch := make([]any, len(dest))
+
+	for i := range dest {
+		value := reflect.ValueOf(dest[i])
+		if value.Kind() != reflect.Pointer || value.IsNil() {
+			scratch[i] = dest[i]
+			continue
+		}
+
+		copied := reflect.New(value.Elem().Type())
+		copied.Elem().Set(value.Elem())
+		scratch[i] = copied.Interface()
+	}
+
+	return scratch
+}
+
+func _databaseCommit(dest []any, scratch []any) {
+	for i := range dest {
+		value := reflect.ValueOf(dest[i])
+		if value.Kind() == reflect.Pointer && !value.IsNil() {
+			value.Elem().Set(reflect.ValueOf(scratch[i]).Elem())
+		}
+	}
+}
+
+// _databaseSingleRow stops the iteration after the first row, reporting whether the result set had more.
+type _databaseSingleRow struct {
+	pgx.Rows
+	found    bool
+	multiple bool
+}
+
+func (self *_databaseSingleRow) Next() bool {
+	if self.found {
+		self.multiple = self.multiple || self.Rows.Next()
+		return false
+	}
+
+	self.found = self.Rows.Next()
+
+	return self.found
+}
+
+// QueryRow scans exactly one row into dest, or into the statement destinations when dest is empty.
+// It fails with ErrDatabaseNoRows when there are no rows and with ErrDatabaseMultipleRows when there are more.
+func (self *Database) QueryRow(ctx context.Context, stmt *sqlf.Stmt, dest ...any) error {
+	defer stmt.Close()
+
+	sql := stmt.String()
+	args := stmt.Args()
+	if len(dest) == 0 {
+		dest = stmt.Dest()
+	}
+
+	ctx, endTraceQuery := self.observer.TraceQuery(ctx, sql, args...)
+	defer endTraceQuery()
+
+	return self.protect(func() error {
+		var rows pgx.Rows
+		var err error
+
+		if transaction, ok := _databaseTransaction(ctx); ok {
+			rows, err = transaction.Query(ctx, sql, args...)
+		} else {
+			conn, errA := self.acquireRead(ctx)
+			if errA != nil {
+				return errA
+			}
+			defer conn.Release()
+
+			rows, err = conn.Query(ctx, sql, args...)
+		}
+
+		if rows != nil {
+			defer rows.Close()
+		}
+
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		row := &_databaseSingleRow{Rows: rows}
+		scratch := _databaseScratch(dest)
+
+		err = pgxscan.NewScanner(row).Scan(scratch...)
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		err = ctx.Err()
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		if !row.found {
+			return ErrDatabaseNoRows.Raise()
+		}
+
+		if row.multiple {
+			return ErrDatabaseMultipleRows.Raise()
+		}
+
+		_databaseCommit(dest, scratch)
+
+		return nil
+	})
+}
+
+// _databaseWrap returns a new statement embedding the SQL of stmt in the format, keeping its args.
+// The SQL of stmt is already rendered with its placeholders numbered, which the format must not add to.
+func _databaseWrap(format string, stmt *sqlf.Stmt) *sqlf.Stmt {
+	defer stmt.Close()
+
+	return sqlf.New(fmt.Sprintf(format, stmt.String()), stmt.Args()...)
+}
+
+// Count returns the number of rows returned by stmt, which can be any select, or 0 when there are none.
+func (self *Database) Count(ctx context.Context, stmt *sqlf.Stmt) (int64, error) {
+	var count int64
+
+	err := self.QueryRow(ctx, _databaseWrap("SELECT count(*) FROM (%s) AS \"count\"", stmt), &count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Exists reports whether stmt, which can be any select, returns any row, stopping at the first one.
+func (self *Database) Exists(ctx context.Context, stmt *sqlf.Stmt) (bool, error) {
+	var exists bool
+
+	err := self.QueryRow(ctx, _databaseWrap("SELECT EXISTS(%s)", stmt), &exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
 func (self *Database) Exec(ctx context.Context, stmt *sqlf.Stmt) (int, error) {
 	defer stmt.Close()
 
@@ -295,33 +921,265 @@ func (self *Database) Exec(ctx context.Context, stmt *sqlf.Stmt) (int, error) {
 	defer endTraceQuery()
 
 	var command pgconn.CommandTag
-	var err error
 
-	if ctx.Value(KeyDatabaseTransaction) != nil {
-		command, err = ctx.Value(KeyDatabaseTransaction).(pgx.Tx).Exec(ctx, sql, args...)
-	} else {
-		command, err = self.pool.Exec(ctx, sql, args...)
-	}
+	err := self.protect(func() error {
+		var err error
+
+		if transaction, ok := _databaseTransaction(ctx); ok {
+			command, err = transaction.Exec(ctx, sql, args...)
+		} else {
+			conn, errA := self.acquire(ctx)
+			if errA != nil {
+				return errA
+			}
+			defer conn.Release()
+
+			command, err = conn.Exec(ctx, sql, args...)
+		}
+
+		// A cancellation during the statement already fails it, while a later one must not
+		// report a statement that has completed, and maybe committed, as failed
+		if err != nil {
+			return _dbErrToError(err)
+		}
 
+		return nil
+	})
 	if err != nil {
-		return 0, _dbErrToError(err)
+		return 0, err
 	}
 
-	err = ctx.Err()
+	return int(command.RowsAffected()), nil
+}
+
+// ExecUnbounded runs stmt, such as maintenance that legitimately exceeds the statement timeout, on a pinned
+// connection whose statement timeout is disabled for its duration only. It cannot run within a transaction.
+func (self *Database) ExecUnbounded(ctx context.Context, stmt *sqlf.Stmt) (int, error) {
+	defer stmt.Close()
+
+	if self.InTransaction(ctx) {
+		return 0, ErrDatabaseGeneric.Raise().With("cannot exec unbounded within a transaction")
+	}
+
+	sql := stmt.String()
+	args := stmt.Args()
+
+	ctx, endTraceQuery := self.observer.TraceQuery(ctx, sql, args...)
+	defer endTraceQuery()
+
+	var command pgconn.CommandTag
+
+	err := self.protect(func() error {
+		conn, err := self.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
+
+		_, err = conn.Exec(ctx, "SET statement_timeout = 0")
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		defer func() {
+			// Never give the connection back to the pool without its statement timeout
+			_, err := conn.Exec(context.WithoutCancel(ctx), "RESET statement_timeout")
+			if err != nil {
+				self.observer.Error(ctx, _dbErrToError(err))
+				_ = conn.Conn().Close(context.WithoutCancel(ctx))
+			}
+		}()
+
+		command, err = conn.Exec(ctx, sql, args...)
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return 0, _dbErrToError(err)
+		return 0, err
 	}
 
 	return int(command.RowsAffected()), nil
 }
 
+// Listen subscribes to the Postgres NOTIFY channel, calling handler with the payload of each notification
+// until ctx is done, which returns nil. It holds a pinned connection of the pool for its whole duration,
+// closed afterwards instead of released so that the LISTEN does not leak to other callers.
+// Notifications sent while not listening, for example after a connection failure, are lost.
+func (self *Database) Listen(ctx context.Context, channel string, handler func(payload string)) error {
+	conn, err := self.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = conn.Conn().Close(context.WithoutCancel(ctx))
+		conn.Release()
+	}()
+
+	_, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize())
+	if err != nil {
+		return _dbErrToError(err)
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return _dbErrToError(err)
+		}
+
+		handler(notification.Payload)
+	}
+}
+
+// Upsert inserts the rows, each one holding the values of the columns in order, updating the given columns
+// of the rows that conflict on the conflict columns or skipping them when update is empty. The table, which
+// can be qualified with its schema, and the columns are quoted, so they must be written as in the database.
+// Large row sets are split into several statements, within a transaction, to stay under the Postgres parameter
+// limit.
+func (self *Database) Upsert(ctx context.Context, table string, columns []string, rows [][]any,
+	conflict []string, update []string) (int, error) {
+	if table == "" || len(columns) == 0 || len(conflict) == 0 {
+		return 0, ErrDatabaseGeneric.Raise().
+			With("cannot upsert into %s with columns %v and conflict %v", table, columns, conflict)
+	}
+
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return 0, ErrDatabaseGeneric.Raise().
+				With("cannot upsert into %s row %d with %d values for %d columns", table, i, len(row), len(columns))
+		}
+	}
+
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	quotedColumns, err := _dbIdentifiers(columns)
+	if err != nil {
+		return 0, ErrDatabaseGeneric.Raise().With("cannot upsert into %s columns %v", table, columns).Cause(err)
+	}
+
+	quotedConflict, err := _dbIdentifiers(conflict)
+	if err != nil {
+		return 0, ErrDatabaseGeneric.Raise().With("cannot upsert into %s conflict %v", table, conflict).Cause(err)
+	}
+
+	quotedUpdate, err := _dbIdentifiers(update)
+	if err != nil {
+		return 0, ErrDatabaseGeneric.Raise().With("cannot upsert into %s update %v", table, update).Cause(err)
+	}
+
+	onConflict := fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(quotedConflict, ", "))
+
+	if len(quotedUpdate) > 0 {
+		sets := make([]string, 0, len(quotedUpdate))
+		for _, column := range quotedUpdate {
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+		}
+
+		onConflict = fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s",
+			strings.Join(quotedConflict, ", "), strings.Join(sets, ", "))
+	}
+
+	table = _dbIdentifier(table)
+
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	chunks := util.ChunkByParams(len(rows), len(columns))
+
+	upsert := func(ctx context.Context, rows [][]any) (int, error) {
+		values := make([]string, 0, len(rows))
+		args := make([]any, 0, len(rows)*len(columns))
+
+		for _, row := range rows {
+			values = append(values, placeholders)
+			args = append(args, row...)
+		}
+
+		return self.Exec(ctx, sqlf.New(fmt.Sprintf("INSERT INTO %s (%s) VALUES %s %s",
+			table, strings.Join(quotedColumns, ", "), strings.Join(values, ", "), onConflict), args...))
+	}
+
+	if len(chunks) == 1 {
+		return upsert(ctx, rows)
+	}
+
+	affected := 0
+
+	err = self.Transaction(ctx, nil, func(ctx context.Context) error {
+		for _, chunk := range chunks {
+			chunkAffected, err := upsert(ctx, rows[chunk[0]:chunk[1]])
+			if err != nil {
+				return err
+			}
+
+			affected += chunkAffected
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+// _dbIdentifier quotes the name, which can be qualified with its schema, as an SQL identifier.
+func _dbIdentifier(name string) string {
+	return pgx.Identifier(strings.Split(name, ".")).Sanitize()
+}
+
+// _dbIdentifiers quotes the names, which cannot be qualified, as SQL identifiers.
+func _dbIdentifiers(names []string) ([]string, error) {
+	quoted := make([]string, 0, len(names))
+
+	for _, name := range names {
+		if name == "" {
+			return nil, ErrDatabaseGeneric.Raise().With("identifier is empty")
+		}
+
+		quoted = append(quoted, pgx.Identifier{name}.Sanitize())
+	}
+
+	return quoted, nil
+}
+
+// WithPrimaryRead forces the reads within ctx to be served by the primary, for the read-after-write paths
+// that cannot tolerate the replication lag of the read replica configured with DatabaseConfig.ReplicaHost.
+func WithPrimaryRead(ctx context.Context) context.Context {
+	return Context.WithPrimaryRead(ctx)
+}
+
+func IsPrimaryRead(ctx context.Context) bool {
+	return Context.PrimaryRead(ctx)
+}
+
+// _databaseTransaction returns the transaction of the context, if any.
+func _databaseTransaction(ctx context.Context) (pgx.Tx, bool) {
+	return Context.Transaction(ctx)
+}
+
+// InTransaction reports whether ctx is within a Transaction, in which case
+// statements and nested Transaction calls join the ongoing transaction.
+func (self *Database) InTransaction(ctx context.Context) bool {
+	_, ok := _databaseTransaction(ctx)
+	return ok
+}
+
 func (self *Database) Transaction(
 	ctx context.Context, level *IsolationLevel, fn func(ctx context.Context) error) error {
 	if level == nil {
 		level = self.config.DefaultIsolationLevel
 	}
 
-	if ctx.Value(KeyDatabaseTransaction) != nil {
+	if self.InTransaction(ctx) {
 		err := fn(ctx)
 		if err != nil {
 			// Wait to rollback context transaction at the original Transaction call
@@ -331,7 +1189,48 @@ func (self *Database) Transaction(
 		return nil
 	}
 
-	transaction, err := self.pool.BeginTx(ctx, pgx.TxOptions{
+	if self.config.TransactionRetry == nil {
+		return self.transaction(Context.WithTransactionAttempt(ctx, 1), level, fn)
+	}
+
+	retry := *self.config.TransactionRetry
+	if len(retry.Retriables) == 0 {
+		retry.Retriables = []error{ErrDatabaseSerialization}
+	}
+
+	return util.BudgetedExponentialRetry(
+		ctx, retry.Attempts, retry.InitialDelay, retry.LimitDelay, retry.Jitter, retry.MaxElapsed,
+		retry.Retriables, func(attempt int) error {
+			err := self.transaction(Context.WithTransactionAttempt(ctx, attempt), level, fn)
+			if err != nil && attempt < retry.Attempts && util.Is(err, retry.Retriables...) {
+				self.observer.Warnf(ctx, "Retrying transaction %d/%d after SQLSTATE %s",
+					attempt+1, retry.Attempts, _dbSQLState(err))
+			}
+
+			return err
+		})
+}
+
+// _dbSQLState returns the SQLSTATE of the Postgres error in the chain of err, if any.
+func _dbSQLState(err error) string {
+	for cause := err; cause != nil; cause = util.Unwrap(cause) {
+		if pgErr, ok := cause.(*pgconn.PgError); ok { // nolint:errorlint
+			return pgErr.Code
+		}
+	}
+
+	return "unknown"
+}
+
+func (self *Database) transaction(
+	ctx context.Context, level *IsolationLevel, fn func(ctx context.Context) error) error {
+	conn, err := self.acquire(ctx)
+	if err != nil {
+		return ErrDatabaseTransactionFailed.Raise().Cause(err)
+	}
+	defer conn.Release()
+
+	transaction, err := conn.BeginTx(ctx, pgx.TxOptions{
 		IsoLevel:   _KisoLevelToPisoLevel[*level],
 		AccessMode: pgx.ReadWrite,
 	})
@@ -361,7 +1260,7 @@ func (self *Database) Transaction(
 		}
 	}()
 
-	err = fn(context.WithValue(ctx, KeyDatabaseTransaction, transaction))
+	err = fn(Context.WithTransaction(ctx, transaction))
 	if err != nil {
 		errT := transaction.Rollback(ctx)
 		return ErrDatabaseTransactionFailed.Raise().Extra(map[string]any{"transaction_error": errT}).Cause(err)
@@ -376,7 +1275,9 @@ func (self *Database) Transaction(
 	err = transaction.Commit(ctx)
 	if err != nil {
 		errT := transaction.Rollback(ctx)
-		return ErrDatabaseTransactionFailed.Raise().Extra(map[string]any{"transaction_error": errT}).Cause(err)
+		// Serializable transactions can also fail with a serialization failure at commit
+		return ErrDatabaseTransactionFailed.Raise().Extra(map[string]any{"transaction_error": errT}).
+			Cause(_dbErrToError(err))
 	}
 
 	err = ctx.Err()
@@ -388,11 +1289,169 @@ func (self *Database) Transaction(
 	return nil
 }
 
+// DeferConstraints defers the checks of all the deferrable constraints until the commit of the transaction
+// of ctx, for example to insert rows with circular foreign keys. It fails outside a Transaction.
+func (self *Database) DeferConstraints(ctx context.Context) error {
+	if !self.InTransaction(ctx) {
+		return ErrDatabaseGeneric.Raise().With("cannot defer constraints outside a transaction")
+	}
+
+	_, err := self.Exec(ctx, sqlf.New("SET CONSTRAINTS ALL DEFERRED"))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Any matches column against any of the values passed as a single array parameter, to be spread into a clause
+// such as stmt.Where(expr, args...). Unlike In, the statement is the same whatever the number of values.
+// Arrays, like []string, []int64 or []uuid.UUID, are written and scanned as is, and so are the arrays
+// of enum types once registered through DatabaseConfig.EnumTypes, which are scanned into []string.
+func Any[T any](column string, values []T) (string, []any) {
+	if values == nil {
+		values = []T{}
+	}
+
+	return column + " = ANY(?)", []any{values}
+}
+
+// In expands values into an IN predicate over column with one positional parameter per value,
+// to be spread into a clause such as stmt.Where(expr, args...). An empty slice yields
+// a constant false predicate as "IN ()" is not valid SQL.
+func In[T any](column string, values []T) (string, []any) {
+	if len(values) == 0 {
+		return "FALSE", nil
+	}
+
+	args := make([]any, 0, len(values))
+	for _, value := range values {
+		args = append(args, value)
+	}
+
+	return column + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ") + ")", args
+}
+
+type PageOrder string
+
+var (
+	PageOrderAsc  PageOrder = "ASC"
+	PageOrderDesc PageOrder = "DESC"
+)
+
+// PageRequest Columns is the sort key of the pagination, which as a whole must be unique, for example
+// created_at and id. Cursor is the opaque token of the previous page, nil for the first page.
+type PageRequest struct {
+	Columns []string
+	Order   PageOrder
+	Cursor  *string
+	Limit   int
+}
+
+// Page Next is the opaque token to fetch the following page, nil when this is the last one.
+type Page[T any] struct {
+	Items []T
+	Next  *string
+}
+
+// Paginate runs stmt with keyset pagination, scanning the rows into a slice of T. The statement must not be
+// ordered nor limited and key must return the values of the request columns for an item, in the same order.
+func Paginate[T any](ctx context.Context, database Querier, stmt *sqlf.Stmt,
+	request PageRequest, key func(item T) []any) (*Page[T], error) {
+	if len(request.Columns) == 0 || request.Limit < 1 {
+		stmt.Close()
+		return nil, ErrDatabaseGeneric.Raise().
+			With("page request needs columns and a positive limit, got %v and %d", request.Columns, request.Limit)
+	}
+
+	order := PageOrderAsc
+	comparator := ">"
+	if request.Order == PageOrderDesc {
+		order = PageOrderDesc
+		comparator = "<"
+	}
+
+	if request.Cursor != nil {
+		values, err := _decodePageCursor(*request.Cursor)
+		if err != nil || len(values) != len(request.Columns) {
+			stmt.Close()
+			return nil, ErrDatabaseInvalidCursor.Raise().Cause(err)
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		stmt.Where(fmt.Sprintf("(%s) %s (%s)", strings.Join(request.Columns, ", "), comparator, placeholders), values...)
+	}
+
+	for _, column := range request.Columns {
+		stmt.OrderBy(column + " " + string(order))
+	}
+
+	items := []T{}
+
+	err := database.Query(ctx, stmt.Limit(request.Limit+1).To(&items))
+	if err != nil && !ErrDatabaseNoRows.Is(err) {
+		return nil, err
+	}
+
+	page := &Page[T]{
+		Items: items,
+		Next:  nil,
+	}
+
+	if len(items) > request.Limit {
+		page.Items = items[:request.Limit]
+
+		cursor, err := _encodePageCursor(key(page.Items[request.Limit-1]))
+		if err != nil {
+			return nil, err
+		}
+
+		page.Next = &cursor
+	}
+
+	return page, nil
+}
+
+// Cursors are encoded with MessagePack rather than JSON in order to keep the types of the sort key values.
+func _encodePageCursor(values []any) (string, error) {
+	data, err := msgpack.Marshal(values)
+	if err != nil {
+		return "", ErrDatabaseGeneric.Raise().Cause(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func _decodePageCursor(cursor string) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []any
+
+	err = msgpack.Unmarshal(data, &values)
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
 func (self *Database) Close(ctx context.Context) error {
 	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
 		self.observer.Infof(ctx, "Closing %s database", self.config.Database)
 
-		self.pool.Close()
+		if self.stopWatch != nil {
+			self.stopWatch()
+			<-self.watched
+		}
+
+		self.pool.Load().Close()
+
+		if self.replica != nil {
+			self.replica.Close()
+		}
 
 		self.observer.Infof(ctx, "Closed %s database", self.config.Database)
 
@@ -0,0 +1,145 @@
+package kit
+
+import (
+	"context"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/randallmlough/pgxscan"
+)
+
+// _databasePreparer is implemented by both the transactions and the connections of the pool.
+type _databasePreparer interface {
+	Prepare(ctx context.Context, name string, sql string) (*pgconn.StatementDescription, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// PreparedStmt is a named statement that is parsed and planned once per connection instead of on every call.
+// It is meant for advanced use on a handful of extremely hot queries, as pgx already caches the statements
+// built with sqlf per connection, which is what most callers should stick with.
+type PreparedStmt struct {
+	database *Database
+	name     string
+	sql      string
+}
+
+// Prepare returns the statement named name, which must be unique per sql, preparing it on one connection so that
+// invalid SQL fails right away. Connections prepare it lazily on their first use, including the ones opened after
+// a connection is recycled or the pool is rebuilt, as prepared statements are per connection in Postgres.
+func (self *Database) Prepare(ctx context.Context, name string, sql string) (*PreparedStmt, error) {
+	prepared, loaded := self.prepared.LoadOrStore(name, sql)
+	if loaded && prepared.(string) != sql {
+		return nil, ErrDatabaseGeneric.Raise().With("prepared statement %s already exists with another sql", name)
+	}
+
+	stmt := &PreparedStmt{
+		database: self,
+		name:     name,
+		sql:      sql,
+	}
+
+	err := stmt.run(ctx, func(conn _databasePreparer) error {
+		return nil
+	})
+	if err != nil {
+		// Only the call that registered the statement unregisters it, and only while it is still its own
+		if !loaded {
+			self.prepared.CompareAndDelete(name, sql)
+		}
+
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// run prepares the statement, if it is not yet, on the connection of the transaction in ctx or on a connection
+// of the pool, and calls fn with it. Preparing an already prepared statement does not hit the database.
+func (self *PreparedStmt) run(ctx context.Context, fn func(conn _databasePreparer) error) error {
+	return self.database.protect(func() error {
+		var conn _databasePreparer
+
+		if transaction, ok := _databaseTransaction(ctx); ok {
+			conn = transaction
+		} else {
+			poolConn, err := self.database.acquire(ctx)
+			if err != nil {
+				return err
+			}
+			defer poolConn.Release()
+
+			conn = poolConn.Conn()
+		}
+
+		_, err := conn.Prepare(ctx, self.name, self.sql)
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		return fn(conn)
+	})
+}
+
+// Query runs the statement with args and scans the rows into dest as Database.Query does.
+func (self *PreparedStmt) Query(ctx context.Context, dest any, args ...any) error {
+	ctx, endTraceQuery := self.database.observer.TraceQuery(ctx, self.sql, args...)
+	defer endTraceQuery()
+
+	scratch := _databaseScratch([]any{dest})
+
+	err := self.run(ctx, func(conn _databasePreparer) error {
+		// pgx runs the prepared statement when it is given its name instead of the SQL
+		rows, err := conn.Query(ctx, self.name, args...)
+		if rows != nil {
+			defer rows.Close()
+		}
+
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		err = pgxscan.NewScanner(rows).Scan(scratch...)
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		err = ctx.Err()
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_databaseCommit([]any{dest}, scratch)
+
+	return nil
+}
+
+// Exec runs the statement with args and returns the number of affected rows.
+func (self *PreparedStmt) Exec(ctx context.Context, args ...any) (int, error) {
+	ctx, endTraceQuery := self.database.observer.TraceQuery(ctx, self.sql, args...)
+	defer endTraceQuery()
+
+	var command pgconn.CommandTag
+
+	err := self.run(ctx, func(conn _databasePreparer) error {
+		var err error
+
+		command, err = conn.Exec(ctx, self.name, args...)
+		if err != nil {
+			return _dbErrToError(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(command.RowsAffected()), nil
+}
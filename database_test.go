@@ -0,0 +1,556 @@
+package kit
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/leporo/sqlf"
+
+	"github.com/neoxelox/kit/util"
+)
+
+func assertIn(t *testing.T, expr string, args []any, sql string, expected []any) {
+	t.Helper()
+
+	stmt := sqlf.PostgreSQL.Select("id").From("users").Where(expr, args...)
+	defer stmt.Close()
+
+	if stmt.String() != sql {
+		t.Fatalf("expected sql %q, got %q", sql, stmt.String())
+	}
+
+	if !reflect.DeepEqual(stmt.Args(), expected) {
+		t.Fatalf("expected args %v, got %v", expected, stmt.Args())
+	}
+}
+
+func TestInInt(t *testing.T) {
+	expr, args := In("id", []int{1, 2, 3})
+
+	assertIn(t, expr, args, "SELECT id FROM users WHERE id IN ($1, $2, $3)", []any{1, 2, 3})
+}
+
+func TestInString(t *testing.T) {
+	expr, args := In("name", []string{"alice"})
+
+	assertIn(t, expr, args, "SELECT id FROM users WHERE name IN ($1)", []any{"alice"})
+}
+
+func TestInUUID(t *testing.T) {
+	first := uuid.New()
+	second := uuid.New()
+
+	expr, args := In("id", []uuid.UUID{first, second})
+
+	assertIn(t, expr, args, "SELECT id FROM users WHERE id IN ($1, $2)", []any{first, second})
+}
+
+func TestInEmpty(t *testing.T) {
+	expr, args := In("id", []int{})
+
+	assertIn(t, expr, args, "SELECT id FROM users WHERE FALSE", []any{})
+}
+
+func TestDeferConstraintsOutsideTransaction(t *testing.T) {
+	err := (&Database{}).DeferConstraints(context.Background())
+
+	if !ErrDatabaseGeneric.Is(err) {
+		t.Fatalf("expected generic error outside a transaction, got %v", err)
+	}
+}
+
+// newTestDatabase connects to the Postgres instance of the KIT_TEST_DATABASE_* environment
+// variables with the rest of the config, skipping the test when there is none.
+func newTestDatabase(t *testing.T, config DatabaseConfig) *Database {
+	t.Helper()
+
+	host := util.GetEnv("KIT_TEST_DATABASE_HOST", "")
+	if host == "" {
+		t.Skip("KIT_TEST_DATABASE_HOST is not set")
+	}
+
+	ctx := context.Background()
+
+	observer, err := NewObserver(ctx, ObserverConfig{
+		Environment: EnvIntegration,
+		Service:     "kit",
+		Level:       LvlNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.Host = host
+	config.Port = util.GetEnv("KIT_TEST_DATABASE_PORT", 5432)
+	config.SSLMode = util.GetEnv("KIT_TEST_DATABASE_SSLMODE", "disable")
+	config.User = util.GetEnv("KIT_TEST_DATABASE_USER", "postgres")
+	config.Password = util.GetEnv("KIT_TEST_DATABASE_PASSWORD", "postgres")
+	config.Database = util.GetEnv("KIT_TEST_DATABASE_NAME", "postgres")
+	config.Service = "kit"
+
+	database, err := NewDatabase(ctx, observer, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		database.Close(ctx) // nolint:errcheck
+	})
+
+	return database
+}
+
+func TestDeferConstraintsSelfReferential(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t, DatabaseConfig{})
+
+	_, err := database.Exec(ctx, sqlf.New(`CREATE TABLE kit_defer_node (
+		id INT PRIMARY KEY,
+		parent_id INT NOT NULL REFERENCES kit_defer_node (id) DEFERRABLE INITIALLY IMMEDIATE)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Exec(ctx, sqlf.New("DROP TABLE kit_defer_node")) // nolint:errcheck
+
+	// Each row references the other so the first insert violates the foreign key until the second one
+	insert := func(ctx context.Context) error {
+		_, err := database.Exec(ctx, sqlf.New("INSERT INTO kit_defer_node (id, parent_id) VALUES (1, 2)"))
+		if err != nil {
+			return err
+		}
+
+		_, err = database.Exec(ctx, sqlf.New("INSERT INTO kit_defer_node (id, parent_id) VALUES (2, 1)"))
+
+		return err
+	}
+
+	err = database.Transaction(ctx, nil, insert)
+	if !util.Is(err, ErrDatabaseIntegrityViolation) {
+		t.Fatalf("expected integrity violation without deferred constraints, got %v", err)
+	}
+
+	err = database.Transaction(ctx, nil, func(ctx context.Context) error {
+		err := database.DeferConstraints(ctx)
+		if err != nil {
+			return err
+		}
+
+		return insert(ctx)
+	})
+	if err != nil {
+		t.Fatalf("expected circular rows to commit with deferred constraints, got %v", err)
+	}
+}
+
+func TestAny(t *testing.T) {
+	ids := []uuid.UUID{uuid.MustParse("a3bb189e-8bf9-3888-9912-ace4e6543002")}
+	expr, args := Any("id", ids)
+
+	assertIn(t, expr, args, "SELECT id FROM users WHERE id = ANY($1)", []any{ids})
+
+	expr, args = Any[int64]("id", nil)
+
+	assertIn(t, expr, args, "SELECT id FROM users WHERE id = ANY($1)", []any{[]int64{}})
+}
+
+func TestArrayRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t, DatabaseConfig{})
+
+	_, err := database.Exec(ctx, sqlf.New("CREATE TYPE kit_array_color AS ENUM ('red', 'green')"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Exec(ctx, sqlf.New("DROP TYPE kit_array_color")) // nolint:errcheck
+
+	_, err = database.Exec(ctx, sqlf.New(`CREATE TABLE kit_array (
+		id BIGINT, names TEXT[], numbers BIGINT[], ids UUID[], colors kit_array_color[])`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Exec(ctx, sqlf.New("DROP TABLE kit_array")) // nolint:errcheck
+
+	// Enum types must exist before connecting to be registered
+	database = newTestDatabase(t, DatabaseConfig{EnumTypes: []string{"kit_array_color"}})
+
+	type row struct {
+		ID      int64       `db:"id"`
+		Names   []string    `db:"names"`
+		Numbers []int64     `db:"numbers"`
+		IDs     []uuid.UUID `db:"ids"`
+		Colors  []string    `db:"colors"`
+	}
+
+	expected := row{
+		ID:      1,
+		Names:   []string{"a", "b"},
+		Numbers: []int64{1, 2},
+		IDs:     []uuid.UUID{uuid.New(), uuid.New()},
+		Colors:  []string{"red", "green"},
+	}
+
+	_, err = database.Exec(ctx, sqlf.InsertInto("kit_array").
+		Set("id", expected.ID).
+		Set("names", expected.Names).
+		Set("numbers", expected.Numbers).
+		Set("ids", expected.IDs).
+		SetExpr("colors", "?::kit_array_color[]", expected.Colors))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual row
+
+	expr, args := Any("id", []int64{expected.ID})
+
+	err = database.QueryRow(ctx, sqlf.Select("*").From("kit_array").Where(expr, args...), &actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestDatabaseQueryKey(t *testing.T) {
+	key := func(args ...any) string {
+		key, err := _databaseQueryKey(sqlf.From("users").Select("id").Where("id = ? AND name = ?", args...))
+		if err != nil {
+			t.Fatalf("expected query key, got %v", err)
+		}
+
+		return key
+	}
+
+	if key(1, "a") != key(1, "a") {
+		t.Fatalf("expected equal statements to share the key")
+	}
+
+	if key(1, "a") == key(1, "b") || key(1, "a") == key("1", "a") || key(1, "a") == key(int64(1), "a") {
+		t.Fatalf("expected different args or arg types not to share the key")
+	}
+}
+
+func TestDatabaseWrap(t *testing.T) {
+	stmt := _databaseWrap("SELECT EXISTS(%s)",
+		sqlf.PostgreSQL.From("users").Select("id").Where("id = ? AND name = ?", 1, "a"))
+
+	if stmt.String() != "SELECT EXISTS(SELECT id FROM users WHERE id = $1 AND name = $2)" ||
+		!reflect.DeepEqual(stmt.Args(), []any{1, "a"}) {
+		t.Fatalf("expected statement to be wrapped with its args, got %s %v", stmt.String(), stmt.Args())
+	}
+}
+
+func TestCountExists(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t, DatabaseConfig{})
+
+	empty := func() *sqlf.Stmt {
+		return sqlf.New("SELECT i FROM generate_series(1, 0) i")
+	}
+
+	count, err := database.Count(ctx, empty())
+	if err != nil || count != 0 {
+		t.Fatalf("expected 0 rows, got %d %v", count, err)
+	}
+
+	exists, err := database.Exists(ctx, empty())
+	if err != nil || exists {
+		t.Fatalf("expected no rows to exist, got %v %v", exists, err)
+	}
+
+	err = database.Transaction(ctx, nil, func(ctx context.Context) error {
+		stmt := sqlf.From("generate_series(1, 10) i").Select("i").Where("i > ?", 7)
+
+		count, err = database.Count(ctx, stmt)
+		if err != nil || count != 3 {
+			t.Fatalf("expected 3 rows, got %d %v", count, err)
+		}
+
+		exists, err = database.Exists(ctx, sqlf.From("generate_series(1, 10) i").Select("i").Where("i > ?", 7))
+		if err != nil || !exists {
+			t.Fatalf("expected rows to exist, got %v %v", exists, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t, DatabaseConfig{MaxConns: util.Pointer(1)})
+
+	_, err := database.Prepare(ctx, "kit_test_invalid", "SELEC 1")
+	if err == nil {
+		t.Fatalf("expected invalid sql error")
+	}
+
+	stmt, err := database.Prepare(ctx, "kit_test_series", "SELECT i FROM generate_series(1, $1::int) i")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = database.Prepare(ctx, "kit_test_series", "SELECT 1")
+	if err == nil {
+		t.Fatalf("expected already existing prepared statement error")
+	}
+
+	for _, n := range []int{3, 5} {
+		var rows []struct {
+			I int64
+		}
+
+		err = stmt.Query(ctx, &rows, n)
+		if err != nil || len(rows) != n {
+			t.Fatalf("expected %d rows, got %d %v", n, len(rows), err)
+		}
+	}
+
+	err = database.Transaction(ctx, nil, func(ctx context.Context) error {
+		affected, err := stmt.Exec(ctx, 4)
+		if err != nil || affected != 4 {
+			t.Fatalf("expected 4 affected rows, got %d %v", affected, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionRetry(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t, DatabaseConfig{TransactionRetry: &RetryConfig{Attempts: 3}})
+
+	attempts := []int{}
+
+	err := database.Transaction(ctx, nil, func(ctx context.Context) error {
+		attempts = append(attempts, Context.TransactionAttempt(ctx))
+
+		// Nested transactions run within the attempt of the outermost one
+		return database.Transaction(ctx, nil, func(ctx context.Context) error {
+			if Context.TransactionAttempt(ctx) < 2 {
+				return ErrDatabaseSerialization.Raise()
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(attempts, []int{1, 2}) {
+		t.Fatalf("expected the transaction to be retried once, got attempts %v", attempts)
+	}
+
+	attempts = []int{}
+
+	err = database.Transaction(ctx, nil, func(ctx context.Context) error {
+		attempts = append(attempts, Context.TransactionAttempt(ctx))
+		return ErrDatabaseIntegrityViolation.Raise()
+	})
+	if !ErrDatabaseTransactionFailed.Is(err) || len(attempts) != 1 {
+		t.Fatalf("expected non retriable errors not to be retried, got %v after attempts %v", err, attempts)
+	}
+}
+
+func TestExecUnbounded(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t, DatabaseConfig{
+		MaxConns:         util.Pointer(1),
+		StatementTimeout: util.Pointer(100 * time.Millisecond),
+	})
+
+	_, err := database.Exec(ctx, sqlf.New("SELECT pg_sleep(0.3)"))
+	if err == nil {
+		t.Fatalf("expected statement timeout error")
+	}
+
+	_, err = database.ExecUnbounded(ctx, sqlf.New("SELECT pg_sleep(0.3)"))
+	if err != nil {
+		t.Fatalf("expected unbounded exec to complete, got %v", err)
+	}
+
+	// The only connection of the pool must have got its statement timeout back
+	_, err = database.Exec(ctx, sqlf.New("SELECT pg_sleep(0.3)"))
+	if err == nil {
+		t.Fatalf("expected statement timeout to be reset after the unbounded exec")
+	}
+}
+
+func TestListen(t *testing.T) {
+	database := newTestDatabase(t, DatabaseConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	payloads := make(chan string, 1)
+	listened := make(chan error, 1)
+
+	go func() {
+		listened <- database.Listen(ctx, "kit_test", func(payload string) {
+			select {
+			case payloads <- payload:
+			default:
+			}
+		})
+	}()
+
+	// The listening connection may not be subscribed yet, so keep notifying until a payload arrives
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	timeout := time.After(5 * time.Second)
+
+loop:
+	for {
+		select {
+		case payload := <-payloads:
+			if payload != "user:1" {
+				t.Fatalf("expected user:1 payload, got %s", payload)
+			}
+
+			break loop
+		case <-ticker.C:
+			_, err := database.Exec(ctx, sqlf.New("SELECT pg_notify('kit_test', 'user:1')"))
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatalf("expected a notification")
+		}
+	}
+
+	cancel()
+
+	err := <-listened
+	if err != nil {
+		t.Fatalf("expected no error once the context is done, got %v", err)
+	}
+}
+
+func TestDatabaseScratch(t *testing.T) {
+	type row struct {
+		ID   int64
+		Name string
+	}
+
+	rows := []row{{ID: 1}}
+	count := 0
+	dest := []any{&rows, &count}
+
+	scratch := _databaseScratch(dest)
+	*(scratch[0].(*[]row)) = append(*(scratch[0].(*[]row)), row{ID: 2})
+	*(scratch[1].(*int)) = 2
+
+	if len(rows) != 1 || count != 0 {
+		t.Fatalf("expected dest untouched before commit, got %v and %d", rows, count)
+	}
+
+	_databaseCommit(dest, scratch)
+
+	if len(rows) != 2 || count != 2 {
+		t.Fatalf("expected dest written on commit, got %v and %d", rows, count)
+	}
+}
+
+func TestQueryCancellation(t *testing.T) {
+	database := newTestDatabase(t, DatabaseConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	var rows []struct {
+		I int64
+	}
+
+	err := database.Query(ctx,
+		sqlf.New("SELECT i FROM generate_series(1, 10) i WHERE pg_sleep(0.1) IS NOT NULL").To(&rows))
+	if !ErrDatabaseTimedOut.Is(err) {
+		t.Fatalf("expected timed out error, got %v", err)
+	}
+
+	if rows != nil {
+		t.Fatalf("expected dest not to be partially written, got %v", rows)
+	}
+}
+
+func TestDatabaseReadPool(t *testing.T) {
+	ctx := context.Background()
+
+	newLazyPool := func(host string) *pgxpool.Pool {
+		config, err := pgxpool.ParseConfig(fmt.Sprintf("postgres://kit@%s:5432/kit", host))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		config.LazyConnect = true
+
+		pool, err := pgxpool.ConnectConfig(ctx, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return pool
+	}
+
+	primary := newLazyPool("primary")
+	defer primary.Close()
+
+	replica := newLazyPool("replica")
+	defer replica.Close()
+
+	database := &Database{pool: &atomic.Pointer[pgxpool.Pool]{}}
+	database.pool.Store(primary)
+
+	if database.readPool(ctx) != primary {
+		t.Fatalf("expected reads to be served by the primary without replica")
+	}
+
+	database.replica = replica
+
+	if database.readPool(ctx) != replica {
+		t.Fatalf("expected reads to be served by the replica")
+	}
+
+	if database.readPool(WithPrimaryRead(ctx)) != primary {
+		t.Fatalf("expected primary reads to be served by the primary")
+	}
+}
+
+func TestDatabaseIdentifiers(t *testing.T) {
+	if identifier := _dbIdentifier("audit.Log"); identifier != `"audit"."Log"` {
+		t.Fatalf("expected qualified identifier to be quoted, got %s", identifier)
+	}
+
+	identifiers, err := _dbIdentifiers([]string{"order", `na"me`})
+	if err != nil || !reflect.DeepEqual(identifiers, []string{`"order"`, `"na""me"`}) {
+		t.Fatalf("expected identifiers to be quoted, got %v %v", identifiers, err)
+	}
+
+	_, err = _dbIdentifiers([]string{"id", ""})
+	if !ErrDatabaseGeneric.Is(err) {
+		t.Fatalf("expected empty identifier to be rejected, got %v", err)
+	}
+
+	database := &Database{}
+
+	for _, conflict := range [][]string{nil, {}} {
+		_, err = database.Upsert(context.Background(), "users", []string{"id"}, [][]any{{1}}, conflict, nil)
+		if !ErrDatabaseGeneric.Is(err) {
+			t.Fatalf("expected empty conflict target to be rejected, got %v", err)
+		}
+	}
+}
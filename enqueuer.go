@@ -16,8 +16,9 @@ import (
 )
 
 const (
-	_ENQUEUER_REDIS_DSN            = "%s:%d"
-	_ENQUEUER_TASK_TRACE_ID_HEADER = "x_trace_id"
+	_ENQUEUER_REDIS_DSN               = "%s:%d"
+	_ENQUEUER_TASK_TRACE_ID_HEADER    = "x_trace_id"
+	_ENQUEUER_TASK_TRACEPARENT_HEADER = "traceparent"
 )
 
 var (
@@ -83,12 +84,41 @@ func NewEnqueuer(observer *Observer, config EnqueuerConfig) *Enqueuer {
 }
 
 func (self *Enqueuer) Enqueue(ctx context.Context, task string, params any, options ...asynq.Option) error {
-	traceID := self.observer.GetTrace(ctx)
+	info, err := self.enqueue(ctx, task, params, options...)
+	if err != nil {
+		return err
+	}
+
+	self.observer.Infof(ctx, "Enqueued task %s on queue %s with id %s and trace %s",
+		info.Type, info.Queue, info.ID, self.observer.GetTrace(ctx))
+
+	return nil
+}
+
+func (self *Enqueuer) enqueue(ctx context.Context, task string, params any,
+	options ...asynq.Option) (*asynq.TaskInfo, error) {
+	payload, err := _taskPayload(ctx, self.observer, params)
+	if err != nil {
+		return nil, ErrEnqueuerGeneric.Raise().Cause(err)
+	}
+
+	info, err := self.client.EnqueueContext(ctx,
+		asynq.NewTask(task, payload, asynq.MaxRetry(*self.config.TaskDefaultRetry)), options...)
+	if err != nil {
+		return nil, ErrEnqueuerGeneric.Raise().Cause(err)
+	}
+
+	return info, nil
+}
+
+// _taskPayload encodes the params as JSON along with the trace headers of ctx, which TraceTask continues.
+func _taskPayload(ctx context.Context, observer *Observer, params any) ([]byte, error) {
+	traceID := observer.GetTrace(ctx)
 	sentrySpan := sentry.SpanFromContext(ctx)
 
 	payload, err := json.Marshal(params)
 	if err != nil {
-		return ErrEnqueuerGeneric.Raise().Cause(err)
+		return nil, err
 	}
 
 	data := make(map[string]any)
@@ -96,32 +126,55 @@ func (self *Enqueuer) Enqueue(ctx context.Context, task string, params any, opti
 	if params != nil {
 		err = json.Unmarshal(payload, &data)
 		if err != nil {
-			return ErrEnqueuerGeneric.Raise().Cause(err)
+			return nil, err
 		}
 	}
 
 	data[_ENQUEUER_TASK_TRACE_ID_HEADER] = traceID
 	if sentrySpan != nil {
 		data[sentry.SentryTraceHeader] = sentrySpan.ToSentryTrace()
+		data[sentry.SentryBaggageHeader] = sentrySpan.ToBaggage()
+		data[_ENQUEUER_TASK_TRACEPARENT_HEADER] = _spanToTraceparent(sentrySpan)
 	}
 
-	payload, err = json.Marshal(data)
-	if err != nil {
-		return ErrEnqueuerGeneric.Raise().Cause(err)
-	}
+	return json.Marshal(data)
+}
 
+// EnqueueRaw enqueues the payload as is, for the handlers registered with Worker.RegisterRaw that manage their
+// own serialization, for example of protobuf messages. The trace is not propagated to the task, as it is carried
+// within the JSON payloads, so it has to be included in the payload if needed.
+func (self *Enqueuer) EnqueueRaw(ctx context.Context, task string, payload []byte, options ...asynq.Option) error {
 	info, err := self.client.EnqueueContext(ctx,
 		asynq.NewTask(task, payload, asynq.MaxRetry(*self.config.TaskDefaultRetry)), options...)
 	if err != nil {
 		return ErrEnqueuerGeneric.Raise().Cause(err)
 	}
 
-	self.observer.Infof(
-		ctx, "Enqueued task %s on queue %s with id %s and trace %s", info.Type, info.Queue, info.ID, traceID)
+	self.observer.Infof(ctx, "Enqueued raw task %s on queue %s with id %s and trace %s",
+		info.Type, info.Queue, info.ID, self.observer.GetTrace(ctx))
 
 	return nil
 }
 
+// EnqueueCodec enqueues the params encoded with codec, for the handlers registered with RegisterTypedCodec with the
+// same codec. As with EnqueueRaw, the trace is not propagated to the task.
+func (self *Enqueuer) EnqueueCodec(ctx context.Context, codec TaskCodec, task string, params any,
+	options ...asynq.Option) error {
+	payload, err := codec.Marshal(params)
+	if err != nil {
+		return ErrEnqueuerGeneric.Raise().Cause(err)
+	}
+
+	return self.EnqueueRaw(ctx, task, payload, options...)
+}
+
+// EnqueueGroup enqueues the task to be aggregated with the rest of the tasks of the group in the queue by the
+// aggregator registered with Worker.RegisterAggregator, instead of being handled on its own.
+func (self *Enqueuer) EnqueueGroup(ctx context.Context, queue string, group string, task string, params any,
+	options ...asynq.Option) error {
+	return self.Enqueue(ctx, task, params, append(options, asynq.Queue(queue), asynq.Group(group))...)
+}
+
 func (self *Enqueuer) Close(ctx context.Context) error {
 	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
 		self.observer.Info(ctx, "Closing enqueuer")
@@ -2,7 +2,10 @@ package kit
 
 import (
 	"context"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/hibiken/asynq"
 	"github.com/labstack/echo/v4"
@@ -19,17 +22,28 @@ var (
 var (
 	_ERROR_HANDLER_DEFAULT_CONFIG = ErrorHandlerConfig{
 		MinStatusCodeToLog: util.Pointer(http.StatusInternalServerError),
+		RetryAfter:         util.Pointer(5 * time.Second),
 	}
 )
 
+// ErrorHandlerConfig RetryAfter is the delay suggested to clients through
+// the Retry-After header when an unhandled error is retryable.
 type ErrorHandlerConfig struct {
 	Environment        Environment
 	MinStatusCodeToLog *int
+	RetryAfter         *time.Duration
+}
+
+type _errorHandlerMapping struct {
+	err       error
+	httpError HTTPError
 }
 
 type ErrorHandler struct {
-	config   ErrorHandlerConfig
-	observer *Observer
+	config    ErrorHandlerConfig
+	observer  *Observer
+	mappings  []_errorHandlerMapping
+	localizer *Localizer
 }
 
 func NewErrorHandler(observer *Observer, config ErrorHandlerConfig) *ErrorHandler {
@@ -41,6 +55,50 @@ func NewErrorHandler(observer *Observer, config ErrorHandlerConfig) *ErrorHandle
 	}
 }
 
+// Register maps an application error, matched anywhere in the returned error chain,
+// to an HTTP error code and status. It is meant to be called at startup.
+func (self *ErrorHandler) Register(err error, httpError HTTPError) {
+	self.mappings = append(self.mappings, _errorHandlerMapping{
+		err:       err,
+		httpError: httpError,
+	})
+}
+
+// SetLocalizer localizes the HTTP error messages by code, using the request locale if it has been set
+// in the context or otherwise the Accept-Language header, falling back to the default locale.
+func (self *ErrorHandler) SetLocalizer(localizer *Localizer) {
+	self.localizer = localizer
+}
+
+func (self *ErrorHandler) localize(ctx echo.Context, httpError *HTTPError) *HTTPError {
+	if self.localizer == nil {
+		return httpError
+	}
+
+	requestCtx := ctx.Request().Context()
+	if _, ok := Context.Locale(requestCtx); !ok {
+		requestCtx = self.localizer.SetLocale(requestCtx,
+			self.localizer.ParseLocale(ctx.Request().Header.Get("Accept-Language")))
+	}
+
+	message, ok := self.localizer.Lookup(requestCtx, httpError.Code())
+	if !ok {
+		return httpError
+	}
+
+	return httpError.WithMessage(message)
+}
+
+func (self *ErrorHandler) mapError(err error) *HTTPError {
+	for _, mapping := range self.mappings {
+		if util.Is(err, mapping.err) {
+			return mapping.httpError.Cause(err)
+		}
+	}
+
+	return nil
+}
+
 func (self *ErrorHandler) HandleRequest(err error, ctx echo.Context) {
 	// If response was already committed it means another middleware or an actual view
 	// has already called the error handler or has written an appropriate response.
@@ -54,13 +112,21 @@ func (self *ErrorHandler) HandleRequest(err error, ctx echo.Context) {
 		httpError = &httpErrorV
 
 		if !ok {
+			httpError = self.mapError(err)
+		}
+
+		if httpError == nil && IsRetryable(err) {
+			httpError = HTTPErrServerUnavailable.Cause(err).RetryAfter(*self.config.RetryAfter)
+		}
+
+		if httpError == nil {
 			switch err {
 			case echo.ErrNotFound:
 				httpError = HTTPErrNotFound.Cause(err)
 			case echo.ErrMethodNotAllowed:
 				httpError = HTTPErrInvalidRequest.Cause(err)
 			case echo.ErrStatusRequestEntityTooLarge:
-				httpError = HTTPErrInvalidRequest.Cause(err)
+				httpError = HTTPErrPayloadTooLarge.Cause(err)
 			case http.ErrHandlerTimeout:
 				httpError = HTTPErrServerTimeout.Cause(err)
 			default:
@@ -73,6 +139,11 @@ func (self *ErrorHandler) HandleRequest(err error, ctx echo.Context) {
 		self.observer.Error(ctx.Request().Context(), httpError)
 	}
 
+	if httpError.Retryable() {
+		ctx.Response().Header().Set(echo.HeaderRetryAfter,
+			strconv.Itoa(int(math.Ceil(httpError.RetryAfterDuration().Seconds()))))
+	}
+
 	if ctx.Request().Method == http.MethodHead {
 		err = ctx.NoContent(httpError.Status())
 	} else {
@@ -80,6 +151,8 @@ func (self *ErrorHandler) HandleRequest(err error, ctx echo.Context) {
 			httpError.Redact()
 		}
 
+		httpError = self.localize(ctx, httpError)
+
 		err = ctx.JSON(httpError.Status(), httpError)
 	}
 
@@ -92,11 +165,31 @@ func (self *ErrorHandler) HandleRequest(err error, ctx echo.Context) {
 	}
 }
 
-func (self *ErrorHandler) HandleTask(ctx context.Context, _ *asynq.Task, err error) {
+func (self *ErrorHandler) HandleTask(ctx context.Context, task *asynq.Task, err error) {
 	if err == nil {
 		return
 	}
 
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+
+	switch {
+	case util.Is(err, asynq.SkipRetry):
+		self.observer.Infof(ctx, "Task %s failed with a permanent error, skipping retries", task.Type())
+	case retried >= maxRetry:
+		self.observer.Infof(ctx, "Task %s failed after exhausting its %d retries", task.Type(), maxRetry)
+	case IsRetryable(err):
+		self.observer.Infof(ctx, "Task %s failed with a transient error, retrying %d/%d",
+			task.Type(), retried+1, maxRetry)
+	default:
+		self.observer.Infof(ctx, "Task %s failed with an unknown error, retrying %d/%d",
+			task.Type(), retried+1, maxRetry)
+	}
+
+	if skipRetryErr, ok := err.(_workerSkipRetryError); ok { // nolint:errorlint
+		err = skipRetryErr.error
+	}
+
 	self.observer.Error(ctx, err)
 }
 
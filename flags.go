@@ -0,0 +1,321 @@
+package kit
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neoxelox/errors"
+
+	"github.com/neoxelox/kit/util"
+)
+
+var (
+	ErrFlagsGeneric  = errors.New("flags failed")
+	ErrFlagsTimedOut = errors.New("flags timed out")
+)
+
+var (
+	_FLAGS_DEFAULT_CONFIG = FlagsConfig{
+		CacheKey:       util.Pointer("kit:flags"),
+		ReloadInterval: util.Pointer(30 * time.Second),
+		ReloadDebounce: util.Pointer(1 * time.Second),
+	}
+)
+
+// FlagsConfig File is the path of a JSON object of flags, which are read from the map stored
+// in the CacheKey of the given cache instead when it is empty.
+type FlagsConfig struct {
+	File           string
+	CacheKey       *string
+	ReloadInterval *time.Duration
+	ReloadDebounce *time.Duration
+}
+
+// Validate returns the first invalid field of the config, nil pointers being left to the defaults.
+func (self FlagsConfig) Validate() error {
+	switch {
+	case self.CacheKey != nil && *self.CacheKey == "":
+		return ErrFlagsGeneric.Raise().With("flags config cache key is empty")
+	case !_isValidTimeout(self.ReloadInterval):
+		return ErrFlagsGeneric.Raise().With("flags config reload interval is not positive")
+	case !_isValidTimeout(self.ReloadDebounce):
+		return ErrFlagsGeneric.Raise().With("flags config reload debounce is not positive")
+	}
+
+	return nil
+}
+
+// Flags keeps a local copy of the feature flags, reloaded from their source on an interval, so that they can
+// be flipped without redeploys. Reads never reach the source and changes are logged through the observer.
+type Flags struct {
+	config      FlagsConfig
+	observer    *Observer
+	cache       Cacher
+	flags       *atomic.Pointer[map[string]any]
+	subscribers map[string][]func(value any)
+	mutex       *sync.Mutex
+	reloading   *sync.Mutex
+	reload      func()
+	stopReload  context.CancelFunc
+	reloaded    chan struct{}
+}
+
+func NewFlags(ctx context.Context, observer *Observer, config FlagsConfig, cache ...Cacher) (*Flags, error) {
+	util.Merge(&config, _FLAGS_DEFAULT_CONFIG)
+
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	flags := &Flags{
+		config:      config,
+		observer:    observer,
+		cache:       util.Optional(cache, nil),
+		flags:       &atomic.Pointer[map[string]any]{},
+		subscribers: make(map[string][]func(value any)),
+		mutex:       &sync.Mutex{},
+		reloading:   &sync.Mutex{},
+		reloaded:    make(chan struct{}),
+	}
+
+	if flags.config.File == "" && flags.cache == nil {
+		return nil, ErrFlagsGeneric.Raise().With("flags config file is empty and no cache is given")
+	}
+
+	values, err := flags.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	flags.flags.Store(&values)
+
+	reloadCtx, stopReload := context.WithCancel(context.WithoutCancel(ctx))
+	flags.stopReload = stopReload
+	flags.reload = util.Debounce(*config.ReloadDebounce, func() {
+		flags.Reload(reloadCtx) // nolint:errcheck
+	})
+
+	go flags.watch(reloadCtx)
+
+	return flags, nil
+}
+
+func (self *Flags) load(ctx context.Context) (map[string]any, error) {
+	values := make(map[string]any)
+
+	if self.config.File != "" {
+		data, err := os.ReadFile(self.config.File)
+		if err != nil {
+			return nil, ErrFlagsGeneric.Raise().Cause(err)
+		}
+
+		err = json.Unmarshal(data, &values)
+		if err != nil {
+			return nil, ErrFlagsGeneric.Raise().With("cannot decode flags file %s", self.config.File).Cause(err)
+		}
+
+		return values, nil
+	}
+
+	err := self.cache.Get(ctx, *self.config.CacheKey, &values)
+	if err != nil {
+		// No flags are stored yet, so all of them take their defaults
+		if ErrCacheMiss.Is(err) {
+			return values, nil
+		}
+
+		return nil, ErrFlagsGeneric.Raise().Cause(err)
+	}
+
+	return values, nil
+}
+
+func (self *Flags) watch(ctx context.Context) {
+	defer close(self.reloaded)
+	defer self.observer.Recover(ctx)
+
+	ticker := time.NewTicker(*self.config.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := self.Reload(ctx)
+		if err != nil && ctx.Err() == nil {
+			self.observer.Error(ctx, err)
+		}
+	}
+}
+
+// Reload reloads the flags from their source right away, logging and notifying the changed ones.
+// On failure the current flags are kept.
+func (self *Flags) Reload(ctx context.Context) error {
+	// Reloads are serialized from load to swap so that an overlapping slower reload cannot apply older values
+	self.reloading.Lock()
+
+	values, err := self.load(ctx)
+	if err != nil {
+		self.reloading.Unlock()
+		return err
+	}
+
+	type change struct {
+		name        string
+		previous    any
+		value       any
+		subscribers []func(value any)
+	}
+
+	changes := make([]change, 0)
+
+	self.mutex.Lock()
+
+	previous := *self.flags.Swap(&values)
+
+	for name, value := range values {
+		if previousValue, ok := previous[name]; !ok || !util.Equals(previousValue, value) {
+			changes = append(changes, change{name, previousValue, value, self.subscribers[name]})
+		}
+	}
+
+	for name, previousValue := range previous {
+		if _, ok := values[name]; !ok {
+			changes = append(changes, change{name, previousValue, nil, self.subscribers[name]})
+		}
+	}
+
+	self.mutex.Unlock()
+	self.reloading.Unlock()
+
+	// Subscribers are called without holding the lock so that they can read flags and subscribe
+	for _, change := range changes {
+		self.observer.Infof(ctx, "Flag %s changed from %v to %v", change.name, change.previous, change.value)
+
+		for _, subscriber := range change.subscribers {
+			func() {
+				defer self.observer.Recover(ctx)
+				subscriber(change.value)
+			}()
+		}
+	}
+
+	return nil
+}
+
+// ReloadSoon reloads the flags once its calls stop for the reload debounce, for example
+// when notified of a change, collapsing the bursts of notifications into a single reload.
+func (self *Flags) ReloadSoon() {
+	self.reload()
+}
+
+// Subscribe calls fn with the new value of the flag, nil when removed, every time it changes on reload.
+func (self *Flags) Subscribe(name string, fn func(value any)) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.subscribers[name] = append(self.subscribers[name], fn)
+}
+
+func (self *Flags) value(name string) (any, bool) {
+	value, ok := (*self.flags.Load())[name]
+	return value, ok && value != nil
+}
+
+// Bool returns the flag as a bool, def when it is not set or it is not a bool nor a parsable string.
+func (self *Flags) Bool(name string, def bool) bool {
+	value, ok := self.value(name)
+	if !ok {
+		return def
+	}
+
+	switch value := value.(type) {
+	case bool:
+		return value
+	case string:
+		parsed, err := strconv.ParseBool(value)
+		if err == nil {
+			return parsed
+		}
+	}
+
+	return def
+}
+
+// Int returns the flag as an int, def when it is not set or it is not an integral number nor a parsable string.
+func (self *Flags) Int(name string, def int) int {
+	value, ok := self.value(name)
+	if !ok {
+		return def
+	}
+
+	if parsed, ok := value.(string); ok {
+		number, err := strconv.Atoi(parsed)
+		if err != nil {
+			return def
+		}
+
+		return number
+	}
+
+	// Numbers are decoded as float64 from JSON and as the smallest fitting type from the cache
+	number := reflect.ValueOf(value)
+
+	switch {
+	case number.CanInt():
+		return int(number.Int())
+	case number.CanUint():
+		return int(number.Uint())
+	case number.CanFloat() && number.Float() == math.Trunc(number.Float()):
+		return int(number.Float())
+	}
+
+	return def
+}
+
+// String returns the flag as a string, def when it is not set or it is not a string.
+func (self *Flags) String(name string, def string) string {
+	value, ok := self.value(name)
+	if !ok {
+		return def
+	}
+
+	if value, ok := value.(string); ok {
+		return value
+	}
+
+	return def
+}
+
+func (self *Flags) Close(ctx context.Context) error {
+	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
+		self.observer.Info(ctx, "Closing flags")
+
+		self.stopReload()
+		<-self.reloaded
+
+		self.observer.Info(ctx, "Closed flags")
+
+		return nil
+	})
+	if err != nil {
+		if util.ErrDeadlineExceeded.Is(err) {
+			return ErrFlagsTimedOut.Raise().Cause(err)
+		}
+
+		return err
+	}
+
+	return nil
+}
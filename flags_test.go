@@ -0,0 +1,65 @@
+package kit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlagsFile(t *testing.T) {
+	ctx := context.Background()
+
+	observer, err := NewObserver(ctx, ObserverConfig{
+		Environment: EnvIntegration,
+		Service:     "kit",
+		Level:       LvlNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "flags.json")
+
+	err = os.WriteFile(file, []byte(`{"enabled": true, "limit": 10, "mode": "fast", "ratio": 0.5}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags, err := NewFlags(ctx, observer, FlagsConfig{File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer flags.Close(ctx) // nolint:errcheck
+
+	if !flags.Bool("enabled", false) || flags.Int("limit", 0) != 10 || flags.String("mode", "") != "fast" {
+		t.Fatalf("expected flags to be loaded from the file")
+	}
+
+	if flags.Int("ratio", 1) != 1 || flags.Bool("mode", true) != true || flags.String("missing", "def") != "def" {
+		t.Fatalf("expected defaults for mistyped and missing flags")
+	}
+
+	var changed []any
+	flags.Subscribe("limit", func(value any) {
+		changed = append(changed, value)
+	})
+
+	err = os.WriteFile(file, []byte(`{"enabled": true, "limit": 20}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = flags.Reload(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if flags.Int("limit", 0) != 20 || flags.String("mode", "def") != "def" {
+		t.Fatalf("expected flags to be reloaded")
+	}
+
+	if len(changed) != 1 || changed[0] != float64(20) {
+		t.Fatalf("expected subscriber to be notified once of the change, got %v", changed)
+	}
+}
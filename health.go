@@ -0,0 +1,197 @@
+package kit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/neoxelox/errors"
+
+	"github.com/neoxelox/kit/util"
+)
+
+var (
+	ErrHealthAggregatorGeneric = errors.New("health aggregator failed")
+)
+
+var (
+	_HEALTH_AGGREGATOR_DEFAULT_CONFIG = HealthAggregatorConfig{
+		CheckTimeout: util.Pointer(2 * time.Second),
+	}
+)
+
+type HealthStatus string
+
+var (
+	HealthStatusOK      HealthStatus = "ok"
+	HealthStatusFailed  HealthStatus = "failed"
+	HealthStatusTimeout HealthStatus = "timeout"
+)
+
+// HealthAggregatorConfig CheckTimeout is the default timeout of each check, which should
+// be lower than the timeout of the probes so that they get a report rather than a timeout.
+type HealthAggregatorConfig struct {
+	CheckTimeout *time.Duration
+}
+
+type HealthCheckReport struct {
+	Status   HealthStatus  `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+type HealthReport struct {
+	Status HealthStatus                 `json:"status"`
+	Checks map[string]HealthCheckReport `json:"checks"`
+}
+
+type _healthCheck struct {
+	name    string
+	checker HealthChecker
+	timeout time.Duration
+}
+
+// HealthAggregator runs the registered checks concurrently, each one with its own timeout, so that
+// a single hung check, such as a wedged connection, cannot make the whole health report hang.
+type HealthAggregator struct {
+	config   HealthAggregatorConfig
+	observer *Observer
+	checks   []_healthCheck
+	mutex    *sync.RWMutex
+}
+
+func NewHealthAggregator(observer *Observer, config HealthAggregatorConfig) *HealthAggregator {
+	util.Merge(&config, _HEALTH_AGGREGATOR_DEFAULT_CONFIG)
+
+	if !_isValidTimeout(config.CheckTimeout) {
+		observer.Panic(context.Background(), ErrHealthAggregatorGeneric.Raise().
+			With("health aggregator config check timeout is not positive"))
+	}
+
+	return &HealthAggregator{
+		config:   config,
+		observer: observer,
+		checks:   make([]_healthCheck, 0),
+		mutex:    &sync.RWMutex{},
+	}
+}
+
+// Register adds the check of the checker under name, timing out after
+// the given timeout or the default check timeout. It is meant to be called at startup.
+func (self *HealthAggregator) Register(name string, checker HealthChecker, timeout ...time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.checks = append(self.checks, _healthCheck{
+		name:    name,
+		checker: checker,
+		timeout: util.Optional(timeout, *self.config.CheckTimeout),
+	})
+}
+
+// Check runs all the checks and returns as soon as all of them resolve or ctx is done, reporting the ones
+// that did not resolve in time as timed out. Hung checks ignoring their context are left running behind.
+func (self *HealthAggregator) Check(ctx context.Context) HealthReport {
+	self.mutex.RLock()
+	checks := append([]_healthCheck{}, self.checks...)
+	self.mutex.RUnlock()
+
+	type result struct {
+		name   string
+		report HealthCheckReport
+	}
+
+	results := make(chan result, len(checks))
+
+	for _, check := range checks {
+		go func(check _healthCheck) {
+			results <- result{check.name, self.run(ctx, check)}
+		}(check)
+	}
+
+	report := HealthReport{
+		Status: HealthStatusOK,
+		Checks: make(map[string]HealthCheckReport, len(checks)),
+	}
+
+	start := time.Now()
+
+	for pending := len(checks); pending > 0; pending-- {
+		select {
+		case result := <-results:
+			report.Checks[result.name] = result.report
+		case <-ctx.Done():
+			pending = 0
+		}
+	}
+
+	for _, check := range checks {
+		if _, ok := report.Checks[check.name]; !ok {
+			report.Checks[check.name] = HealthCheckReport{
+				Status:   HealthStatusTimeout,
+				Error:    ctx.Err().Error(),
+				Duration: time.Since(start),
+			}
+		}
+
+		if report.Checks[check.name].Status != HealthStatusOK {
+			report.Status = HealthStatusFailed
+
+			self.observer.Warnf(ctx, "Health check %s %s: %s",
+				check.name, report.Checks[check.name].Status, report.Checks[check.name].Error)
+		}
+	}
+
+	return report
+}
+
+func (self *HealthAggregator) run(ctx context.Context, check _healthCheck) HealthCheckReport {
+	ctx, cancel := context.WithTimeout(ctx, check.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- fmt.Errorf("panic: %v", rec)
+			}
+		}()
+
+		done <- check.checker.Health(ctx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	switch {
+	case err == nil:
+		return HealthCheckReport{Status: HealthStatusOK, Duration: time.Since(start)}
+	case ctx.Err() != nil:
+		// Errors caused by the check timing out are reported as such rather than as failures
+		return HealthCheckReport{Status: HealthStatusTimeout, Error: err.Error(), Duration: time.Since(start)}
+	default:
+		return HealthCheckReport{Status: HealthStatusFailed, Error: err.Error(), Duration: time.Since(start)}
+	}
+}
+
+// Handle responds the health report, with a 503 status when any check is not ok, for readiness endpoints.
+func (self *HealthAggregator) Handle(ctx echo.Context) error {
+	report := self.Check(ctx.Request().Context())
+
+	status := http.StatusOK
+	if report.Status != HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	return ctx.JSON(status, report)
+}
@@ -0,0 +1,70 @@
+package kit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type _healthTestChecker func(ctx context.Context) error
+
+func (self _healthTestChecker) Health(ctx context.Context) error {
+	return self(ctx)
+}
+
+func TestHealthAggregatorCheck(t *testing.T) {
+	ctx := context.Background()
+
+	observer, err := NewObserver(ctx, ObserverConfig{
+		Environment: EnvIntegration,
+		Service:     "kit",
+		Level:       LvlNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hung := make(chan struct{})
+	defer close(hung)
+
+	aggregator := NewHealthAggregator(observer, HealthAggregatorConfig{})
+	aggregator.Register("ok", _healthTestChecker(func(ctx context.Context) error {
+		return nil
+	}))
+	aggregator.Register("failed", _healthTestChecker(func(ctx context.Context) error {
+		return errors.New("failed")
+	}))
+	aggregator.Register("hung", _healthTestChecker(func(ctx context.Context) error {
+		<-hung
+		return nil
+	}), 20*time.Millisecond)
+	aggregator.Register("slow", _healthTestChecker(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), 20*time.Millisecond)
+
+	start := time.Now()
+	report := aggregator.Check(ctx)
+
+	if time.Since(start) > time.Second {
+		t.Fatalf("expected the hung checks not to hang the report")
+	}
+
+	expected := map[string]HealthStatus{
+		"ok":     HealthStatusOK,
+		"failed": HealthStatusFailed,
+		"hung":   HealthStatusTimeout,
+		"slow":   HealthStatusTimeout,
+	}
+
+	for name, status := range expected {
+		if report.Checks[name].Status != status {
+			t.Errorf("expected check %s to be %s, got %s", name, status, report.Checks[name].Status)
+		}
+	}
+
+	if report.Status != HealthStatusFailed {
+		t.Fatalf("expected the report to be failed, got %s", report.Status)
+	}
+}
@@ -15,13 +15,16 @@ import (
 )
 
 const (
-	_HTTP_CLIENT_RETRY_DEDUP_SKIP_COUNT = 6
+	_HTTP_CLIENT_RETRY_DEDUP_SKIP_COUNT = 6 + 3 // Retrier plus attempt and protect frames
+	_HTTP_CLIENT_REQUEST_ID_HEADER      = "X-Request-Id"
 )
 
 var (
 	ErrHTTPClientGeneric     = errors.New("http client failed")
 	ErrHTTPClientTimedOut    = errors.New("http client timed out")
+	ErrHTTPClientUnavailable = errors.New("http client unavailable")
 	ErrHTTPClientBadStatus   = errors.New("http client bad status (%d)")
+	ErrHTTPClientServerError = errors.New("http client server error (%d)")
 	ErrHTTPClientRateLimited = errors.New("http client rate limited (%d)")
 )
 
@@ -47,12 +50,14 @@ type HTTPClientConfig struct {
 	RaiseForStatus   *bool
 	AllowedRedirects *int
 	DefaultRetry     *RetryConfig
+	CircuitBreaker   *CircuitBreakerConfig
 }
 
 type HTTPClient struct {
 	config   HTTPClientConfig
 	observer *Observer
 	client   *http.Client
+	breaker  *util.CircuitBreaker
 }
 
 func NewHTTPClient(observer *Observer, config HTTPClientConfig) *HTTPClient {
@@ -73,9 +78,34 @@ func NewHTTPClient(observer *Observer, config HTTPClientConfig) *HTTPClient {
 		config:   config,
 		observer: observer,
 		client:   client,
+		breaker:  _newCircuitBreaker(config.CircuitBreaker),
 	}
 }
 
+// HTTPTraceTransport traces the requests of plain http.Clients and propagates
+// the trace context to the downstream services, like HTTPClient does.
+type HTTPTraceTransport struct {
+	observer *Observer
+	base     http.RoundTripper
+}
+
+func NewHTTPTraceTransport(observer *Observer, base ...http.RoundTripper) *HTTPTraceTransport {
+	return &HTTPTraceTransport{
+		observer: observer,
+		base:     util.Optional(base, http.DefaultTransport),
+	}
+}
+
+func (self *HTTPTraceTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the original request
+	request = request.Clone(request.Context())
+
+	_, endTraceRequest := self.observer.TraceClientRequest(request.Context(), request)
+	defer endTraceRequest()
+
+	return self.base.RoundTrip(request)
+}
+
 func (self *HTTPClient) Request(
 	ctx context.Context, method string, url string,
 	body []byte, headers map[string]string, retry ...RetryConfig) (*http.Response, error) {
@@ -106,6 +136,30 @@ func (self *HTTPClient) Do(request *http.Request) (*http.Response, error) {
 	return self._do(request, self.config.DefaultRetry)
 }
 
+// protect runs fn through the circuit breaker, if enabled, only accounting connection failures,
+// timeouts and server errors and not the client errors nor caller cancellation and deadline errors.
+func (self *HTTPClient) protect(fn func() error) error {
+	if self.breaker == nil {
+		return fn()
+	}
+
+	var err error
+
+	errB := self.breaker.Run(func() error {
+		err = fn()
+		if !_isConnectionFailure(err) && !util.Is(err, ErrHTTPClientTimedOut, ErrHTTPClientServerError) {
+			return nil
+		}
+
+		return err
+	})
+	if util.ErrCircuitBreakerOpen.Is(errB) {
+		return ErrHTTPClientUnavailable.Raise().Skip(1).Cause(errB)
+	}
+
+	return err
+}
+
 func (self *HTTPClient) _do(request *http.Request, retry *RetryConfig) (*http.Response, error) {
 	if self.config.Headers != nil {
 		for header, value := range *self.config.Headers {
@@ -113,59 +167,40 @@ func (self *HTTPClient) _do(request *http.Request, retry *RetryConfig) (*http.Re
 		}
 	}
 
-	_, endTraceRequest := self.observer.TraceClientRequest(request.Context(), request)
+	if requestID, ok := Context.RequestID(request.Context()); ok && request.Header.Get(
+		_HTTP_CLIENT_REQUEST_ID_HEADER) == "" {
+		request.Header.Set(_HTTP_CLIENT_REQUEST_ID_HEADER, requestID)
+	}
+
+	ctx, endTraceRequest := self.observer.TraceClientRequest(request.Context(), request)
 	defer endTraceRequest()
 
 	var response *http.Response
 
-	err := util.ExponentialRetry(
-		retry.Attempts, retry.InitialDelay,
-		retry.LimitDelay, retry.Retriables,
+	err := util.BudgetedExponentialRetry(
+		request.Context(), retry.Attempts, retry.InitialDelay,
+		retry.LimitDelay, retry.Jitter, retry.MaxElapsed, retry.Retriables,
 		func(attempt int) error {
-			var err error // nolint:govet
+			self.observer.Debugf(ctx, "Requesting %s %s %d/%d", request.Method, request.URL, attempt, retry.Attempts)
 
-			response, err = self.client.Do(request) // nolint:bodyclose
-			if err != nil {
-				if urlErr, ok := err.(*url.Error); ok && urlErr.Timeout() {
-					return ErrHTTPClientTimedOut.Raise().
-						Skip(2 + _HTTP_CLIENT_RETRY_DEDUP_SKIP_COUNT).
-						Extra(map[string]any{"attempt": attempt, "timeout": self.config.Timeout}).
-						Cause(err)
+			// The body of the previous attempt has already been consumed
+			if attempt > 1 && request.GetBody != nil {
+				body, err := request.GetBody()
+				if err != nil {
+					return ErrHTTPClientGeneric.Raise().Extra(map[string]any{"attempt": attempt}).Cause(err)
 				}
 
-				return ErrHTTPClientGeneric.Raise().
-					Skip(2 + _HTTP_CLIENT_RETRY_DEDUP_SKIP_COUNT).
-					Extra(map[string]any{"attempt": attempt}).
-					Cause(err)
+				request.Body = body
 			}
 
-			if response.StatusCode == 429 && *self.config.RaiseForStatus {
-				wait := int64(0)
-
-				if retryAfter := response.Header.Get("Retry-After"); len(retryAfter) > 0 {
-					wait, _ = strconv.ParseInt(retryAfter, 10, 0)
-				} else if retryOn := response.Header.Get("X-Rate-Limit-Reset"); len(retryOn) > 0 {
-					retryOnInt, _ := strconv.ParseInt(retryOn, 10, 0)
-					now := time.Now().Unix()
-					if retryOnInt > now {
-						wait = retryOnInt - now
-					} else {
-						wait = retryOnInt
-					}
-				}
-
-				response.Body.Close()
-
-				return ErrHTTPClientRateLimited.Raise(wait).
-					Skip(2 + _HTTP_CLIENT_RETRY_DEDUP_SKIP_COUNT).
-					Extra(map[string]any{"attempt": attempt, "status": response.StatusCode, "wait": wait})
-			}
+			err := self.protect(func() error {
+				return self.attempt(request, attempt, &response)
+			})
+			if err != nil {
+				self.observer.Debugf(ctx, "Request %s %s %d/%d failed: %s",
+					request.Method, request.URL, attempt, retry.Attempts, err)
 
-			if response.StatusCode >= 400 && response.StatusCode != 429 && *self.config.RaiseForStatus {
-				response.Body.Close()
-				return ErrHTTPClientBadStatus.Raise(response.StatusCode).
-					Skip(2 + _HTTP_CLIENT_RETRY_DEDUP_SKIP_COUNT).
-					Extra(map[string]any{"attempt": attempt, "status": response.StatusCode})
+				return err
 			}
 
 			return nil
@@ -177,6 +212,73 @@ func (self *HTTPClient) _do(request *http.Request, retry *RetryConfig) (*http.Re
 	return response, nil
 }
 
+func (self *HTTPClient) attempt(request *http.Request, attempt int, response **http.Response) error {
+	var err error
+
+	*response, err = self.client.Do(request) // nolint:bodyclose
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok && urlErr.Timeout() {
+			return ErrHTTPClientTimedOut.Raise().
+				Skip(2 + _HTTP_CLIENT_RETRY_DEDUP_SKIP_COUNT).
+				Extra(map[string]any{"attempt": attempt, "timeout": self.config.Timeout}).
+				Cause(err)
+		}
+
+		return ErrHTTPClientGeneric.Raise().
+			Skip(2 + _HTTP_CLIENT_RETRY_DEDUP_SKIP_COUNT).
+			Extra(map[string]any{"attempt": attempt}).
+			Cause(err)
+	}
+
+	if !*self.config.RaiseForStatus {
+		return nil
+	}
+
+	statusCode := (*response).StatusCode
+
+	if statusCode == 429 {
+		wait := int64(0)
+
+		if retryAfter := (*response).Header.Get("Retry-After"); len(retryAfter) > 0 {
+			wait, _ = strconv.ParseInt(retryAfter, 10, 0)
+		} else if retryOn := (*response).Header.Get("X-Rate-Limit-Reset"); len(retryOn) > 0 {
+			retryOnInt, _ := strconv.ParseInt(retryOn, 10, 0)
+			now := time.Now().Unix()
+			if retryOnInt > now {
+				wait = retryOnInt - now
+			} else {
+				wait = retryOnInt
+			}
+		}
+
+		(*response).Body.Close()
+
+		return ErrHTTPClientRateLimited.Raise(wait).
+			Skip(2 + _HTTP_CLIENT_RETRY_DEDUP_SKIP_COUNT).
+			Extra(map[string]any{"attempt": attempt, "status": statusCode, "wait": wait})
+	}
+
+	if statusCode >= 500 {
+		(*response).Body.Close()
+
+		// Also a bad status so that callers matching any bad status keep working
+		return ErrHTTPClientServerError.Raise(statusCode).
+			Skip(2 + _HTTP_CLIENT_RETRY_DEDUP_SKIP_COUNT).
+			Extra(map[string]any{"attempt": attempt, "status": statusCode}).
+			Cause(ErrHTTPClientBadStatus.Raise(statusCode))
+	}
+
+	if statusCode >= 400 {
+		(*response).Body.Close()
+
+		return ErrHTTPClientBadStatus.Raise(statusCode).
+			Skip(2 + _HTTP_CLIENT_RETRY_DEDUP_SKIP_COUNT).
+			Extra(map[string]any{"attempt": attempt, "status": statusCode})
+	}
+
+	return nil
+}
+
 func (self *HTTPClient) Close(ctx context.Context) error {
 	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
 		// Don't log the normal closing messages because this HTTP client
@@ -5,32 +5,87 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/neoxelox/errors"
+
+	"github.com/neoxelox/kit/util"
 )
 
+// HTTPError is an error with a stable machine-readable code and HTTP status so that clients can switch
+// on codes rather than on messages. The optional message is public and is not redacted unlike the cause.
 type HTTPError struct {
-	cause  error
-	code   string
-	status int
+	cause      error
+	code       string
+	status     int
+	message    string
+	retryAfter time.Duration
+	fields     map[string]string
 }
 
-func NewHTTPError(code string, status int) HTTPError {
+func NewHTTPError(code string, status int, message ...string) HTTPError {
 	return HTTPError{
-		cause:  nil,
-		code:   code,
-		status: status,
+		cause:      nil,
+		code:       code,
+		status:     status,
+		message:    util.Optional(message, ""),
+		retryAfter: 0,
+		fields:     nil,
 	}
 }
 
 func (self HTTPError) Cause(err error) *HTTPError {
 	return &HTTPError{
-		cause:  err,
-		code:   self.code,
-		status: self.status,
+		cause:      err,
+		code:       self.code,
+		status:     self.status,
+		message:    self.message,
+		retryAfter: self.retryAfter,
+		fields:     self.fields,
+	}
+}
+
+func (self HTTPError) WithMessage(message string) *HTTPError {
+	return &HTTPError{
+		cause:      self.cause,
+		code:       self.code,
+		status:     self.status,
+		message:    message,
+		retryAfter: self.retryAfter,
+		fields:     self.fields,
+	}
+}
+
+// RetryAfter marks the error as transient so that clients know
+// to retry it, after the given duration, with backoff.
+func (self HTTPError) RetryAfter(after time.Duration) *HTTPError {
+	return &HTTPError{
+		cause:      self.cause,
+		code:       self.code,
+		status:     self.status,
+		message:    self.message,
+		retryAfter: after,
+		fields:     self.fields,
+	}
+}
+
+// WithFields details the invalid fields of the request, such as the ones failing
+// validation, keyed by their names and valued with the reasons why they are invalid.
+func (self HTTPError) WithFields(fields map[string]string) *HTTPError {
+	return &HTTPError{
+		cause:      self.cause,
+		code:       self.code,
+		status:     self.status,
+		message:    self.message,
+		retryAfter: self.retryAfter,
+		fields:     fields,
 	}
 }
 
+func (self HTTPError) Retryable() bool {
+	return self.retryAfter > 0
+}
+
 func (self HTTPError) Unwrap() error {
 	return self.cause
 }
@@ -43,6 +98,18 @@ func (self HTTPError) Status() int {
 	return self.status
 }
 
+func (self HTTPError) Message() string {
+	return self.message
+}
+
+func (self HTTPError) RetryAfterDuration() time.Duration {
+	return self.retryAfter
+}
+
+func (self HTTPError) Fields() map[string]string {
+	return self.fields
+}
+
 func (self *HTTPError) Redact() {
 	self.cause = nil
 }
@@ -103,20 +170,35 @@ func (self HTTPError) MarshalText() ([]byte, error) {
 }
 
 type _HTTPError struct {
-	Code    string `json:"code"`
-	Message string `json:"message,omitempty"`
+	Code      string            `json:"code"`
+	Message   string            `json:"message,omitempty"`
+	Retryable bool              `json:"retryable,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
 }
 
 func (self HTTPError) MarshalJSON() ([]byte, error) {
+	if self.message != "" {
+		return json.Marshal(_HTTPError{
+			Code:      self.code,
+			Message:   self.message,
+			Retryable: self.Retryable(),
+			Fields:    self.fields,
+		})
+	}
+
 	if self.cause != nil {
 		return json.Marshal(_HTTPError{
-			Code:    self.code,
-			Message: self.cause.Error(),
+			Code:      self.code,
+			Message:   self.cause.Error(),
+			Retryable: self.Retryable(),
+			Fields:    self.fields,
 		})
 	}
 
 	return json.Marshal(_HTTPError{
-		Code: self.code,
+		Code:      self.code,
+		Retryable: self.Retryable(),
+		Fields:    self.fields,
 	})
 }
 
@@ -1,22 +1,44 @@
 package kit
 
 import (
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
 	"regexp"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	echoMiddleware "github.com/labstack/echo/v4/middleware"
 	"github.com/neoxelox/errors"
+	"github.com/rs/zerolog"
 
 	"github.com/neoxelox/kit/util"
 )
 
+const (
+	_HTTP_SERVER_HTTP1_PROTOCOL = "http/1.1"
+	_HTTP_SERVER_HTTP2_PROTOCOL = "h2"
+)
+
+var (
+	ErrHTTPServerGeneric       = errors.New("http server failed")
+	ErrHTTPServerTimedOut      = errors.New("http server timed out")
+	ErrHTTPServerUnhealthy     = errors.New("http server unhealthy")
+	ErrHTTPServerDrainTimedOut = errors.New("http server drain timed out with %d in-flight requests")
+	ErrHTTPServerPayloadLimit  = errors.New("http server request payload exceeds the %s limit")
+)
+
 var (
-	ErrHTTPServerGeneric  = errors.New("http server failed")
-	ErrHTTPServerTimedOut = errors.New("http server timed out")
+	KeyHTTPServerBodyLimit    Key = KeyBase + "http:server:body:limit"
+	KeyHTTPServerErrorHandler Key = KeyBase + "http:server:error:handler"
 )
 
 var (
@@ -25,9 +47,12 @@ var (
 	HTTPErrServerTimeout     = NewHTTPError("ERR_SERVER_TIMEOUT", http.StatusGatewayTimeout)
 	HTTPErrClientGeneric     = NewHTTPError("ERR_CLIENT_GENERIC", http.StatusBadRequest)
 	HTTPErrInvalidRequest    = NewHTTPError("ERR_INVALID_REQUEST", http.StatusBadRequest)
+	HTTPErrValidation        = NewHTTPError("ERR_VALIDATION", http.StatusBadRequest)
 	HTTPErrNotFound          = NewHTTPError("ERR_NOT_FOUND", http.StatusNotFound)
 	HTTPErrUnauthorized      = NewHTTPError("ERR_UNAUTHORIZED", http.StatusUnauthorized)
 	HTTPErrRateLimited       = NewHTTPError("ERR_RATE_LIMITED", http.StatusTooManyRequests)
+	HTTPErrConflict          = NewHTTPError("ERR_CONFLICT", http.StatusConflict)
+	HTTPErrPayloadTooLarge   = NewHTTPError("ERR_PAYLOAD_TOO_LARGE", http.StatusRequestEntityTooLarge)
 )
 
 var (
@@ -41,11 +66,15 @@ var (
 		RequestReadHeaderTimeout: util.Pointer(30 * time.Second),
 		RequestIPExtractor:       util.Pointer((func(*http.Request) string)(echo.ExtractIPFromRealIPHeader())),
 		ResponseWriteTimeout:     util.Pointer(30 * time.Second),
+		TLSHTTP2:                 util.Pointer(false),
+		UnixSocketMode:           util.Pointer(os.FileMode(0o660)),
 	}
 )
 
 type HTTPServerConfig struct {
 	Environment              Environment
+	Service                  string
+	Release                  string
 	Port                     int
 	RequestHeaderMaxSize     *int
 	RequestBodyMaxSize       *int
@@ -56,29 +85,80 @@ type HTTPServerConfig struct {
 	RequestReadHeaderTimeout *time.Duration
 	RequestIPExtractor       *func(*http.Request) string
 	ResponseWriteTimeout     *time.Duration
+	TLSCertPath              *string
+	TLSKeyPath               *string
+	TLSConfig                *tls.Config
+	TLSHTTP2                 *bool
+	UnixSocket               string
+	UnixSocketMode           *os.FileMode
+}
+
+// Validate returns the first invalid field of the config, nil pointers being left to the defaults.
+func (self HTTPServerConfig) Validate() error {
+	switch {
+	case self.UnixSocket == "" && !_isValidPort(self.Port):
+		return ErrHTTPServerGeneric.Raise().With("http server config port %d is out of range", self.Port)
+	case self.RequestHeaderMaxSize != nil && *self.RequestHeaderMaxSize < 1:
+		return ErrHTTPServerGeneric.Raise().With(
+			"http server config request header max size %d is not positive", *self.RequestHeaderMaxSize)
+	case self.RequestBodyMaxSize != nil && *self.RequestBodyMaxSize < 1:
+		return ErrHTTPServerGeneric.Raise().With(
+			"http server config request body max size %d is not positive", *self.RequestBodyMaxSize)
+	case self.RequestFileMaxSize != nil && *self.RequestFileMaxSize < 1:
+		return ErrHTTPServerGeneric.Raise().With(
+			"http server config request file max size %d is not positive", *self.RequestFileMaxSize)
+	case !_isValidTimeout(self.RequestKeepAliveTimeout):
+		return ErrHTTPServerGeneric.Raise().With("http server config request keep alive timeout is not positive")
+	case !_isValidTimeout(self.RequestReadTimeout):
+		return ErrHTTPServerGeneric.Raise().With("http server config request read timeout is not positive")
+	case !_isValidTimeout(self.RequestReadHeaderTimeout):
+		return ErrHTTPServerGeneric.Raise().With("http server config request read header timeout is not positive")
+	case !_isValidTimeout(self.ResponseWriteTimeout):
+		return ErrHTTPServerGeneric.Raise().With("http server config response write timeout is not positive")
+	case (self.TLSCertPath == nil) != (self.TLSKeyPath == nil):
+		return ErrHTTPServerGeneric.Raise().With("http server config tls cert and key paths must be set together")
+	}
+
+	return nil
+}
+
+type HTTPServerRoute struct {
+	Method  string
+	Path    string
+	Handler string
 }
 
 type HTTPServer struct {
 	config   HTTPServerConfig
 	observer *Observer
 	server   *echo.Echo
+	inFlight *atomic.Int64
+	closing  *atomic.Bool
+	metas    *[]_httpServerRouteMeta
 }
 
 func NewHTTPServer(observer *Observer, serializer *Serializer, binder *Binder,
 	renderer *Renderer, errorHandler *ErrorHandler, config HTTPServerConfig) *HTTPServer {
 	util.Merge(&config, _HTTP_SERVER_DEFAULT_CONFIG)
 
+	err := config.Validate()
+	if err != nil {
+		observer.Panic(context.Background(), err)
+	}
+
 	server := echo.New()
 
 	server.HideBanner = true
 	server.HidePort = true
-	server.DisableHTTP2 = true
 	server.Debug = config.Environment == EnvDevelopment
-	server.Server.MaxHeaderBytes = *config.RequestHeaderMaxSize
-	server.Server.IdleTimeout = *config.RequestKeepAliveTimeout
-	server.Server.ReadHeaderTimeout = *config.RequestReadHeaderTimeout
-	server.Server.ReadTimeout = *config.RequestReadTimeout
-	server.Server.WriteTimeout = *config.ResponseWriteTimeout
+
+	for _, httpServer := range []*http.Server{server.Server, server.TLSServer} {
+		httpServer.MaxHeaderBytes = *config.RequestHeaderMaxSize
+		httpServer.IdleTimeout = *config.RequestKeepAliveTimeout
+		httpServer.ReadHeaderTimeout = *config.RequestReadHeaderTimeout
+		httpServer.ReadTimeout = *config.RequestReadTimeout
+		httpServer.WriteTimeout = *config.ResponseWriteTimeout
+	}
 
 	// server.Logger = nil    // Can't fix nil but observer should always be used instead
 	// server.StdLogger = nil // Can't fix nil but observer should always be used instead
@@ -86,23 +166,33 @@ func NewHTTPServer(observer *Observer, serializer *Serializer, binder *Binder,
 	server.Binder = binder
 	server.Renderer = renderer
 	// server.Validator = nil // Can't fix nil but validator should always be at domain level
-	server.HTTPErrorHandler = errorHandler.HandleRequest
+	server.HTTPErrorHandler = _selectErrorHandler(errorHandler.HandleRequest)
 	server.IPExtractor = *config.RequestIPExtractor
 
+	// Decompress before limiting the request bodies so that the limits apply to the decompressed size
+	server.Pre(_decompressBody)
+
 	requestFilePattern := regexp.MustCompile(*config.RequestFilePattern)
-	server.Pre(echoMiddleware.BodyLimitWithConfig(echoMiddleware.BodyLimitConfig{
-		Skipper: func(ctx echo.Context) bool {
-			return requestFilePattern.MatchString(ctx.Request().RequestURI)
-		},
-		Limit: util.ByteSize(*config.RequestBodyMaxSize),
-	}))
-	server.Pre(echoMiddleware.BodyLimitWithConfig(echoMiddleware.BodyLimitConfig{
-		Limit: util.ByteSize(*config.RequestFileMaxSize),
-	}))
+	requestBodyLimit := min(*config.RequestBodyMaxSize, *config.RequestFileMaxSize)
+	requestFileLimit := *config.RequestFileMaxSize
+	server.Pre(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if requestFilePattern.MatchString(ctx.Request().RequestURI) {
+				return _limitBody(ctx, requestFileLimit, next)
+			}
+
+			return _limitBody(ctx, requestBodyLimit, next)
+		}
+	})
+
+	inFlight := &atomic.Int64{}
 
 	// Pre hook middleware
 	server.Pre(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(ctx echo.Context) error {
+			inFlight.Add(1)
+			defer inFlight.Add(-1)
+
 			ctx.Request().RemoteAddr = ctx.RealIP()
 			return next(ctx)
 		}
@@ -112,10 +202,163 @@ func NewHTTPServer(observer *Observer, serializer *Serializer, binder *Binder,
 		config:   config,
 		observer: observer,
 		server:   server,
+		inFlight: inFlight,
+		closing:  &atomic.Bool{},
+		metas:    &[]_httpServerRouteMeta{},
+	}
+}
+
+type _decompressedBody struct {
+	io.Reader
+	decompressor io.Closer
+	body         io.Closer
+}
+
+func (self _decompressedBody) Close() error {
+	self.decompressor.Close()
+	return self.body.Close()
+}
+
+// _decompressBody transparently decompresses gzip and deflate request bodies.
+func _decompressBody(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		request := ctx.Request()
+
+		var decompressor io.ReadCloser
+		var err error
+
+		switch strings.ToLower(strings.TrimSpace(request.Header.Get(echo.HeaderContentEncoding))) {
+		case "gzip", "x-gzip":
+			decompressor, err = gzip.NewReader(request.Body)
+		case "deflate":
+			decompressor, err = zlib.NewReader(request.Body)
+		default:
+			return next(ctx)
+		}
+
+		if err != nil {
+			return HTTPErrInvalidRequest.Cause(ErrHTTPServerGeneric.Raise().With("cannot decompress request body").Cause(err))
+		}
+
+		request.Body = _decompressedBody{
+			Reader:       decompressor,
+			decompressor: decompressor,
+			body:         request.Body,
+		}
+
+		// The decompressed size is unknown until the body is read
+		request.ContentLength = -1
+		request.Header.Del(echo.HeaderContentEncoding)
+		request.Header.Del(echo.HeaderContentLength)
+
+		return next(ctx)
+	}
+}
+
+// _limitedBody fails the reads of a request body past its limit, either declared upfront or while
+// being read. The limit can be overridden, see SetRequestBodyLimit, until the body is read.
+type _limitedBody struct {
+	io.ReadCloser
+	limit    int
+	declared int64
+	read     int64
+}
+
+func (self *_limitedBody) Read(p []byte) (int, error) {
+	if self.declared > int64(self.limit) || self.read > int64(self.limit) {
+		return 0, echo.ErrStatusRequestEntityTooLarge
+	}
+
+	n, err := self.ReadCloser.Read(p)
+	self.read += int64(n)
+
+	if self.read > int64(self.limit) {
+		return n, echo.ErrStatusRequestEntityTooLarge
+	}
+
+	return n, err
+}
+
+// _limitBody limits the request body and rejects the requests whose payload exceeds
+// the limit with an HTTP error carrying the limit so that they go through the error handler.
+func _limitBody(ctx echo.Context, limit int, next echo.HandlerFunc) error {
+	request := ctx.Request()
+
+	body := &_limitedBody{
+		ReadCloser: request.Body,
+		limit:      limit,
+		declared:   request.ContentLength,
+	}
+
+	request.Body = body
+	ctx.Set(string(KeyHTTPServerBodyLimit), body)
+
+	err := next(ctx)
+	if err != nil && util.Is(err, echo.ErrStatusRequestEntityTooLarge) {
+		humanLimit := util.ByteSize(body.limit)
+
+		return HTTPErrPayloadTooLarge.
+			WithMessage(fmt.Sprintf("request payload exceeds the %s limit", humanLimit)).
+			Cause(ErrHTTPServerPayloadLimit.Raise(humanLimit).Cause(err))
+	}
+
+	return err
+}
+
+// SetRequestBodyLimit overrides the body limit of the request, either raising or lowering it, so it takes
+// precedence over the server RequestBodyMaxSize and RequestFileMaxSize limits. It has to be set before the
+// body is read, for example through a route or group BodyLimit middleware.
+func SetRequestBodyLimit(ctx echo.Context, limit int) {
+	if body, ok := ctx.Get(string(KeyHTTPServerBodyLimit)).(*_limitedBody); ok {
+		body.limit = limit
+		return
+	}
+
+	request := ctx.Request()
+
+	body := &_limitedBody{
+		ReadCloser: request.Body,
+		limit:      limit,
+		declared:   request.ContentLength,
+	}
+
+	request.Body = body
+	ctx.Set(string(KeyHTTPServerBodyLimit), body)
+}
+
+// HTTPRequestContext holds what handlers commonly reach for from the request, see RequestContext.
+type HTTPRequestContext struct {
+	Context   context.Context
+	RequestID string
+	TraceID   string
+	IP        string
+	Logger    *zerolog.Logger
+}
+
+// RequestContext returns the request context enriched by the middlewares along with its request ID, trace ID,
+// client IP, already resolved to the real IP, and request-scoped logger. Values whose middleware is not in
+// use are left empty while the logger falls back to the one of the context.
+func RequestContext(ctx echo.Context) HTTPRequestContext {
+	request := ctx.Request()
+	requestCtx := request.Context()
+
+	requestID, _ := Context.RequestID(requestCtx)
+	traceID, _ := Context.TraceID(requestCtx)
+
+	return HTTPRequestContext{
+		Context:   requestCtx,
+		RequestID: requestID,
+		TraceID:   traceID,
+		IP:        request.RemoteAddr,
+		Logger:    LoggerFromContext(requestCtx),
 	}
 }
 
 func (self *HTTPServer) Run(ctx context.Context) error {
+	if self.config.UnixSocket != "" {
+		return self.runUnix(ctx)
+	}
+
 	self.observer.Infof(ctx, "HTTP Server started at port %d", self.config.Port)
 
 	err := self.server.Start(fmt.Sprintf(":%d", self.config.Port))
@@ -126,10 +369,133 @@ func (self *HTTPServer) Run(ctx context.Context) error {
 	return nil
 }
 
+func (self *HTTPServer) runUnix(ctx context.Context) error {
+	// Remove the socket file possibly left behind by a previous unclean shutdown
+	err := os.Remove(self.config.UnixSocket)
+	if err != nil && !os.IsNotExist(err) {
+		return ErrHTTPServerGeneric.Raise().Cause(err)
+	}
+
+	listener, err := net.Listen("unix", self.config.UnixSocket)
+	if err != nil {
+		return ErrHTTPServerGeneric.Raise().Cause(err)
+	}
+
+	err = os.Chmod(self.config.UnixSocket, *self.config.UnixSocketMode)
+	if err != nil {
+		listener.Close()
+		return ErrHTTPServerGeneric.Raise().Cause(err)
+	}
+
+	self.server.Listener = listener
+
+	self.observer.Infof(ctx, "HTTP Server started at unix socket %s", self.config.UnixSocket)
+
+	err = self.server.Start("")
+	if err != nil && err != http.ErrServerClosed {
+		return ErrHTTPServerGeneric.Raise().Cause(err)
+	}
+
+	return nil
+}
+
+func (self *HTTPServer) RunTLS(ctx context.Context) error {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if self.config.TLSConfig != nil {
+		tlsConfig = self.config.TLSConfig.Clone()
+	}
+
+	if self.config.TLSCertPath != nil && self.config.TLSKeyPath != nil {
+		certificate, err := tls.LoadX509KeyPair(*self.config.TLSCertPath, *self.config.TLSKeyPath)
+		if err != nil {
+			return ErrHTTPServerGeneric.Raise().Cause(err)
+		}
+
+		tlsConfig.Certificates = append(tlsConfig.Certificates, certificate)
+	}
+
+	if len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil {
+		return ErrHTTPServerGeneric.Raise().With("no TLS certificate provided")
+	}
+
+	// HTTP2 is only negotiated through TLS (ALPN) when explicitly enabled. The protocols have to be set
+	// on the TLS config itself as the server is started with an already configured TLS listener
+	nextProtos := make([]string, 0, len(tlsConfig.NextProtos)+2)
+	if *self.config.TLSHTTP2 {
+		nextProtos = append(nextProtos, _HTTP_SERVER_HTTP2_PROTOCOL)
+	}
+
+	for _, protocol := range tlsConfig.NextProtos {
+		if protocol != _HTTP_SERVER_HTTP2_PROTOCOL && protocol != _HTTP_SERVER_HTTP1_PROTOCOL {
+			nextProtos = append(nextProtos, protocol)
+		}
+	}
+
+	tlsConfig.NextProtos = append(nextProtos, _HTTP_SERVER_HTTP1_PROTOCOL)
+
+	self.server.TLSServer.Addr = fmt.Sprintf(":%d", self.config.Port)
+	self.server.TLSServer.TLSConfig = tlsConfig
+
+	self.observer.Infof(ctx, "HTTPS Server started at port %d", self.config.Port)
+
+	err := self.server.StartServer(self.server.TLSServer)
+	if err != nil && err != http.ErrServerClosed {
+		return ErrHTTPServerGeneric.Raise().Cause(err)
+	}
+
+	return nil
+}
+
+// Health fails as soon as the server starts closing, so that it stops receiving new requests while draining.
+func (self *HTTPServer) Health(ctx context.Context) error {
+	if self.closing.Load() {
+		return ErrHTTPServerUnhealthy.Raise().With("server closing")
+	}
+
+	if self.server.ListenerAddr() == nil && self.server.TLSListenerAddr() == nil {
+		return ErrHTTPServerUnhealthy.Raise().With("server not listening")
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return ErrHTTPServerUnhealthy.Raise().Cause(err)
+	}
+
+	return nil
+}
+
 func (self *HTTPServer) Use(middleware ...echo.MiddlewareFunc) {
 	self.server.Pre(middleware...)
 }
 
+// _selectErrorHandler handles the errors with the error handler of the innermost group
+// of the route, if any was set through ErrorHandler, or otherwise with the fallback.
+func _selectErrorHandler(fallback echo.HTTPErrorHandler) echo.HTTPErrorHandler {
+	return func(err error, ctx echo.Context) {
+		if handler, ok := ctx.Get(string(KeyHTTPServerErrorHandler)).(echo.HTTPErrorHandler); ok {
+			handler(err, ctx)
+			return
+		}
+
+		fallback(err, ctx)
+	}
+}
+
+// ErrorHandler returns the middleware that overrides the server error handler for the routes of the group,
+// such as Default or Host, that it is passed to, for example to serialize the errors of webhooks differently.
+// It should be passed first so that the errors of the rest of the group middleware are also handled by it.
+func (self *HTTPServer) ErrorHandler(handler echo.HTTPErrorHandler) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(string(KeyHTTPServerErrorHandler), handler)
+			return next(ctx)
+		}
+	}
+}
+
 func (self *HTTPServer) Host(host string, middleware ...echo.MiddlewareFunc) *echo.Group {
 	return self.server.Host(host, middleware...)
 }
@@ -138,23 +504,103 @@ func (self *HTTPServer) Default(middleware ...echo.MiddlewareFunc) *echo.Group {
 	return self.server.Group("", middleware...)
 }
 
+// Group returns the group of routes under prefix whose errors are handled by errorHandler,
+// or by the server error handler when it is nil.
+func (self *HTTPServer) Group(prefix string, errorHandler echo.HTTPErrorHandler,
+	middleware ...echo.MiddlewareFunc) *echo.Group {
+	if errorHandler != nil {
+		middleware = append([]echo.MiddlewareFunc{self.ErrorHandler(errorHandler)}, middleware...)
+	}
+
+	return self.server.Group(prefix, middleware...)
+}
+
+func (self *HTTPServer) Static(prefix string, root string, middleware ...echo.MiddlewareFunc) *echo.Group {
+	return self.server.Group(prefix, append([]echo.MiddlewareFunc{
+		echoMiddleware.StaticWithConfig(echoMiddleware.StaticConfig{
+			Root: root,
+		})}, middleware...)...)
+}
+
+// SPA serves the files found under root and falls back to the index file for any other path
+// so that client side routing works. Routes are left untouched as the fallback only applies to not found paths.
+func (self *HTTPServer) SPA(prefix string, root string, index string, middleware ...echo.MiddlewareFunc) *echo.Group {
+	return self.server.Group(prefix, append([]echo.MiddlewareFunc{
+		echoMiddleware.StaticWithConfig(echoMiddleware.StaticConfig{
+			Root:  root,
+			Index: index,
+			HTML5: true,
+		})}, middleware...)...)
+}
+
+// Add registers the route along with its metadata, used to document it in the OpenAPI document.
+func (self *HTTPServer) Add(method string, path string, handler echo.HandlerFunc, meta HTTPServerRouteMeta,
+	middleware ...echo.MiddlewareFunc) *echo.Route {
+	route := self.server.Add(method, path, handler, middleware...)
+
+	*self.metas = append(*self.metas, _httpServerRouteMeta{
+		method: method,
+		path:   path,
+		meta:   meta,
+	})
+
+	return route
+}
+
+func (self *HTTPServer) Routes() []HTTPServerRoute {
+	routes := make([]HTTPServerRoute, 0, len(self.server.Routes()))
+
+	for _, route := range self.server.Routes() {
+		routes = append(routes, HTTPServerRoute{
+			Method:  route.Method,
+			Path:    route.Path,
+			Handler: route.Name,
+		})
+	}
+
+	return routes
+}
+
+func (self *HTTPServer) Reverse(name string, params ...any) string {
+	return self.server.Reverse(name, params...)
+}
+
 func (self *HTTPServer) Close(ctx context.Context) error {
 	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
-		self.observer.Info(ctx, "Closing HTTP server")
+		self.observer.Infof(ctx, "Closing HTTP server with %d in-flight requests", self.inFlight.Load())
+
+		self.closing.Store(true)
 
 		self.server.Server.SetKeepAlivesEnabled(false)
+		self.server.TLSServer.SetKeepAlivesEnabled(false)
 
 		err := self.server.Shutdown(ctx)
 		if err != nil {
+			if inFlight := self.inFlight.Load(); inFlight > 0 {
+				return ErrHTTPServerDrainTimedOut.Raise(inFlight).Cause(err)
+			}
+
 			return ErrHTTPServerGeneric.Raise().Cause(err)
 		}
 
+		if self.config.UnixSocket != "" {
+			err = os.Remove(self.config.UnixSocket)
+			if err != nil && !os.IsNotExist(err) {
+				return ErrHTTPServerGeneric.Raise().Cause(err)
+			}
+		}
+
 		self.observer.Info(ctx, "Closed HTTP server")
 
 		return nil
 	})
 	if err != nil {
 		if util.ErrDeadlineExceeded.Is(err) {
+			if inFlight := self.inFlight.Load(); inFlight > 0 {
+				self.observer.Warnf(ctx, "HTTP server closed with %d in-flight requests", inFlight)
+				return ErrHTTPServerDrainTimedOut.Raise(inFlight).Cause(err)
+			}
+
 			return ErrHTTPServerTimedOut.Raise().Cause(err)
 		}
 
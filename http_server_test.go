@@ -0,0 +1,35 @@
+package kit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestHTTPServerGroupErrorHandler(t *testing.T) {
+	server := &HTTPServer{server: echo.New()}
+	server.server.HTTPErrorHandler = _selectErrorHandler(func(err error, ctx echo.Context) {
+		ctx.String(http.StatusInternalServerError, "server") // nolint:errcheck
+	})
+
+	failing := func(ctx echo.Context) error {
+		return errors.New("failing")
+	}
+
+	server.Default().GET("/api", failing)
+	server.Group("/webhooks", func(err error, ctx echo.Context) {
+		ctx.String(http.StatusOK, err.Error()) // nolint:errcheck
+	}).GET("/event", failing)
+
+	for path, expected := range map[string]string{"/api": "server", "/webhooks/event": "failing"} {
+		recorder := httptest.NewRecorder()
+		server.server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if recorder.Body.String() != expected {
+			t.Fatalf("expected %s error to be handled by %s, got %s", path, expected, recorder.Body.String())
+		}
+	}
+}
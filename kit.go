@@ -2,7 +2,17 @@
 package kit
 
 import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"syscall"
 	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+
+	"github.com/neoxelox/kit/util"
 )
 
 type Environment string
@@ -17,9 +27,169 @@ type Key string
 
 var KeyBase Key = "kit:"
 
+// HealthChecker is implemented by the components whose health can be checked, so that
+// they can be aggregated, for example, by a readiness endpoint.
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
+
+var (
+	_ HealthChecker = (*Observer)(nil)
+	_ HealthChecker = (*Database)(nil)
+	_ HealthChecker = (*Cache)(nil)
+	_ HealthChecker = (*HTTPServer)(nil)
+	_ HealthChecker = (*Worker)(nil)
+)
+
+// _retryAttemptLevel logs the first attempt at Info, the intermediate ones at Debug and the last one at Warn,
+// so that retrying against a dependency that is briefly unavailable, for example on deploys, does not spam logs.
+func _retryAttemptLevel(attempt int, attempts int) Level {
+	switch {
+	case attempt <= 1:
+		return LvlInfo
+	case attempt >= attempts:
+		return LvlWarn
+	default:
+		return LvlDebug
+	}
+}
+
+// RetryConfig Jitter randomizes each backoff delay by up to ±Jitter (a factor between 0 and 1).
+// It defaults to 0 which keeps the exponential backoff deterministic.
+// Only the errors matching any of the Retriables are retried, all of them when it is empty,
+// except for the Database and Cache which default to the NetworkRetriables.
+// MaxElapsed, when positive, stops retrying once the time since the first attempt exceeds it,
+// returning the last error, so that many attempts with long delays cannot outlive their callers.
 type RetryConfig struct {
 	Attempts     int
 	InitialDelay time.Duration
 	LimitDelay   time.Duration
+	Jitter       float64
+	MaxElapsed   time.Duration
 	Retriables   []error
 }
+
+// NetworkRetriables are the transient network errors, such as refused or reset connections and timeouts,
+// worth retrying when connecting to a dependency. Any other error, such as an authentication failure, fails fast.
+var NetworkRetriables = []error{
+	syscall.ECONNREFUSED,
+	syscall.ECONNRESET,
+	syscall.ECONNABORTED,
+	syscall.EHOSTUNREACH,
+	syscall.ENETUNREACH,
+	syscall.ETIMEDOUT,
+	syscall.EPIPE,
+	io.EOF,
+	io.ErrUnexpectedEOF,
+	os.ErrDeadlineExceeded,
+	context.DeadlineExceeded,
+}
+
+var (
+	_CIRCUIT_BREAKER_DEFAULT_CONFIG = CircuitBreakerConfig{
+		Failures:  util.Pointer(5),
+		Successes: util.Pointer(1),
+		Timeout:   util.Pointer(30 * time.Second),
+	}
+)
+
+// CircuitBreakerConfig opens the breaker after Failures connection failures, failing fast until, once Timeout
+// has elapsed, Successes consecutive calls succeed and the breaker closes again.
+type CircuitBreakerConfig struct {
+	Failures  *int
+	Successes *int
+	Timeout   *time.Duration
+}
+
+func _newCircuitBreaker(config *CircuitBreakerConfig) *util.CircuitBreaker {
+	if config == nil {
+		return nil
+	}
+
+	_config := *config
+	util.Merge(&_config, _CIRCUIT_BREAKER_DEFAULT_CONFIG)
+
+	return util.NewCircuitBreaker(*_config.Failures, *_config.Successes, *_config.Timeout)
+}
+
+func _isValidPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// _isValidTimeout reports whether the timeout, if set, is positive.
+func _isValidTimeout(timeout *time.Duration) bool {
+	return timeout == nil || *timeout > 0
+}
+
+// _isConnectionFailure reports whether err is caused by the dependency being unreachable. The cancellations
+// and deadlines of the callers themselves, as well as query or input errors, are not connection failures.
+func _isConnectionFailure(err error) bool {
+	if err == nil || util.Is(err, context.Canceled, context.DeadlineExceeded, os.ErrDeadlineExceeded) {
+		return false
+	}
+
+	for cause := err; cause != nil; cause = util.Unwrap(cause) {
+		if _, ok := cause.(*net.OpError); ok { // nolint:errorlint
+			return true
+		}
+	}
+
+	return util.Is(err, NetworkRetriables...)
+}
+
+// RetryableErrors are the transient errors worth retrying with backoff by clients or workers.
+// Applications can append their own at startup.
+var RetryableErrors = []error{
+	ErrDatabaseTimedOut,
+	ErrDatabaseUnavailable,
+	ErrDatabaseSerialization,
+	ErrCacheTimedOut,
+	ErrCacheUnavailable,
+	ErrHTTPClientTimedOut,
+	ErrHTTPClientServerError,
+}
+
+// IsRetryable reports whether err is transient, either because it is a retryable HTTP error, it matches
+// any of the RetryableErrors or it is caused by a database serialization failure or deadlock.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if util.Is(err, RetryableErrors...) {
+		return true
+	}
+
+	for cause := err; cause != nil; cause = util.Unwrap(cause) {
+		switch cause := cause.(type) { // nolint:errorlint
+		case HTTPError:
+			if cause.Retryable() {
+				return true
+			}
+		case *HTTPError:
+			if cause.Retryable() {
+				return true
+			}
+		case *pgconn.PgError:
+			if cause.Code == pgerrcode.SerializationFailure || cause.Code == pgerrcode.DeadlockDetected {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// PermanentErrors are the errors that fail again however many times they are retried, such as malformed
+// payloads or constraint violations, so workers do not retry them. Applications can append their own at startup.
+var PermanentErrors = []error{
+	ErrWorkerBadPayload,
+	ErrDatabaseIntegrityViolation,
+	ErrCacheSerialization,
+}
+
+// IsPermanent reports whether err matches any of the PermanentErrors and is not retryable.
+// Errors that are neither permanent nor retryable are unknown and retried as usual.
+func IsPermanent(err error) bool {
+	return err != nil && !IsRetryable(err) && util.Is(err, PermanentErrors...)
+}
@@ -0,0 +1,88 @@
+package kit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-redis/cache/v8"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+
+	"github.com/neoxelox/kit/util"
+)
+
+func TestDatabaseErrorChain(t *testing.T) {
+	err := ErrDatabaseTransactionFailed.Raise().Cause(_dbErrToError(pgx.ErrNoRows))
+
+	if !util.Is(err, ErrDatabaseNoRows) {
+		t.Fatalf("expected no rows error in chain")
+	}
+
+	if !errors.Is(util.RootCause(err), pgx.ErrNoRows) {
+		t.Fatalf("expected pgx no rows as root cause, got %v", util.RootCause(err))
+	}
+
+	pgErr := &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+	err = ErrDatabaseTransactionFailed.Raise().Cause(_dbErrToError(pgErr))
+
+	if !util.Is(err, ErrDatabaseSerialization) || !IsRetryable(err) {
+		t.Fatalf("expected retryable serialization failure in chain")
+	}
+
+	err = _dbErrToError(context.DeadlineExceeded)
+
+	if !ErrDatabaseTimedOut.Is(err) || !util.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timed out error caused by the deadline")
+	}
+}
+
+func TestCacheErrorChain(t *testing.T) {
+	err := _chErrToError(cache.ErrCacheMiss)
+
+	if !util.Is(err, ErrCacheMiss) || util.RootCause(err) != cache.ErrCacheMiss { // nolint:errorlint
+		t.Fatalf("expected cache miss caused by the library cache miss")
+	}
+
+	if len(util.Chain(err)) != 2 {
+		t.Fatalf("expected 2 errors in chain, got %v", util.Chain(err))
+	}
+
+	if IsRetryable(err) {
+		t.Fatalf("expected cache miss not to be retryable")
+	}
+
+	errCodec := errors.New("codec")
+	err = _chSerializationErrToError(_chErrToError(_cacheSerializationError{errCodec}), "key", 1)
+
+	if !ErrCacheSerialization.Is(err) || util.RootCause(err) != errCodec || !IsPermanent(err) { // nolint:errorlint
+		t.Fatalf("expected permanent cache serialization caused by the codec error")
+	}
+}
+
+func TestWorkerErrorChain(t *testing.T) {
+	errTask := errors.New("task")
+	err := ErrWorkerTimedOut.Raise().Cause(ErrWorkerGeneric.Raise().Cause(errTask))
+
+	chain := util.Chain(err)
+	if len(chain) != 3 {
+		t.Fatalf("expected 3 errors in chain, got %v", chain)
+	}
+
+	if !util.Is(err, ErrWorkerGeneric) || !errors.Is(util.RootCause(err), errTask) {
+		t.Fatalf("expected worker generic error and task root cause in chain")
+	}
+}
+
+func TestHTTPErrorChain(t *testing.T) {
+	err := HTTPErrServerUnavailable.Cause(ErrCacheUnavailable.Raise().Cause(util.ErrCircuitBreakerOpen.Raise()))
+
+	if !util.Is(err, ErrCacheUnavailable) || !util.Is(err, util.ErrCircuitBreakerOpen) {
+		t.Fatalf("expected cache unavailable and circuit breaker open in chain")
+	}
+
+	if !IsRetryable(err) {
+		t.Fatalf("expected cache unavailable to be retryable")
+	}
+}
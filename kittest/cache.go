@@ -0,0 +1,274 @@
+package kittest
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/neoxelox/kit"
+)
+
+type _cacheEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// Cache is a map-backed in-memory fake of kit.Cache.
+type Cache struct {
+	mutex   sync.Mutex
+	entries map[string]_cacheEntry
+}
+
+var _ kit.Cacher = (*Cache)(nil)
+
+func NewCache() *Cache {
+	return &Cache{
+		entries: make(map[string]_cacheEntry),
+	}
+}
+
+func (self *Cache) get(key string) (_cacheEntry, bool) {
+	entry, ok := self.entries[key]
+	if !ok {
+		return entry, false
+	}
+
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		delete(self.entries, key)
+		return entry, false
+	}
+
+	return entry, true
+}
+
+func (self *Cache) set(key string, data []byte, ttl *time.Duration) {
+	entry := _cacheEntry{
+		data: data,
+	}
+
+	if ttl != nil && *ttl > 0 {
+		entry.expiresAt = time.Now().Add(*ttl)
+	}
+
+	self.entries[key] = entry
+}
+
+func (self *Cache) Set(ctx context.Context, key string, value any, ttl *time.Duration) error {
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		return kit.ErrCacheSerialization.Raise().
+			Extra(map[string]any{"key": key, "type": fmt.Sprintf("%T", value)}).Cause(err)
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.set(key, data, ttl)
+
+	return nil
+}
+
+func (self *Cache) Get(ctx context.Context, key string, dest any) error {
+	self.mutex.Lock()
+	entry, ok := self.get(key)
+	self.mutex.Unlock()
+
+	if !ok {
+		return kit.ErrCacheMiss.Raise()
+	}
+
+	err := msgpack.Unmarshal(entry.data, dest)
+	if err != nil {
+		return kit.ErrCacheSerialization.Raise().
+			Extra(map[string]any{"key": key, "type": fmt.Sprintf("%T", dest)}).Cause(err)
+	}
+
+	return nil
+}
+
+func (self *Cache) TryGet(ctx context.Context, key string, dest any) (bool, error) {
+	err := self.Get(ctx, key, dest)
+	if err != nil {
+		if kit.ErrCacheMiss.Is(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetOrSet does not coalesce concurrent loads as the fake Cache is meant for sequential tests.
+func (self *Cache) GetOrSet(ctx context.Context, key string, dest any, ttl *time.Duration,
+	load func() (any, error)) error {
+	hit, err := self.TryGet(ctx, key, dest)
+	if err != nil || hit {
+		return err
+	}
+
+	value, err := load()
+	if err != nil {
+		return err
+	}
+
+	err = self.Set(ctx, key, value, ttl)
+	if err != nil {
+		return err
+	}
+
+	return self.Get(ctx, key, dest)
+}
+
+func (self *Cache) SetNX(ctx context.Context, key string, value any, ttl *time.Duration) (bool, error) {
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		return false, kit.ErrCacheSerialization.Raise().
+			Extra(map[string]any{"key": key, "type": fmt.Sprintf("%T", value)}).Cause(err)
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if _, ok := self.get(key); ok {
+		return false, nil
+	}
+
+	self.set(key, data, ttl)
+
+	return true, nil
+}
+
+func (self *Cache) SetIfNewer(ctx context.Context, key string, value any, version int64,
+	ttl *time.Duration) (bool, error) {
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		return false, kit.ErrCacheSerialization.Raise().
+			Extra(map[string]any{"key": key, "type": fmt.Sprintf("%T", value)}).Cause(err)
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	versionKey := key + ":version"
+
+	if entry, ok := self.get(versionKey); ok {
+		current, err := strconv.ParseInt(string(entry.data), 10, 64) // nolint:govet
+		if err != nil {
+			return false, kit.ErrCacheGeneric.Raise().Cause(err)
+		}
+
+		if current >= version {
+			return false, nil
+		}
+	}
+
+	self.set(key, data, ttl)
+	self.set(versionKey, []byte(strconv.FormatInt(version, 10)), ttl)
+
+	return true, nil
+}
+
+func (self *Cache) Increment(ctx context.Context, key string, delta int, ttl *time.Duration) (int, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	counter := 0
+
+	entry, ok := self.get(key)
+	if ok {
+		var err error
+
+		counter, err = strconv.Atoi(string(entry.data))
+		if err != nil {
+			return 0, kit.ErrCacheGeneric.Raise().Cause(err)
+		}
+	}
+
+	counter += delta
+
+	if ttl == nil && ok {
+		entry.data = []byte(strconv.Itoa(counter))
+		self.entries[key] = entry
+	} else {
+		self.set(key, []byte(strconv.Itoa(counter)), ttl)
+	}
+
+	return counter, nil
+}
+
+func (self *Cache) Counter(ctx context.Context, key string) (int, error) {
+	self.mutex.Lock()
+	entry, ok := self.get(key)
+	self.mutex.Unlock()
+
+	if !ok {
+		return 0, nil
+	}
+
+	counter, err := strconv.Atoi(string(entry.data))
+	if err != nil {
+		return 0, kit.ErrCacheGeneric.Raise().Cause(err)
+	}
+
+	return counter, nil
+}
+
+func (self *Cache) Delete(ctx context.Context, key string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	delete(self.entries, key)
+
+	return nil
+}
+
+// Find matches the keys with shell patterns, which are close but not identical to the Redis glob-style patterns.
+func (self *Cache) Find(ctx context.Context, pattern string) ([]string, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	keys := []string{}
+
+	for key := range self.entries {
+		if _, ok := self.get(key); !ok {
+			continue
+		}
+
+		match, err := path.Match(pattern, key)
+		if err != nil {
+			return nil, kit.ErrCacheGeneric.Raise().Cause(err)
+		}
+
+		if match {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Scan calls fn with the keys found by Find, outside the lock so that fn can use the cache.
+func (self *Cache) Scan(ctx context.Context, pattern string, fn func(key string) error) error {
+	keys, err := self.Find(ctx, pattern)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		err := fn(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
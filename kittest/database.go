@@ -0,0 +1,166 @@
+package kittest
+
+import (
+	"context"
+	"regexp"
+	"sync"
+
+	"github.com/leporo/sqlf"
+
+	"github.com/neoxelox/kit"
+)
+
+// Statement is a query or command received by the fake Database.
+type Statement struct {
+	SQL  string
+	Args []any
+}
+
+var (
+	_keyDatabaseTransaction kit.Key = kit.KeyBase + "kittest:database:transaction"
+)
+
+type _databaseQueryHandler struct {
+	pattern *regexp.Regexp
+	fn      func(stmt Statement, dest ...any) error
+}
+
+type _databaseExecHandler struct {
+	pattern *regexp.Regexp
+	fn      func(stmt Statement) (int, error)
+}
+
+// Database is an in-memory fake of kit.Database whose results are stubbed with handlers
+// matched, in registration order, against the SQL of the statements.
+// Unmatched queries return kit.ErrDatabaseNoRows and unmatched commands affect 0 rows.
+type Database struct {
+	mutex      sync.Mutex
+	queries    []_databaseQueryHandler
+	execs      []_databaseExecHandler
+	statements []Statement
+}
+
+var _ kit.Querier = (*Database)(nil)
+
+func NewDatabase() *Database {
+	return &Database{
+		queries:    []_databaseQueryHandler{},
+		execs:      []_databaseExecHandler{},
+		statements: []Statement{},
+	}
+}
+
+// OnQuery stubs the queries whose SQL matches the pattern, fn should fill the statement destinations.
+func (self *Database) OnQuery(pattern string, fn func(stmt Statement, dest ...any) error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.queries = append(self.queries, _databaseQueryHandler{
+		pattern: regexp.MustCompile(pattern),
+		fn:      fn,
+	})
+}
+
+// OnExec stubs the commands whose SQL matches the pattern, fn should return the affected rows.
+func (self *Database) OnExec(pattern string, fn func(stmt Statement) (int, error)) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.execs = append(self.execs, _databaseExecHandler{
+		pattern: regexp.MustCompile(pattern),
+		fn:      fn,
+	})
+}
+
+// Statements returns the statements received so far in order.
+func (self *Database) Statements() []Statement {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return append([]Statement{}, self.statements...)
+}
+
+func (self *Database) record(stmt *sqlf.Stmt) Statement {
+	statement := Statement{
+		SQL:  stmt.String(),
+		Args: append([]any{}, stmt.Args()...),
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.statements = append(self.statements, statement)
+
+	return statement
+}
+
+func (self *Database) Query(ctx context.Context, stmt *sqlf.Stmt) error {
+	defer stmt.Close()
+
+	statement := self.record(stmt)
+
+	return self.query(statement, stmt.Dest())
+}
+
+func (self *Database) query(statement Statement, dest []any) error {
+	self.mutex.Lock()
+	handlers := self.queries
+	self.mutex.Unlock()
+
+	for _, handler := range handlers {
+		if handler.pattern.MatchString(statement.SQL) {
+			return handler.fn(statement, dest...)
+		}
+	}
+
+	return kit.ErrDatabaseNoRows.Raise()
+}
+
+// QueryRow is stubbed by the OnQuery handlers, which receive dest or otherwise the statement destinations.
+func (self *Database) QueryRow(ctx context.Context, stmt *sqlf.Stmt, dest ...any) error {
+	defer stmt.Close()
+
+	statement := self.record(stmt)
+	if len(dest) == 0 {
+		dest = stmt.Dest()
+	}
+
+	return self.query(statement, dest)
+}
+
+func (self *Database) Exec(ctx context.Context, stmt *sqlf.Stmt) (int, error) {
+	defer stmt.Close()
+
+	statement := self.record(stmt)
+
+	self.mutex.Lock()
+	handlers := self.execs
+	self.mutex.Unlock()
+
+	for _, handler := range handlers {
+		if handler.pattern.MatchString(statement.SQL) {
+			return handler.fn(statement)
+		}
+	}
+
+	return 0, nil
+}
+
+// Transaction runs fn directly, in a single attempt, as the fake Database has no isolation nor rollbacks.
+func (self *Database) Transaction(
+	ctx context.Context, level *kit.IsolationLevel, fn func(ctx context.Context) error) error {
+	if !self.InTransaction(ctx) {
+		ctx = kit.Context.WithTransactionAttempt(ctx, 1)
+	}
+
+	err := fn(context.WithValue(ctx, _keyDatabaseTransaction, true))
+	if err != nil {
+		return kit.ErrDatabaseTransactionFailed.Raise().Cause(err)
+	}
+
+	return nil
+}
+
+func (self *Database) InTransaction(ctx context.Context) bool {
+	return ctx.Value(_keyDatabaseTransaction) != nil
+}
@@ -19,6 +19,7 @@ import (
 // TODO: enhance localization with go-i18n, go-localize or spreak
 
 var (
+	// Deprecated: KeyLocalizerLocale is no longer set by kit, use Context.Locale instead.
 	KeyLocalizerLocale Key = KeyBase + "localizer:locale"
 )
 
@@ -43,6 +44,7 @@ type Localizer struct {
 	config     LocalizerConfig
 	observer   *Observer
 	copies     map[language.Tag]map[string]string
+	registered map[language.Tag]map[string]string
 	extensions *regexp.Regexp
 }
 
@@ -62,6 +64,7 @@ func NewLocalizer(observer *Observer, config LocalizerConfig) (*Localizer, error
 		config:     config,
 		observer:   observer,
 		copies:     copiesByLang,
+		registered: make(map[language.Tag]map[string]string),
 		extensions: extensions,
 	}, nil
 }
@@ -131,17 +134,63 @@ func (self *Localizer) Refresh() error {
 		return err
 	}
 
+	for locale, copies := range self.registered {
+		_mergeCopies(copiesByLang, locale, copies)
+	}
+
 	self.copies = copiesByLang
 
 	return nil
 }
 
+// Register adds a catalog of copies for a locale on top of the loaded ones, surviving refreshes.
+// Copies are keyed in uppercase, for example by HTTP error code. It is meant to be called at startup.
+func (self *Localizer) Register(locale language.Tag, copies map[string]string) {
+	_mergeCopies(self.registered, locale, copies)
+	_mergeCopies(self.copies, locale, copies)
+}
+
+func _mergeCopies(copiesByLang map[language.Tag]map[string]string, locale language.Tag, copies map[string]string) {
+	if copiesByLang[locale] == nil {
+		copiesByLang[locale] = make(map[string]string, len(copies))
+	}
+
+	for copy, trans := range copies {
+		copiesByLang[locale][strings.ToUpper(copy)] = trans
+	}
+}
+
+// ParseLocale matches the Accept-Language header against the loaded locales,
+// falling back to the default locale when none of them is acceptable.
+func (self Localizer) ParseLocale(acceptLanguage string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return self.config.DefaultLocale
+	}
+
+	supported := make([]language.Tag, 0, len(self.copies)+1)
+	supported = append(supported, self.config.DefaultLocale)
+
+	for locale := range self.copies {
+		if locale != self.config.DefaultLocale {
+			supported = append(supported, locale)
+		}
+	}
+
+	_, index, confidence := language.NewMatcher(supported).Match(tags...)
+	if confidence == language.No {
+		return self.config.DefaultLocale
+	}
+
+	return supported[index]
+}
+
 func (self Localizer) SetLocale(ctx context.Context, locale language.Tag) context.Context {
-	return context.WithValue(ctx, KeyLocalizerLocale, locale)
+	return Context.WithLocale(ctx, locale)
 }
 
 func (self Localizer) GetLocale(ctx context.Context) language.Tag {
-	if ctxLocale, ok := ctx.Value(KeyLocalizerLocale).(language.Tag); ok {
+	if ctxLocale, ok := Context.Locale(ctx); ok {
 		return ctxLocale
 	}
 
@@ -149,15 +198,24 @@ func (self Localizer) GetLocale(ctx context.Context) language.Tag {
 }
 
 func (self Localizer) Localize(ctx context.Context, copy string, i ...any) string {
+	if trans, ok := self.Lookup(ctx, copy, i...); ok {
+		return trans
+	}
+
+	return strings.ToUpper(copy)
+}
+
+// Lookup is like Localize but reports whether the copy has a translation instead of returning the copy itself.
+func (self Localizer) Lookup(ctx context.Context, copy string, i ...any) (string, bool) {
 	copy = strings.ToUpper(copy)
 
 	if trans, ok := self.copies[self.GetLocale(ctx)][copy]; ok {
-		return fmt.Sprintf(trans, i...)
+		return fmt.Sprintf(trans, i...), true
 	}
 
 	if trans, ok := self.copies[self.config.DefaultLocale][copy]; ok {
-		return fmt.Sprintf(trans, i...)
+		return fmt.Sprintf(trans, i...), true
 	}
 
-	return copy
+	return "", false
 }
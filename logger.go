@@ -11,6 +11,7 @@ import (
 	"github.com/neoxelox/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/diode"
+	"gopkg.in/natefinch/lumberjack.v2"
 
 	"github.com/neoxelox/kit/util"
 )
@@ -43,10 +44,18 @@ var _KlevelToZlevel = map[Level]zerolog.Level{
 
 var (
 	_LOGGER_DEFAULT_CONFIG = LoggerConfig{
+		Format:         util.Pointer(LoggerFormatJSON),
 		SkipFrameCount: util.Pointer(1),
 	}
 )
 
+type LoggerFormat string
+
+var (
+	LoggerFormatText LoggerFormat = "text"
+	LoggerFormatJSON LoggerFormat = "json"
+)
+
 type Level int
 
 var (
@@ -58,9 +67,24 @@ var (
 	LvlNone  Level = 0
 )
 
+type LoggerRotationConfig struct {
+	Filename   string
+	MaxSize    int // Megabytes
+	MaxAge     int // Days
+	MaxBackups int
+	Compress   bool
+}
+
+// LoggerConfig Format selects between structured JSON lines, meant for log
+// aggregators, and human-readable colored text, meant for local development.
+// Output redirects the logs, which are written to stdout by default, while
+// Rotation writes them to a rotating file instead when Output is not set.
 type LoggerConfig struct {
 	Level          Level
 	Service        string
+	Format         *LoggerFormat
+	Output         io.Writer
+	Rotation       *LoggerRotationConfig
 	SkipFrameCount *int
 }
 
@@ -73,6 +97,12 @@ type Logger struct {
 	level          Level
 	verbose        bool
 	skipFrameCount int
+	extractors     *[]_loggerExtractor
+}
+
+type _loggerExtractor struct {
+	field string
+	key   any
 }
 
 func NewLogger(config LoggerConfig) *Logger {
@@ -86,8 +116,30 @@ func NewLogger(config LoggerConfig) *Logger {
 
 	_, file, line, _ := runtime.Caller(0)
 
-	out := diode.NewWriter(os.Stdout, _LOGGER_WRITER_SIZE, _LOGGER_POLL_INTERVAL, func(missed int) {
-		fmt.Fprintf(os.Stdout,
+	var destination io.Writer = os.Stdout
+	if config.Output != nil {
+		destination = config.Output
+	} else if config.Rotation != nil {
+		destination = &lumberjack.Logger{
+			Filename:   config.Rotation.Filename,
+			MaxSize:    config.Rotation.MaxSize,
+			MaxAge:     config.Rotation.MaxAge,
+			MaxBackups: config.Rotation.MaxBackups,
+			Compress:   config.Rotation.Compress,
+		}
+	}
+
+	writer := destination
+	if *config.Format == LoggerFormatText {
+		writer = zerolog.ConsoleWriter{
+			Out:        destination,
+			NoColor:    destination != os.Stdout && destination != os.Stderr,
+			TimeFormat: time.DateTime,
+		}
+	}
+
+	out := diode.NewWriter(writer, _LOGGER_WRITER_SIZE, _LOGGER_POLL_INTERVAL, func(missed int) {
+		fmt.Fprintf(destination,
 			"{\"%s\":\"%s\",\"%s\":\"%s\",\"%s\":\"%s:%d\",\"%s\":%d,\"%s\":\"Logger dropped %d messages\"}\n",
 			zerolog.LevelFieldName, zerolog.ErrorLevel, _LOGGER_SERVICE_FIELD_NAME,
 			config.Service, zerolog.CallerFieldName, file, line, zerolog.TimestampFieldName,
@@ -110,9 +162,51 @@ func NewLogger(config LoggerConfig) *Logger {
 		header:         "",
 		verbose:        LvlDebug >= config.Level,
 		skipFrameCount: *config.SkipFrameCount,
+		extractors:     &[]_loggerExtractor{},
 	}
 }
 
+// Extract registers a context key whose value, when present in the context, is added
+// as the given field to every line logged through WithContext. It is meant to be called at startup.
+func (self *Logger) Extract(field string, key any) {
+	*self.extractors = append(*self.extractors, _loggerExtractor{
+		field: field,
+		key:   key,
+	})
+}
+
+// WithContext returns the logger enriched with the registered context values present in the context.
+func (self Logger) WithContext(ctx context.Context) Logger {
+	if ctx == nil {
+		return self
+	}
+
+	var fields *zerolog.Context
+
+	for _, extractor := range *self.extractors {
+		value := ctx.Value(extractor.key)
+		if value == nil {
+			continue
+		}
+
+		if fields == nil {
+			zcontext := self.logger.With()
+			fields = &zcontext
+		}
+
+		*fields = fields.Interface(extractor.field, value)
+	}
+
+	if fields == nil {
+		return self
+	}
+
+	zlogger := fields.Logger()
+	self.logger = &zlogger
+
+	return self
+}
+
 func (self Logger) Logger() *zerolog.Logger {
 	return self.logger
 }
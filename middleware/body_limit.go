@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/neoxelox/kit"
+	"github.com/neoxelox/kit/util"
+)
+
+var (
+	_BODY_LIMIT_MIDDLEWARE_DEFAULT_CONFIG = BodyLimitConfig{}
+)
+
+// BodyLimitConfig Limit is the request body size limit, in bytes, of the routes or groups using the
+// middleware. It takes precedence over the server RequestBodyMaxSize and RequestFileMaxSize limits.
+type BodyLimitConfig struct {
+	Limit int
+}
+
+type BodyLimit struct {
+	config   BodyLimitConfig
+	observer *kit.Observer
+}
+
+func NewBodyLimit(observer *kit.Observer, config BodyLimitConfig) *BodyLimit {
+	util.Merge(&config, _BODY_LIMIT_MIDDLEWARE_DEFAULT_CONFIG)
+
+	return &BodyLimit{
+		config:   config,
+		observer: observer,
+	}
+}
+
+func (self *BodyLimit) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		kit.SetRequestBodyLimit(ctx, self.config.Limit)
+
+		return next(ctx)
+	}
+}
@@ -0,0 +1,304 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+	"github.com/scylladb/go-set/strset"
+
+	"github.com/neoxelox/kit"
+	"github.com/neoxelox/kit/util"
+)
+
+const (
+	_COMPRESS_MIDDLEWARE_ANY_ENCODING = "*"
+)
+
+var (
+	_COMPRESS_MIDDLEWARE_DEFAULT_CONFIG = CompressConfig{
+		Level:   util.Pointer(flate.DefaultCompression),
+		MinSize: util.Pointer(1 << 10), // 1 KB
+		ContentTypes: util.Pointer([]string{
+			echo.MIMEApplicationJSON,
+			echo.MIMEApplicationJavaScript,
+			echo.MIMEApplicationXML,
+			echo.MIMETextPlain,
+			echo.MIMETextHTML,
+			echo.MIMETextXML,
+			"text/css",
+			"text/csv",
+			"image/svg+xml",
+		}),
+		FilePattern: util.Pointer(`.*/file.*`),
+		Encodings:   util.Pointer([]string{"br", "gzip", "deflate"}),
+		Encoders: util.Pointer(map[string]CompressEncoder{
+			"br": func(w io.Writer, level int) (io.WriteCloser, error) {
+				// Brotli levels go from 0 to 11 and do not have a negative default level
+				if level < brotli.BestSpeed || level > brotli.BestCompression {
+					level = brotli.DefaultCompression
+				}
+
+				return brotli.NewWriterLevel(w, level), nil
+			},
+			"gzip": func(w io.Writer, level int) (io.WriteCloser, error) {
+				return gzip.NewWriterLevel(w, level)
+			},
+			"deflate": func(w io.Writer, level int) (io.WriteCloser, error) {
+				return flate.NewWriter(w, level)
+			},
+		}),
+	}
+)
+
+// CompressEncoder creates a compressing writer for a content encoding.
+// Additional encodings can be plugged in through the Encoders config.
+type CompressEncoder func(w io.Writer, level int) (io.WriteCloser, error)
+
+type CompressConfig struct {
+	Level        *int
+	MinSize      *int
+	ContentTypes *[]string
+	FilePattern  *string
+	Encodings    *[]string
+	Encoders     *map[string]CompressEncoder
+}
+
+type Compress struct {
+	config      CompressConfig
+	observer    *kit.Observer
+	filePattern *regexp.Regexp
+}
+
+func NewCompress(observer *kit.Observer, config CompressConfig) *Compress {
+	util.Merge(&config, _COMPRESS_MIDDLEWARE_DEFAULT_CONFIG)
+
+	return &Compress{
+		config:      config,
+		observer:    observer,
+		filePattern: regexp.MustCompile(*config.FilePattern),
+	}
+}
+
+func (self *Compress) encoding(acceptEncoding string) string {
+	accepted := strset.New()
+
+	for _, encoding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.ReplaceAll(strings.TrimSpace(params), " ", "") == "q=0" {
+			continue
+		}
+
+		accepted.Add(strings.ToLower(strings.TrimSpace(name)))
+	}
+
+	for _, encoding := range *self.config.Encodings {
+		if _, ok := (*self.config.Encoders)[encoding]; !ok {
+			continue
+		}
+
+		if accepted.Has(encoding) || accepted.Has(_COMPRESS_MIDDLEWARE_ANY_ENCODING) {
+			return encoding
+		}
+	}
+
+	return ""
+}
+
+func (self *Compress) compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+
+	for _, allowed := range *self.config.ContentTypes {
+		if strings.HasPrefix(mediaType, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// upgrade reports whether the Connection header holds the upgrade token,
+// which can be sent along others such as in "keep-alive, Upgrade".
+func (self *Compress) upgrade(request *http.Request) bool {
+	for _, connection := range request.Header.Values(echo.HeaderConnection) {
+		for _, token := range strings.Split(connection, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (self *Compress) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		request := ctx.Request()
+		response := ctx.Response()
+
+		if self.filePattern.MatchString(request.RequestURI) || self.upgrade(request) {
+			return next(ctx)
+		}
+
+		encoding := self.encoding(request.Header.Get(echo.HeaderAcceptEncoding))
+		if encoding == "" {
+			return next(ctx)
+		}
+
+		response.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+
+		writer := &_compressResponseWriter{
+			ResponseWriter: response.Writer,
+			middleware:     self,
+			encoding:       encoding,
+			statusCode:     http.StatusOK,
+		}
+
+		response.Writer = writer
+		defer func() {
+			err := writer.Close()
+			if err != nil {
+				self.observer.Error(request.Context(), kit.ErrHTTPServerGeneric.Raise().Cause(err))
+			}
+
+			response.Writer = writer.ResponseWriter
+		}()
+
+		return next(ctx)
+	}
+}
+
+type _compressResponseWriter struct {
+	http.ResponseWriter
+	middleware  *Compress
+	encoding    string
+	encoder     io.WriteCloser
+	buffer      bytes.Buffer
+	statusCode  int
+	wroteHeader bool
+	decided     bool
+}
+
+func (self *_compressResponseWriter) WriteHeader(statusCode int) {
+	if self.decided {
+		return
+	}
+
+	self.statusCode = statusCode
+	self.wroteHeader = true
+}
+
+func (self *_compressResponseWriter) Write(body []byte) (int, error) {
+	if !self.decided {
+		self.wroteHeader = true
+
+		self.buffer.Write(body)
+		if self.buffer.Len() < *self.middleware.config.MinSize {
+			return len(body), nil
+		}
+
+		err := self.decide()
+		if err != nil {
+			return 0, err
+		}
+
+		return len(body), nil
+	}
+
+	if self.encoder != nil {
+		return self.encoder.Write(body)
+	}
+
+	return self.ResponseWriter.Write(body)
+}
+
+// decide chooses whether the response is compressed once enough of it has been
+// buffered, then writes the headers and the buffered body to the original writer.
+func (self *_compressResponseWriter) decide() error {
+	self.decided = true
+
+	header := self.ResponseWriter.Header()
+
+	if self.buffer.Len() >= *self.middleware.config.MinSize &&
+		header.Get(echo.HeaderContentEncoding) == "" && header.Get("Content-Range") == "" &&
+		self.statusCode != http.StatusNoContent && self.statusCode != http.StatusNotModified &&
+		self.statusCode != http.StatusPartialContent &&
+		self.middleware.compressible(header.Get(echo.HeaderContentType)) {
+		encoder, err := (*self.middleware.config.Encoders)[self.encoding](
+			self.ResponseWriter, *self.middleware.config.Level)
+		if err != nil {
+			return err
+		}
+
+		self.encoder = encoder
+
+		header.Del(echo.HeaderContentLength)
+		header.Set(echo.HeaderContentEncoding, self.encoding)
+	}
+
+	self.ResponseWriter.WriteHeader(self.statusCode)
+
+	if self.buffer.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if self.encoder != nil {
+		_, err = self.encoder.Write(self.buffer.Bytes())
+	} else {
+		_, err = self.ResponseWriter.Write(self.buffer.Bytes())
+	}
+
+	self.buffer.Reset()
+
+	return err
+}
+
+func (self *_compressResponseWriter) Flush() {
+	if !self.decided && self.wroteHeader {
+		err := self.decide()
+		if err != nil {
+			return
+		}
+	}
+
+	if flusher, ok := self.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+
+	if flusher, ok := self.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (self *_compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(self.ResponseWriter).Hijack()
+}
+
+func (self *_compressResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+func (self *_compressResponseWriter) Close() error {
+	if !self.decided && self.wroteHeader {
+		err := self.decide()
+		if err != nil {
+			return err
+		}
+	}
+
+	if self.encoder != nil {
+		return self.encoder.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/neoxelox/kit"
+	"github.com/neoxelox/kit/util"
+)
+
+var (
+	_CONCURRENCY_LIMIT_MIDDLEWARE_DEFAULT_CONFIG = ConcurrencyLimitConfig{
+		Limit:      util.Pointer(100),
+		RetryAfter: util.Pointer(1 * time.Second),
+	}
+)
+
+// ConcurrencyLimitConfig Limit is the maximum number of in-flight requests, which should be set relative to the
+// DatabaseMaxConns, and RetryAfter the time suggested to the shed requests. Both fall back to their defaults when
+// they are not positive.
+type ConcurrencyLimitConfig struct {
+	Limit      *int
+	RetryAfter *time.Duration
+}
+
+// ConcurrencyLimit sheds the requests exceeding the limit of in-flight requests right away, instead of
+// queueing them until all of them time out together, so that a traffic spike degrades to some rejected requests.
+type ConcurrencyLimit struct {
+	config    ConcurrencyLimitConfig
+	observer  *kit.Observer
+	semaphore chan struct{}
+}
+
+func NewConcurrencyLimit(observer *kit.Observer, config ConcurrencyLimitConfig) *ConcurrencyLimit {
+	util.Merge(&config, _CONCURRENCY_LIMIT_MIDDLEWARE_DEFAULT_CONFIG)
+
+	if *config.Limit < 1 {
+		config.Limit = _CONCURRENCY_LIMIT_MIDDLEWARE_DEFAULT_CONFIG.Limit
+	}
+
+	if *config.RetryAfter <= 0 {
+		config.RetryAfter = _CONCURRENCY_LIMIT_MIDDLEWARE_DEFAULT_CONFIG.RetryAfter
+	}
+
+	return &ConcurrencyLimit{
+		config:    config,
+		observer:  observer,
+		semaphore: make(chan struct{}, *config.Limit),
+	}
+}
+
+// Limit returns the maximum number of in-flight requests.
+func (self *ConcurrencyLimit) Limit() int {
+	return *self.config.Limit
+}
+
+// InFlight returns the number of requests currently being handled.
+func (self *ConcurrencyLimit) InFlight() int {
+	return len(self.semaphore)
+}
+
+func (self *ConcurrencyLimit) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		select {
+		case self.semaphore <- struct{}{}:
+		default:
+			ctx.Response().Header().Set(echo.HeaderRetryAfter,
+				strconv.Itoa(int(math.Ceil(self.config.RetryAfter.Seconds()))))
+
+			return kit.HTTPErrServerUnavailable
+		}
+
+		defer func() { <-self.semaphore }()
+
+		return next(ctx)
+	}
+}
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/neoxelox/kit"
+	"github.com/neoxelox/kit/util"
+)
+
+const (
+	_ETAG_MIDDLEWARE_HEADER          = "ETag"
+	_ETAG_MIDDLEWARE_IF_NONE_MATCH   = "If-None-Match"
+	_ETAG_MIDDLEWARE_WEAK_PREFIX     = "W/"
+	_ETAG_MIDDLEWARE_ANY_TAG         = "*"
+	_ETAG_MIDDLEWARE_HASH_SIZE_BYTES = 16
+)
+
+var (
+	_ETAG_MIDDLEWARE_DEFAULT_CONFIG = ETagConfig{
+		ContentTypes: util.Pointer([]string{
+			echo.MIMEApplicationJSON,
+			echo.MIMEApplicationJavaScript,
+			echo.MIMEApplicationXML,
+			echo.MIMETextPlain,
+			echo.MIMETextHTML,
+			echo.MIMETextXML,
+			"text/css",
+			"text/csv",
+			"image/svg+xml",
+		}),
+		Weak:           util.Pointer(false),
+		WeakCompressed: util.Pointer(true),
+	}
+)
+
+// ETagConfig ContentTypes are the media type prefixes of the responses that get an ETag. Weak makes all the ETags
+// weak whereas WeakCompressed only the ones of the responses with a Content-Encoding, as the same content
+// compressed by different encoders is not byte-for-byte identical. The middleware must be used before the
+// Compress middleware for the ETags to be computed from the compressed responses.
+type ETagConfig struct {
+	ContentTypes   *[]string
+	Weak           *bool
+	WeakCompressed *bool
+}
+
+// ETag computes the ETag of the successful GET and HEAD responses from their body, unless the handler already
+// set one, and responds 304 Not Modified without the body when the request If-None-Match matches it.
+// Responses are buffered to compute the ETag, except the ones that are flushed, which are streamed untagged.
+type ETag struct {
+	config   ETagConfig
+	observer *kit.Observer
+}
+
+func NewETag(observer *kit.Observer, config ETagConfig) *ETag {
+	util.Merge(&config, _ETAG_MIDDLEWARE_DEFAULT_CONFIG)
+
+	return &ETag{
+		config:   config,
+		observer: observer,
+	}
+}
+
+func (self *ETag) taggable(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+
+	for _, allowed := range *self.config.ContentTypes {
+		if strings.HasPrefix(mediaType, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self *ETag) tag(header http.Header, body []byte) string {
+	if tag := header.Get(_ETAG_MIDDLEWARE_HEADER); tag != "" {
+		return tag
+	}
+
+	hash := sha256.Sum256(body)
+	tag := `"` + base64.RawURLEncoding.EncodeToString(hash[:_ETAG_MIDDLEWARE_HASH_SIZE_BYTES]) + `"`
+
+	if *self.config.Weak || (*self.config.WeakCompressed && header.Get(echo.HeaderContentEncoding) != "") {
+		tag = _ETAG_MIDDLEWARE_WEAK_PREFIX + tag
+	}
+
+	return tag
+}
+
+// match reports whether any of the If-None-Match tags matches the tag using the weak comparison,
+// which is the one mandated for If-None-Match as it is only used for caching purposes.
+func (self *ETag) match(ifNoneMatch []string, tag string) bool {
+	tag = strings.TrimPrefix(tag, _ETAG_MIDDLEWARE_WEAK_PREFIX)
+
+	for _, value := range ifNoneMatch {
+		for _, candidate := range strings.Split(value, ",") {
+			candidate = strings.TrimSpace(candidate)
+
+			if candidate == _ETAG_MIDDLEWARE_ANY_TAG ||
+				strings.TrimPrefix(candidate, _ETAG_MIDDLEWARE_WEAK_PREFIX) == tag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (self *ETag) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		request := ctx.Request()
+		response := ctx.Response()
+
+		if request.Method != http.MethodGet && request.Method != http.MethodHead {
+			return next(ctx)
+		}
+
+		writer := &_etagResponseWriter{
+			ResponseWriter: response.Writer,
+			statusCode:     http.StatusOK,
+		}
+
+		response.Writer = writer
+		defer func() {
+			response.Writer = writer.ResponseWriter
+		}()
+
+		err := next(ctx)
+
+		if writer.streamed || !writer.wroteHeader {
+			return err
+		}
+
+		header := writer.ResponseWriter.Header()
+
+		if writer.statusCode == http.StatusOK && self.taggable(header.Get(echo.HeaderContentType)) {
+			tag := self.tag(header, writer.buffer.Bytes())
+			header.Set(_ETAG_MIDDLEWARE_HEADER, tag)
+
+			if self.match(request.Header.Values(_ETAG_MIDDLEWARE_IF_NONE_MATCH), tag) {
+				header.Del(echo.HeaderContentLength)
+				writer.ResponseWriter.WriteHeader(http.StatusNotModified)
+				response.Status = http.StatusNotModified
+
+				return err
+			}
+		}
+
+		writeErr := writer.release()
+		if writeErr != nil {
+			self.observer.Error(request.Context(), kit.ErrHTTPServerGeneric.Raise().Cause(writeErr))
+		}
+
+		return err
+	}
+}
+
+type _etagResponseWriter struct {
+	http.ResponseWriter
+	buffer      bytes.Buffer
+	statusCode  int
+	wroteHeader bool
+	streamed    bool
+}
+
+func (self *_etagResponseWriter) WriteHeader(statusCode int) {
+	if self.streamed {
+		self.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
+	self.statusCode = statusCode
+	self.wroteHeader = true
+}
+
+func (self *_etagResponseWriter) Write(body []byte) (int, error) {
+	if self.streamed {
+		return self.ResponseWriter.Write(body)
+	}
+
+	self.wroteHeader = true
+
+	return self.buffer.Write(body)
+}
+
+// release writes the buffered headers and body to the original writer.
+func (self *_etagResponseWriter) release() error {
+	self.ResponseWriter.WriteHeader(self.statusCode)
+
+	if self.buffer.Len() == 0 {
+		return nil
+	}
+
+	_, err := self.ResponseWriter.Write(self.buffer.Bytes())
+
+	self.buffer.Reset()
+
+	return err
+}
+
+// Flush streams the response untagged from then on, as the ETag
+// cannot be computed before the whole body has been written.
+func (self *_etagResponseWriter) Flush() {
+	if !self.streamed {
+		self.streamed = true
+
+		if self.wroteHeader {
+			err := self.release()
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	if flusher, ok := self.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (self *_etagResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(self.ResponseWriter).Hijack()
+}
+
+func (self *_etagResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scylladb/go-set/strset"
+
+	"github.com/neoxelox/kit"
+	"github.com/neoxelox/kit/util"
+)
+
+const (
+	_IDEMPOTENCY_MIDDLEWARE_REPLAYED_HEADER = "Idempotent-Replayed"
+	_IDEMPOTENCY_MIDDLEWARE_LOCK_SUFFIX     = ":lock"
+	_IDEMPOTENCY_MIDDLEWARE_KEY_SEPARATOR   = "\x00"
+)
+
+var (
+	KeyIdempotency kit.Key = kit.KeyBase + "idempotency:"
+)
+
+var (
+	_IDEMPOTENCY_MIDDLEWARE_DEFAULT_CONFIG = IdempotencyConfig{
+		Header:  util.Pointer("Idempotency-Key"),
+		Methods: util.Pointer([]string{http.MethodPost}),
+		TTL:     util.Pointer(24 * time.Hour),
+		LockTTL: util.Pointer(30 * time.Second),
+		ReplayHeaders: util.Pointer([]string{
+			echo.HeaderContentType,
+			echo.HeaderContentEncoding,
+			echo.HeaderContentDisposition,
+			echo.HeaderLocation,
+			echo.HeaderVary,
+			echo.HeaderLastModified,
+			"Content-Language",
+			"Cache-Control",
+			"ETag",
+		}),
+	}
+)
+
+// IdempotencyConfig ReplayHeaders are the only response headers stored and replayed, so that
+// per-request headers such as trace IDs, rate limits or cookies are not leaked into retries.
+type IdempotencyConfig struct {
+	Header        *string
+	Methods       *[]string
+	TTL           *time.Duration
+	LockTTL       *time.Duration
+	ReplayHeaders *[]string
+}
+
+type Idempotency struct {
+	config   IdempotencyConfig
+	observer *kit.Observer
+	cache    *kit.Cache
+	methods  *strset.Set
+}
+
+func NewIdempotency(observer *kit.Observer, cache *kit.Cache, config IdempotencyConfig) *Idempotency {
+	util.Merge(&config, _IDEMPOTENCY_MIDDLEWARE_DEFAULT_CONFIG)
+
+	return &Idempotency{
+		config:   config,
+		observer: observer,
+		cache:    cache,
+		methods:  strset.New(*config.Methods...),
+	}
+}
+
+type _idempotentResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+func (self *Idempotency) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		request := ctx.Request()
+		response := ctx.Response()
+		requestCtx := request.Context()
+
+		idempotencyKey := request.Header.Get(*self.config.Header)
+		if idempotencyKey == "" || !self.methods.Has(request.Method) {
+			return next(ctx)
+		}
+
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			return kit.HTTPErrInvalidRequest.Cause(err)
+		}
+
+		request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The route path is not known yet when the middleware runs before the router
+		path := ctx.Path()
+		if path == "" {
+			path = request.URL.Path
+		}
+
+		hash := sha256.New()
+		for _, field := range []string{idempotencyKey, request.Method, path} {
+			hash.Write([]byte(field))
+			hash.Write([]byte(_IDEMPOTENCY_MIDDLEWARE_KEY_SEPARATOR))
+		}
+		hash.Write(body)
+
+		key := string(KeyIdempotency) + hex.EncodeToString(hash.Sum(nil))
+
+		var stored _idempotentResponse
+
+		err = self.cache.Get(requestCtx, key, &stored)
+		if err == nil {
+			return self.replay(ctx, stored)
+		}
+
+		if !kit.ErrCacheMiss.Is(err) {
+			return err
+		}
+
+		// Lock the key so that a duplicate request arriving while the first one
+		// is still being processed does not execute the handler a second time
+		locked, err := self.cache.SetNX(requestCtx, key+_IDEMPOTENCY_MIDDLEWARE_LOCK_SUFFIX, true, self.config.LockTTL)
+		if err != nil {
+			return err
+		}
+
+		if !locked {
+			return kit.HTTPErrConflict
+		}
+
+		defer func() {
+			err := self.cache.Delete(requestCtx, key+_IDEMPOTENCY_MIDDLEWARE_LOCK_SUFFIX)
+			if err != nil {
+				self.observer.Error(requestCtx, err)
+			}
+		}()
+
+		writer := &_recordingResponseWriter{ResponseWriter: response.Writer}
+		response.Writer = writer
+
+		err = next(ctx)
+
+		response.Writer = writer.ResponseWriter
+
+		if err != nil || response.Status < http.StatusOK || response.Status >= http.StatusMultipleChoices {
+			return err
+		}
+
+		header := http.Header{}
+		for _, name := range *self.config.ReplayHeaders {
+			if values := response.Header().Values(name); len(values) > 0 {
+				header[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+
+		err = self.cache.Set(requestCtx, key, _idempotentResponse{
+			Status: response.Status,
+			Header: header,
+			Body:   writer.body.Bytes(),
+		}, self.config.TTL)
+		if err != nil {
+			self.observer.Error(requestCtx, err)
+		}
+
+		return nil
+	}
+}
+
+func (self *Idempotency) replay(ctx echo.Context, stored _idempotentResponse) error {
+	header := ctx.Response().Header()
+	for name, values := range stored.Header {
+		header[name] = values
+	}
+
+	header.Set(_IDEMPOTENCY_MIDDLEWARE_REPLAYED_HEADER, "true")
+
+	ctx.Response().WriteHeader(stored.Status)
+
+	_, err := ctx.Response().Write(stored.Body)
+	if err != nil {
+		return kit.ErrHTTPServerGeneric.Raise().Cause(err)
+	}
+
+	return nil
+}
+
+// _recordingResponseWriter records the written body while writing it, to be stored for later responses.
+type _recordingResponseWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (self *_recordingResponseWriter) Write(body []byte) (int, error) {
+	self.body.Write(body)
+
+	return self.ResponseWriter.Write(body)
+}
+
+func (self *_recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
@@ -3,13 +3,17 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/hibiken/asynq"
 	"github.com/labstack/echo/v4"
 	"github.com/mkideal/cli"
+	"github.com/rs/zerolog"
+	"github.com/scylladb/go-set/strset"
 
 	"github.com/neoxelox/kit"
 	"github.com/neoxelox/kit/util"
@@ -17,40 +21,85 @@ import (
 
 const (
 	_OBSERVER_MIDDLEWARE_RESPONSE_TRACE_ID_HEADER = "X-Trace-Id"
+	_OBSERVER_MIDDLEWARE_REDACTED_HEADER_VALUE    = "[REDACTED]"
 )
 
 var (
-	_OBSERVER_MIDDLEWARE_DEFAULT_CONFIG = ObserverConfig{}
+	_OBSERVER_MIDDLEWARE_DEFAULT_CONFIG = ObserverConfig{
+		SkipPaths:     util.Pointer([]string{}),
+		RedactHeaders: util.Pointer([]string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}),
+	}
 )
 
 type ObserverConfig struct {
+	SkipPaths     *[]string
+	RedactHeaders *[]string
 }
 
 type Observer struct {
-	config   ObserverConfig
-	observer *kit.Observer
+	config        ObserverConfig
+	observer      *kit.Observer
+	skipPaths     *strset.Set
+	redactHeaders *strset.Set
 }
 
 func NewObserver(observer *kit.Observer, config ObserverConfig) *Observer {
 	util.Merge(&config, _OBSERVER_MIDDLEWARE_DEFAULT_CONFIG)
 
+	redactHeaders := strset.New()
+	for _, header := range *config.RedactHeaders {
+		redactHeaders.Add(http.CanonicalHeaderKey(header))
+	}
+
 	return &Observer{
-		config:   config,
-		observer: observer,
+		config:        config,
+		observer:      observer,
+		skipPaths:     strset.New(*config.SkipPaths...),
+		redactHeaders: redactHeaders,
 	}
 }
 
+func (self *Observer) headers(request *http.Request) *zerolog.Event {
+	headers := zerolog.Dict()
+
+	for name, values := range request.Header {
+		if self.redactHeaders.Has(name) {
+			headers.Str(name, _OBSERVER_MIDDLEWARE_REDACTED_HEADER_VALUE)
+		} else {
+			headers.Str(name, strings.Join(values, ", "))
+		}
+	}
+
+	return headers
+}
+
 func (self *Observer) HandleRequest(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
+		if self.skipPaths.Has(ctx.Request().URL.Path) {
+			return next(ctx)
+		}
+
 		start := time.Now()
 
 		traceCtx, endTraceRequest := self.observer.TraceServerRequest(ctx.Request().Context(), ctx.Request())
 		defer endTraceRequest()
 
-		ctx.SetRequest(ctx.Request().WithContext(traceCtx))
 		traceID := self.observer.GetTrace(traceCtx)
 		sentrySpan := sentry.SpanFromContext(traceCtx)
 
+		// Inject a request-scoped logger so views can log with the request fields
+		// already set, it can be retrieved through kit.LoggerFromContext
+		loggerFields := self.observer.Logger.Logger().With().Str("trace_id", traceID)
+		if requestID := self.observer.GetRequestID(traceCtx); requestID != "" {
+			loggerFields = loggerFields.Str("request_id", requestID)
+		}
+
+		logger := loggerFields.Logger()
+		ctx.Set(string(kit.KeyObserverLogger), &logger)
+
+		traceCtx = kit.Context.WithLogger(logger.WithContext(traceCtx), &logger)
+		ctx.SetRequest(ctx.Request().WithContext(traceCtx))
+
 		ctx.Response().Header().Set(_OBSERVER_MIDDLEWARE_RESPONSE_TRACE_ID_HEADER, traceID)
 		if sentrySpan != nil {
 			ctx.Response().Header().Set(sentry.SentryTraceHeader, sentrySpan.ToSentryTrace())
@@ -77,8 +126,10 @@ func (self *Observer) HandleRequest(next echo.HandlerFunc) echo.HandlerFunc {
 			Str("path", request.RequestURI).
 			Int("status", response.Status).
 			Str("ip_address", request.RemoteAddr).
+			Dict("headers", self.headers(request)).
 			Dur("latency", stop.Sub(start)).
 			Str("trace_id", traceID).
+			Str("request_id", self.observer.GetRequestID(request.Context())).
 			Msg("")
 
 		return err
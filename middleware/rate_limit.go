@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/neoxelox/kit"
+	"github.com/neoxelox/kit/util"
+)
+
+const (
+	_RATE_LIMIT_MIDDLEWARE_LIMIT_HEADER     = "X-Rate-Limit-Limit"
+	_RATE_LIMIT_MIDDLEWARE_REMAINING_HEADER = "X-Rate-Limit-Remaining"
+	_RATE_LIMIT_MIDDLEWARE_KEY              = "%s%s:%d"
+)
+
+var (
+	KeyRateLimit kit.Key = kit.KeyBase + "rate_limit:"
+)
+
+var (
+	_RATE_LIMIT_MIDDLEWARE_DEFAULT_CONFIG = RateLimitConfig{
+		Limit:        util.Pointer(60),
+		Window:       util.Pointer(1 * time.Minute),
+		KeyExtractor: util.Pointer(RateLimitKeyByIP()),
+	}
+)
+
+func RateLimitKeyByIP() func(echo.Context) string {
+	return func(ctx echo.Context) string {
+		return ctx.RealIP()
+	}
+}
+
+func RateLimitKeyByHeader(header string) func(echo.Context) string {
+	return func(ctx echo.Context) string {
+		return ctx.Request().Header.Get(header)
+	}
+}
+
+// RateLimitConfig Limit and Window fall back to their defaults when they are not positive.
+type RateLimitConfig struct {
+	Limit        *int
+	Window       *time.Duration
+	KeyExtractor *func(echo.Context) string
+}
+
+// RateLimit does not reuse kit.Limiter because the limiter counts a single fixed window whose
+// expiration is pushed back on every hit and owns its own Redis pool, whereas the sliding
+// window approximation needs both the current and previous window counters from the cache.
+type RateLimit struct {
+	config   RateLimitConfig
+	observer *kit.Observer
+	cache    *kit.Cache
+}
+
+func NewRateLimit(observer *kit.Observer, cache *kit.Cache, config RateLimitConfig) *RateLimit {
+	util.Merge(&config, _RATE_LIMIT_MIDDLEWARE_DEFAULT_CONFIG)
+
+	if *config.Limit < 1 {
+		config.Limit = _RATE_LIMIT_MIDDLEWARE_DEFAULT_CONFIG.Limit
+	}
+
+	if *config.Window <= 0 {
+		config.Window = _RATE_LIMIT_MIDDLEWARE_DEFAULT_CONFIG.Window
+	}
+
+	return &RateLimit{
+		config:   config,
+		observer: observer,
+		cache:    cache,
+	}
+}
+
+func (self *RateLimit) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		requestCtx := ctx.Request().Context()
+
+		id := (*self.config.KeyExtractor)(ctx)
+		if id == "" {
+			return next(ctx)
+		}
+
+		// Sliding window approximation: weight the previous fixed window
+		// counter by the portion of it that still overlaps the sliding one
+		now := time.Now().UnixNano()
+		window := now / int64(*self.config.Window)
+		elapsed := float64(now%int64(*self.config.Window)) / float64(*self.config.Window)
+
+		ttl := 2 * *self.config.Window
+
+		current, err := self.cache.Increment(requestCtx,
+			fmt.Sprintf(_RATE_LIMIT_MIDDLEWARE_KEY, KeyRateLimit, id, window), 1, &ttl)
+		if err != nil {
+			// Fail open so that a cache outage does not take down the whole service
+			self.observer.Error(requestCtx, err)
+			return next(ctx)
+		}
+
+		previous, err := self.cache.Counter(requestCtx,
+			fmt.Sprintf(_RATE_LIMIT_MIDDLEWARE_KEY, KeyRateLimit, id, window-1))
+		if err != nil {
+			self.observer.Error(requestCtx, err)
+			return next(ctx)
+		}
+
+		rate := int(math.Floor(float64(previous)*(1-elapsed))) + current
+
+		ctx.Response().Header().Set(_RATE_LIMIT_MIDDLEWARE_LIMIT_HEADER, strconv.Itoa(*self.config.Limit))
+		ctx.Response().Header().Set(_RATE_LIMIT_MIDDLEWARE_REMAINING_HEADER,
+			strconv.Itoa(max(0, *self.config.Limit-rate)))
+
+		if rate > *self.config.Limit {
+			retryAfter := time.Duration(float64(*self.config.Window) * (1 - elapsed))
+			ctx.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+			return kit.HTTPErrRateLimited
+		}
+
+		return next(ctx)
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/neoxelox/kit"
+	"github.com/neoxelox/kit/util"
+)
+
+var (
+	_READY_GATE_MIDDLEWARE_DEFAULT_CONFIG = ReadyGateConfig{
+		RetryAfter: util.Pointer(1 * time.Second),
+	}
+)
+
+// ReadyGateConfig RetryAfter is the time suggested to the requests rejected while the gate is closed.
+type ReadyGateConfig struct {
+	RetryAfter *time.Duration
+}
+
+// ReadyGate rejects the requests until the kit.ReadyGate opens. It should not be used on the
+// liveness endpoint, otherwise a slow dependency at startup would get the instance restarted.
+type ReadyGate struct {
+	config   ReadyGateConfig
+	observer *kit.Observer
+	gate     *kit.ReadyGate
+}
+
+func NewReadyGate(observer *kit.Observer, gate *kit.ReadyGate, config ReadyGateConfig) *ReadyGate {
+	util.Merge(&config, _READY_GATE_MIDDLEWARE_DEFAULT_CONFIG)
+
+	return &ReadyGate{
+		config:   config,
+		observer: observer,
+		gate:     gate,
+	}
+}
+
+func (self *ReadyGate) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if !self.gate.Ready() {
+			ctx.Response().Header().Set(echo.HeaderRetryAfter,
+				strconv.Itoa(int(math.Ceil(self.config.RetryAfter.Seconds()))))
+
+			return kit.HTTPErrServerUnavailable
+		}
+
+		return next(ctx)
+	}
+}
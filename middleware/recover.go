@@ -2,11 +2,14 @@ package middleware
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"runtime/debug"
 
 	"github.com/hibiken/asynq"
 	"github.com/labstack/echo/v4"
 	"github.com/mkideal/cli"
+	"github.com/neoxelox/errors"
 
 	"github.com/neoxelox/kit"
 	"github.com/neoxelox/kit/util"
@@ -19,12 +22,20 @@ var (
 	_RECOVER_MIDDLEWARE_DEFAULT_CONFIG = RecoverConfig{}
 )
 
+// RecoverConfig Environment decides whether the stack trace captured at recovery time is attached to the
+// exception, which is only done in development as the exception is otherwise already reported with its trace.
 type RecoverConfig struct {
+	Environment kit.Environment
 }
 
+// RecoverMapper translates a known panic value into a specific error, such as an HTTP error with its proper
+// status, returning nil for the panics it does not know about.
+type RecoverMapper func(rec any) error
+
 type Recover struct {
 	config   RecoverConfig
 	observer *kit.Observer
+	mappers  []RecoverMapper
 }
 
 func NewRecover(observer *kit.Observer, config RecoverConfig) *Recover {
@@ -36,19 +47,53 @@ func NewRecover(observer *kit.Observer, config RecoverConfig) *Recover {
 	}
 }
 
+// Register adds a mapper for the panics of the requests, the first mapper returning
+// an error taking precedence. It is meant to be called at startup.
+func (self *Recover) Register(mapper RecoverMapper) {
+	self.mappers = append(self.mappers, mapper)
+}
+
+func (self *Recover) mapPanic(rec any) error {
+	for _, mapper := range self.mappers {
+		if err := mapper(rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exception keeps the type of the panic value and, in development, the stack trace captured at recovery time.
+func (self *Recover) exception(err *errors.Error, rec any, stack []byte) *errors.Error {
+	err.Extra(map[string]any{"panic_type": fmt.Sprintf("%T", rec)})
+
+	if self.config.Environment == kit.EnvDevelopment {
+		err.Extra(map[string]any{"stack": string(stack)})
+	}
+
+	return err
+}
+
 func (self *Recover) HandleRequest(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
 		defer func() {
 			rec := recover()
 			if rec != nil {
-				err, ok := rec.(error)
-				if !ok {
-					err = kit.ErrHTTPServerGeneric.Raise().With("%v", rec)
-				} else if err == http.ErrAbortHandler {
+				if rec == http.ErrAbortHandler {
 					// http.ErrAbortHandler has to be handled by the HTTP server
-					panic(err)
-				} else {
-					err = kit.ErrHTTPServerGeneric.Raise().Cause(err)
+					panic(rec)
+				}
+
+				stack := debug.Stack()
+
+				err := self.mapPanic(rec)
+				if err == nil {
+					recErr, ok := rec.(error)
+					if !ok {
+						err = self.exception(kit.ErrHTTPServerGeneric.Raise().With("%v", rec), rec, stack)
+					} else {
+						err = self.exception(kit.ErrHTTPServerGeneric.Raise().Cause(recErr), rec, stack)
+					}
 				}
 
 				// Pass error to the error handler to serialize and write error response
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+
+	"github.com/neoxelox/kit"
+	"github.com/neoxelox/kit/util"
+)
+
+var (
+	_REQUEST_ID_MIDDLEWARE_DEFAULT_CONFIG = RequestIDConfig{
+		Header:    util.Pointer(echo.HeaderXRequestID),
+		Generator: util.Pointer(func() string { return xid.New().String() }),
+	}
+)
+
+type RequestIDConfig struct {
+	Header    *string
+	Generator *func() string
+}
+
+type RequestID struct {
+	config   RequestIDConfig
+	observer *kit.Observer
+}
+
+func NewRequestID(observer *kit.Observer, config RequestIDConfig) *RequestID {
+	util.Merge(&config, _REQUEST_ID_MIDDLEWARE_DEFAULT_CONFIG)
+
+	return &RequestID{
+		config:   config,
+		observer: observer,
+	}
+}
+
+func (self *RequestID) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		request := ctx.Request()
+
+		requestID := request.Header.Get(*self.config.Header)
+		if requestID == "" {
+			requestID = (*self.config.Generator)()
+		}
+
+		// Store the request ID both in the echo context and in the request context
+		// so that downstream components (database, observer...) can also read it
+		ctx.Set(string(kit.KeyRequestID), requestID)
+		requestCtx := self.observer.SetRequestID(request.Context(), requestID)
+
+		// Enrich the request-scoped logger when the observer middleware already injected it
+		if logger, ok := kit.Context.Logger(requestCtx); ok {
+			requestLogger := logger.With().Str("request_id", requestID).Logger()
+			ctx.Set(string(kit.KeyObserverLogger), &requestLogger)
+			requestCtx = kit.Context.WithLogger(requestLogger.WithContext(requestCtx), &requestLogger)
+		}
+
+		ctx.SetRequest(request.WithContext(requestCtx))
+
+		ctx.Response().Header().Set(*self.config.Header, requestID)
+
+		return next(ctx)
+	}
+}
@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scylladb/go-set/strset"
+
+	"github.com/neoxelox/kit"
+	"github.com/neoxelox/kit/util"
+)
+
+const (
+	_RESPONSE_CACHE_MIDDLEWARE_HEADER        = "X-Cache"
+	_RESPONSE_CACHE_MIDDLEWARE_HIT           = "HIT"
+	_RESPONSE_CACHE_MIDDLEWARE_MISS          = "MISS"
+	_RESPONSE_CACHE_MIDDLEWARE_KEY_SEPARATOR = "\x00"
+)
+
+var (
+	KeyResponseCache kit.Key = kit.KeyBase + "response_cache:"
+)
+
+var (
+	_RESPONSE_CACHE_MIDDLEWARE_DEFAULT_CONFIG = ResponseCacheConfig{
+		Predicate:      util.Pointer(func(echo.Context) bool { return true }),
+		TTL:            util.Pointer(5 * time.Second),
+		Statuses:       util.Pointer([]int{http.StatusOK}),
+		AllowSetCookie: util.Pointer(false),
+		Vary:           util.Pointer([]string{echo.HeaderAcceptEncoding}),
+		ReplayHeaders: util.Pointer([]string{
+			echo.HeaderContentType,
+			echo.HeaderContentEncoding,
+			echo.HeaderContentDisposition,
+			echo.HeaderVary,
+			echo.HeaderLastModified,
+			"Content-Language",
+			"Cache-Control",
+			"ETag",
+		}),
+	}
+)
+
+// ResponseCacheConfig Predicate selects the GET requests whose responses are cached for TTL, which is set per
+// route by using a middleware per route or group. Only the responses with any of the Statuses and, unless
+// AllowSetCookie, without a Set-Cookie header are cached. Vary are the request headers the responses vary on,
+// which are part of the cache key, so responses varying on any other header are not cached. ReplayHeaders
+// are the only response headers stored and replayed, so that per-request headers such as trace IDs are not.
+type ResponseCacheConfig struct {
+	Predicate      *func(echo.Context) bool
+	TTL            *time.Duration
+	Statuses       *[]int
+	AllowSetCookie *bool
+	Vary           *[]string
+	ReplayHeaders  *[]string
+}
+
+// ResponseCache caches the full responses, status, headers and body, of the GET requests keyed by their
+// method, path, query and varying headers, for the responses that are identical for all the users.
+// Requests with Cache-Control no-cache skip the cached response and no-store also skip caching it,
+// while responses with Cache-Control no-store, no-cache or private are never cached.
+type ResponseCache struct {
+	config   ResponseCacheConfig
+	observer *kit.Observer
+	cache    *kit.Cache
+	vary     *strset.Set
+}
+
+func NewResponseCache(observer *kit.Observer, cache *kit.Cache, config ResponseCacheConfig) *ResponseCache {
+	util.Merge(&config, _RESPONSE_CACHE_MIDDLEWARE_DEFAULT_CONFIG)
+
+	vary := strset.New()
+	for _, header := range *config.Vary {
+		vary.Add(http.CanonicalHeaderKey(header))
+	}
+
+	return &ResponseCache{
+		config:   config,
+		observer: observer,
+		cache:    cache,
+		vary:     vary,
+	}
+}
+
+type _cachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+func (self *ResponseCache) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		request := ctx.Request()
+		response := ctx.Response()
+		requestCtx := request.Context()
+
+		if request.Method != http.MethodGet || !(*self.config.Predicate)(ctx) {
+			return next(ctx)
+		}
+
+		directives := _cacheControlDirectives(request.Header)
+		if directives.Has("no-store") {
+			return next(ctx)
+		}
+
+		key := self.key(request)
+
+		if !directives.Has("no-cache") {
+			var stored _cachedResponse
+
+			err := self.cache.Get(requestCtx, key, &stored)
+			if err == nil {
+				return self.replay(ctx, stored)
+			}
+
+			// Fail open so that a cache outage does not take down the cached endpoints
+			if !kit.ErrCacheMiss.Is(err) {
+				self.observer.Error(requestCtx, err)
+			}
+		}
+
+		response.Header().Set(_RESPONSE_CACHE_MIDDLEWARE_HEADER, _RESPONSE_CACHE_MIDDLEWARE_MISS)
+
+		writer := &_recordingResponseWriter{ResponseWriter: response.Writer}
+		response.Writer = writer
+
+		err := next(ctx)
+
+		response.Writer = writer.ResponseWriter
+
+		if err != nil || !self.cacheable(response) {
+			return err
+		}
+
+		header := http.Header{}
+		for _, name := range *self.config.ReplayHeaders {
+			if values := response.Header().Values(name); len(values) > 0 {
+				header[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+
+		err = self.cache.Set(requestCtx, key, _cachedResponse{
+			Status: response.Status,
+			Header: header,
+			Body:   writer.body.Bytes(),
+		}, self.config.TTL)
+		if err != nil {
+			self.observer.Error(requestCtx, err)
+		}
+
+		return nil
+	}
+}
+
+func (self *ResponseCache) key(request *http.Request) string {
+	hash := sha256.New()
+
+	// The query is encoded sorted by key so that the order of the parameters does not matter
+	for _, field := range []string{request.Method, request.URL.Path, request.URL.Query().Encode()} {
+		hash.Write([]byte(field))
+		hash.Write([]byte(_RESPONSE_CACHE_MIDDLEWARE_KEY_SEPARATOR))
+	}
+
+	for _, header := range *self.config.Vary {
+		hash.Write([]byte(strings.Join(request.Header.Values(header), ",")))
+		hash.Write([]byte(_RESPONSE_CACHE_MIDDLEWARE_KEY_SEPARATOR))
+	}
+
+	return string(KeyResponseCache) + hex.EncodeToString(hash.Sum(nil))
+}
+
+func (self *ResponseCache) cacheable(response *echo.Response) bool {
+	header := response.Header()
+
+	statusAllowed := false
+	for _, status := range *self.config.Statuses {
+		if response.Status == status {
+			statusAllowed = true
+			break
+		}
+	}
+
+	if !statusAllowed {
+		return false
+	}
+
+	if len(header.Values(echo.HeaderSetCookie)) > 0 && !*self.config.AllowSetCookie {
+		return false
+	}
+
+	directives := _cacheControlDirectives(header)
+	if directives.Has("no-store") || directives.Has("no-cache") || directives.Has("private") {
+		return false
+	}
+
+	// A response varying on a header that is not part of the key would be replayed to the wrong requests
+	for _, value := range header.Values(echo.HeaderVary) {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" || !self.vary.Has(http.CanonicalHeaderKey(name)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (self *ResponseCache) replay(ctx echo.Context, stored _cachedResponse) error {
+	header := ctx.Response().Header()
+	for name, values := range stored.Header {
+		header[name] = values
+	}
+
+	header.Set(_RESPONSE_CACHE_MIDDLEWARE_HEADER, _RESPONSE_CACHE_MIDDLEWARE_HIT)
+
+	ctx.Response().WriteHeader(stored.Status)
+
+	_, err := ctx.Response().Write(stored.Body)
+	if err != nil {
+		return kit.ErrHTTPServerGeneric.Raise().Cause(err)
+	}
+
+	return nil
+}
+
+func _cacheControlDirectives(header http.Header) *strset.Set {
+	directives := strset.New()
+
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(directive, "=")
+			directives.Add(strings.ToLower(strings.TrimSpace(name)))
+		}
+	}
+
+	return directives
+}
@@ -35,6 +35,7 @@ var (
 )
 
 type SecureConfig struct {
+	Environment           kit.Environment
 	CORSAllowOrigins      *[]string
 	CORSAllowMethods      *[]string
 	CORSAllowHeaders      *[]string
@@ -59,6 +60,12 @@ type Secure struct {
 }
 
 func NewSecure(observer *kit.Observer, config SecureConfig) *Secure {
+	// Relax HSTS in development so that browsers do not pin plain http local hosts
+	// to https, unless it has been explicitly set
+	if config.Environment == kit.EnvDevelopment && config.HSTSMaxAge == nil {
+		config.HSTSMaxAge = util.Pointer(0)
+	}
+
 	util.Merge(&config, _SECURE_MIDDLEWARE_DEFAULT_CONFIG)
 
 	*config.CORSAllowOrigins = strset.New(*config.CORSAllowOrigins...).List()
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/neoxelox/kit"
+	"github.com/neoxelox/kit/util"
+)
+
+var (
+	_SESSION_MIDDLEWARE_DEFAULT_CONFIG = SessionConfig{}
+)
+
+type SessionConfig struct {
+}
+
+type Session struct {
+	config   SessionConfig
+	observer *kit.Observer
+	session  *kit.Session
+}
+
+func NewSession(observer *kit.Observer, session *kit.Session, config SessionConfig) *Session {
+	util.Merge(&config, _SESSION_MIDDLEWARE_DEFAULT_CONFIG)
+
+	return &Session{
+		config:   config,
+		observer: observer,
+		session:  session,
+	}
+}
+
+func (self *Session) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		err := self.session.Load(ctx)
+		if err != nil {
+			return err
+		}
+
+		return next(ctx)
+	}
+}
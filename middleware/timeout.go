@@ -22,6 +22,9 @@ var (
 	_TIMEOUT_MIDDLEWARE_DEFAULT_CONFIG = TimeoutConfig{}
 )
 
+// Timeout is set as the deadline of the request context, so database queries, cache calls and
+// any other context aware operation are cancelled as soon as it expires. It should be lower than
+// the server ResponseWriteTimeout, otherwise the connection is closed before the timeout response is sent.
 type TimeoutConfig struct {
 	Timeout time.Duration
 }
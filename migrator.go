@@ -3,8 +3,10 @@ package kit
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,11 +19,14 @@ import (
 )
 
 const (
-	_MIGRATOR_POSTGRES_DSN = "postgresql://%s:%s@%s:%d/%s?sslmode=%s&x-multi-statement=true"
+	_MIGRATOR_POSTGRES_DSN       = "postgresql://%s:%s@%s:%d/%s?sslmode=%s&x-multi-statement=true"
+	_MIGRATOR_MIGRATION_FILENAME = "%06d_%s.%s.sql"
 )
 
 var (
 	_MIGRATOR_ERR_CONNECTION_ALREADY_CLOSED = regexp.MustCompile(`.*connection is already closed.*`)
+	_MIGRATOR_MIGRATION_FILE                = regexp.MustCompile(`^(\d+)_(.+)\.(?:up|down)\.sql$`)
+	_MIGRATOR_MIGRATION_NAME                = regexp.MustCompile(`^[a-z0-9]+(?:_[a-z0-9]+)*$`)
 )
 
 var (
@@ -52,6 +57,24 @@ type MigratorConfig struct {
 	MigrationsPath   *string
 }
 
+// Validate returns the first invalid field of the config, nil pointers being left to the defaults.
+func (self MigratorConfig) Validate() error {
+	switch {
+	case self.DatabaseHost == "":
+		return ErrMigratorGeneric.Raise().With("migrator config database host is empty")
+	case !_isValidPort(self.DatabasePort):
+		return ErrMigratorGeneric.Raise().With("migrator config database port %d is out of range", self.DatabasePort)
+	case self.DatabaseUser == "":
+		return ErrMigratorGeneric.Raise().With("migrator config database user is empty")
+	case self.DatabaseName == "":
+		return ErrMigratorGeneric.Raise().With("migrator config database name is empty")
+	case self.MigrationsPath != nil && *self.MigrationsPath == "":
+		return ErrMigratorGeneric.Raise().With("migrator config migrations path is empty")
+	}
+
+	return nil
+}
+
 type Migrator struct {
 	config   MigratorConfig
 	observer *Observer
@@ -64,6 +87,11 @@ func NewMigrator(ctx context.Context, observer *Observer, config MigratorConfig,
 	util.Merge(&config, _MIGRATOR_DEFAULT_CONFIG)
 	_retry := util.Optional(retry, _MIGRATOR_DEFAULT_RETRY_CONFIG)
 
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
 	*config.MigrationsPath = fmt.Sprintf("file://%s", filepath.Clean(*config.MigrationsPath))
 
 	dsn := fmt.Sprintf(
@@ -78,14 +106,14 @@ func NewMigrator(ctx context.Context, observer *Observer, config MigratorConfig,
 
 	var migrator *migrate.Migrate
 
-	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
-		return util.ExponentialRetry(
-			_retry.Attempts, _retry.InitialDelay, _retry.LimitDelay,
+	err = util.Deadline(ctx, func(exceeded <-chan struct{}) error {
+		return util.BudgetedExponentialRetry(
+			ctx, _retry.Attempts, _retry.InitialDelay, _retry.LimitDelay, _retry.Jitter, _retry.MaxElapsed,
 			_retry.Retriables, func(attempt int) error {
 				var err error
 
-				observer.Infof(ctx, "Trying to connect to the %s database %d/%d",
-					config.DatabaseName, attempt, _retry.Attempts)
+				observer.WithLevelf(ctx, _retryAttemptLevel(attempt, _retry.Attempts),
+					"Trying to connect to the %s database %d/%d", config.DatabaseName, attempt, _retry.Attempts)
 
 				migrator, err = migrate.New(*config.MigrationsPath, dsn)
 				if err != nil {
@@ -359,6 +387,88 @@ func (self *Migrator) Rollback(ctx context.Context, schemaVersion int) error {
 	return nil
 }
 
+// To applies or rollbacks the migrations needed to converge from the current schema version to schemaVersion.
+// A dirty current schema version is only handled when rolling back, as in Rollback.
+func (self *Migrator) To(ctx context.Context, schemaVersion int) error {
+	currentSchemaVersion, _, err := self.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if currentSchemaVersion > schemaVersion {
+		return self.Rollback(ctx, schemaVersion)
+	}
+
+	return self.Apply(ctx, schemaVersion)
+}
+
+// Create writes the empty up and down files of a new migration named name, in snake case, at the migrations
+// path with the next sequential version, returning their paths. It fails if a migration named name exists.
+func (self *Migrator) Create(name string) (string, string, error) {
+	if !_MIGRATOR_MIGRATION_NAME.MatchString(name) {
+		return "", "", ErrMigratorGeneric.Raise().With("migration name %s is not in snake case", name)
+	}
+
+	path := strings.TrimPrefix(*self.config.MigrationsPath, "file://")
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", "", ErrMigratorGeneric.Raise().Cause(err)
+	}
+
+	lastVersion := 0
+
+	for _, entry := range entries {
+		match := _MIGRATOR_MIGRATION_FILE.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		if match[2] == name {
+			return "", "", ErrMigratorGeneric.Raise().With("migration %s already exists", entry.Name())
+		}
+
+		version, err := strconv.Atoi(match[1]) // nolint:govet
+		if err != nil {
+			return "", "", ErrMigratorGeneric.Raise().Cause(err)
+		}
+
+		lastVersion = max(lastVersion, version)
+	}
+
+	up := filepath.Join(path, fmt.Sprintf(_MIGRATOR_MIGRATION_FILENAME, lastVersion+1, name, "up"))
+	down := filepath.Join(path, fmt.Sprintf(_MIGRATOR_MIGRATION_FILENAME, lastVersion+1, name, "down"))
+
+	err = _createMigrationFile(up)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = _createMigrationFile(down)
+	if err != nil {
+		_ = os.Remove(up)
+		return "", "", err
+	}
+
+	self.observer.Infof(context.Background(), "Created migration %d %s", lastVersion+1, name)
+
+	return up, down, nil
+}
+
+func _createMigrationFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644) // nolint:gosec
+	if err != nil {
+		return ErrMigratorGeneric.Raise().Cause(err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return ErrMigratorGeneric.Raise().Cause(err)
+	}
+
+	return nil
+}
+
 func (self *Migrator) Close(ctx context.Context) error {
 	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
 		self.observer.Info(ctx, "Closing migrator")
@@ -0,0 +1,62 @@
+package kit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/neoxelox/kit/util"
+)
+
+func TestMigratorCreate(t *testing.T) {
+	observer, err := NewObserver(context.Background(), ObserverConfig{
+		Environment: EnvIntegration,
+		Service:     "kit",
+		Level:       LvlNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := t.TempDir()
+
+	for _, file := range []string{"000001_init.up.sql", "000001_init.down.sql", "000009_users.up.sql", "README.md"} {
+		err = os.WriteFile(filepath.Join(path, file), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrator := &Migrator{
+		config:   MigratorConfig{MigrationsPath: util.Pointer("file://" + path)},
+		observer: observer,
+	}
+
+	up, down, err := migrator.Create("add_orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if up != filepath.Join(path, "000010_add_orders.up.sql") ||
+		down != filepath.Join(path, "000010_add_orders.down.sql") {
+		t.Fatalf("expected migration version 10, got %s and %s", up, down)
+	}
+
+	for _, file := range []string{up, down} {
+		_, err = os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, _, err = migrator.Create("users")
+	if !ErrMigratorGeneric.Is(err) {
+		t.Fatalf("expected duplicate migration error, got %v", err)
+	}
+
+	_, _, err = migrator.Create("Add Orders")
+	if !ErrMigratorGeneric.Is(err) {
+		t.Fatalf("expected invalid name error, got %v", err)
+	}
+}
@@ -4,8 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -14,24 +21,45 @@ import (
 	"github.com/neoxelox/errors"
 	"github.com/neoxelox/gilk"
 	"github.com/rs/xid"
+	"github.com/rs/zerolog"
 
 	"github.com/neoxelox/kit/util"
 )
 
 const (
-	_OBSERVER_REQUEST_TRACE_ID_HEADER = "X-Trace-Id"
-	_OBSERVER_TASK_TRACE_ID_HEADER    = "x_trace_id"
-	_OBSERVER_SENTRY_TRACE_ID_TAG     = "trace_id"
-	_OBSERVER_SENTRY_FLUSH_TIMEOUT    = 5 * time.Second
+	_OBSERVER_REQUEST_TRACE_ID_HEADER    = "X-Trace-Id"
+	_OBSERVER_REQUEST_TRACEPARENT_HEADER = "Traceparent"
+	_OBSERVER_REQUEST_TRACESTATE_HEADER  = "Tracestate"
+	_OBSERVER_TASK_TRACE_ID_HEADER       = "x_trace_id"
+	_OBSERVER_TASK_TRACEPARENT_HEADER    = "traceparent"
+	_OBSERVER_SENTRY_TRACE_ID_TAG        = "trace_id"
+	_OBSERVER_SENTRY_REQUEST_ID_TAG      = "request_id"
+	_OBSERVER_SENTRY_FLUSH_TIMEOUT       = 5 * time.Second
+	_OBSERVER_SENTRY_REDACTED_VALUE      = "[REDACTED]"
+	_OBSERVER_SENTRY_FAILURE_INTERVAL    = 1 * time.Minute
 )
 
 var (
+	_OBSERVER_TRACEPARENT = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+)
+
+var (
+	// Deprecated: KeyTraceID is no longer set by kit, use Context.TraceID instead.
 	KeyTraceID Key = KeyBase + "trace:id"
+	// Deprecated: KeyTraceState is no longer set by kit, use Context.TraceState instead.
+	KeyTraceState Key = KeyBase + "trace:state"
+	// Deprecated: KeyObserverLogger is no longer set by kit in the context.Context, use Context.Logger
+	// instead. It is still the key of the logger in the echo context.
+	KeyObserverLogger Key = KeyBase + "observer:logger"
+	// Deprecated: KeyRequestID is no longer set by kit in the context.Context, use Context.RequestID
+	// instead. It is still the key of the request ID in the echo context.
+	KeyRequestID Key = KeyBase + "request:id"
 )
 
 var (
-	ErrObserverGeneric  = errors.New("observer failed")
-	ErrObserverTimedOut = errors.New("observer timed out")
+	ErrObserverGeneric   = errors.New("observer failed")
+	ErrObserverTimedOut  = errors.New("observer timed out")
+	ErrObserverUnhealthy = errors.New("observer unhealthy")
 )
 
 var (
@@ -40,6 +68,13 @@ var (
 		Gilk:   nil,
 	}
 
+	_OBSERVER_SENTRY_DEFAULT_CONFIG = ObserverSentryConfig{
+		TracesSampleRate:   util.Pointer(0.25),
+		ProfilesSampleRate: util.Pointer(1.0),
+		ScrubFields: util.Pointer([]string{"authorization", "cookie", "api_key", "password", "secret", "token",
+			"session", "email", "phone"}),
+	}
+
 	_OBSERVER_DEFAULT_RETRY_CONFIG = RetryConfig{
 		Attempts:     1,
 		InitialDelay: 0 * time.Second,
@@ -48,8 +83,17 @@ var (
 	}
 )
 
+// ObserverSentryConfig TracesSampleRate is the fraction of the requests, tasks and commands sent as
+// performance transactions, and ProfilesSampleRate the fraction of those transactions also profiled.
+// The values of the headers, query params, extra, tags, contexts and user fields whose names contain
+// any of the ScrubFields, case and dash insensitive, are redacted before any event is sent. BeforeSend
+// is then called with the scrubbed event to further redact it or to drop it by returning nil.
 type ObserverSentryConfig struct {
-	Dsn string
+	Dsn                string
+	TracesSampleRate   *float64
+	ProfilesSampleRate *float64
+	ScrubFields        *[]string
+	BeforeSend         func(event *sentry.Event) *sentry.Event
 }
 
 type ObserverGilkConfig struct {
@@ -61,12 +105,209 @@ type ObserverConfig struct {
 	Release     string
 	Service     string
 	Level       Level
+	Format      *LoggerFormat
+	Output      io.Writer
+	Rotation    *LoggerRotationConfig
 	Sentry      *ObserverSentryConfig
 	Gilk        *ObserverGilkConfig
 }
 
+// Validate returns the first invalid field of the config, nil pointers being left to the defaults.
+func (self ObserverConfig) Validate() error {
+	switch {
+	case self.Service == "":
+		return ErrObserverGeneric.Raise().With("observer config service is empty")
+	case self.Level < LvlTrace || self.Level > LvlNone:
+		return ErrObserverGeneric.Raise().With("observer config level %d is unknown", self.Level)
+	case self.Format != nil && *self.Format != LoggerFormatText && *self.Format != LoggerFormatJSON:
+		return ErrObserverGeneric.Raise().With("observer config format %s is unknown", *self.Format)
+	case self.Sentry != nil && self.Sentry.Dsn == "":
+		return ErrObserverGeneric.Raise().With("observer config sentry dsn is empty")
+	case self.Sentry != nil && !_isValidSentryDsn(self.Sentry.Dsn):
+		// The DSN is not part of the error as it holds the Sentry key
+		return ErrObserverGeneric.Raise().With("observer config sentry dsn is malformed")
+	case self.Sentry != nil && self.Sentry.TracesSampleRate != nil &&
+		(*self.Sentry.TracesSampleRate < 0 || *self.Sentry.TracesSampleRate > 1):
+		return ErrObserverGeneric.Raise().With(
+			"observer config sentry traces sample rate %f is not between 0 and 1", *self.Sentry.TracesSampleRate)
+	case self.Sentry != nil && self.Sentry.ProfilesSampleRate != nil &&
+		(*self.Sentry.ProfilesSampleRate < 0 || *self.Sentry.ProfilesSampleRate > 1):
+		return ErrObserverGeneric.Raise().With(
+			"observer config sentry profiles sample rate %f is not between 0 and 1", *self.Sentry.ProfilesSampleRate)
+	case self.Gilk != nil && !_isValidPort(self.Gilk.Port):
+		return ErrObserverGeneric.Raise().With("observer config gilk port %d is out of range", self.Gilk.Port)
+	}
+
+	return nil
+}
+
+// _isValidSentryDsn is needed as the Sentry client accepts some malformed DSNs, such as the ones without
+// project, only to fail sending every event afterwards.
+func _isValidSentryDsn(dsn string) bool {
+	_, err := sentry.NewDsn(dsn)
+	return err == nil
+}
+
+// _observerSentryTransport counts the events that the Sentry service rejects or that cannot reach it, which
+// the Sentry client only logs in debug mode, warning about them at most once per interval so that a broken
+// Sentry, for example because of a revoked DSN, is noticed through the logs rather than during an incident.
+type _observerSentryTransport struct {
+	base       http.RoundTripper
+	logger     *Logger
+	failures   *atomic.Int64
+	reported   *atomic.Int64
+	reportedAt *atomic.Int64
+}
+
+func _newObserverSentryTransport(logger *Logger) *_observerSentryTransport {
+	return &_observerSentryTransport{
+		base:       http.DefaultTransport,
+		logger:     logger,
+		failures:   &atomic.Int64{},
+		reported:   &atomic.Int64{},
+		reportedAt: &atomic.Int64{},
+	}
+}
+
+func (self *_observerSentryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := self.base.RoundTrip(request)
+
+	switch {
+	case err != nil:
+		self.fail(err.Error())
+	case response.StatusCode >= http.StatusBadRequest:
+		self.fail(response.Status)
+	}
+
+	return response, err
+}
+
+func (self *_observerSentryTransport) fail(reason string) {
+	self.failures.Add(1)
+
+	now := time.Now().UnixNano()
+	reportedAt := self.reportedAt.Load()
+
+	if now-reportedAt < int64(_OBSERVER_SENTRY_FAILURE_INTERVAL) || !self.reportedAt.CompareAndSwap(reportedAt, now) {
+		return
+	}
+
+	failures := self.failures.Load()
+
+	self.logger.Warnf("Failed to send %d events to the Sentry service: %s",
+		failures-self.reported.Swap(failures), reason)
+}
+
+type _observerSentryScrubber struct {
+	fields []string
+}
+
+func _newObserverSentryScrubber(fields []string) *_observerSentryScrubber {
+	normalized := make([]string, 0, len(fields))
+	for _, field := range fields {
+		normalized = append(normalized, strings.ReplaceAll(strings.ToLower(field), "-", "_"))
+	}
+
+	return &_observerSentryScrubber{
+		fields: normalized,
+	}
+}
+
+func (self _observerSentryScrubber) denied(name string) bool {
+	name = strings.ReplaceAll(strings.ToLower(name), "-", "_")
+
+	for _, field := range self.fields {
+		if strings.Contains(name, field) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self _observerSentryScrubber) scrubMap(values map[string]any) {
+	for key, value := range values {
+		if self.denied(key) {
+			values[key] = _OBSERVER_SENTRY_REDACTED_VALUE
+			continue
+		}
+
+		if nested, ok := value.(map[string]any); ok {
+			self.scrubMap(nested)
+		}
+	}
+}
+
+func (self _observerSentryScrubber) scrubStringMap(values map[string]string) {
+	for key := range values {
+		if self.denied(key) {
+			values[key] = _OBSERVER_SENTRY_REDACTED_VALUE
+		}
+	}
+}
+
+// Scrub redacts the denied fields of the event in place.
+func (self _observerSentryScrubber) Scrub(event *sentry.Event) *sentry.Event {
+	if event == nil {
+		return nil
+	}
+
+	if event.Request != nil {
+		self.scrubStringMap(event.Request.Headers)
+
+		if event.Request.Cookies != "" && self.denied("cookie") {
+			event.Request.Cookies = _OBSERVER_SENTRY_REDACTED_VALUE
+		}
+
+		if event.Request.QueryString != "" {
+			query, err := url.ParseQuery(event.Request.QueryString)
+			if err != nil {
+				event.Request.QueryString = _OBSERVER_SENTRY_REDACTED_VALUE
+			} else {
+				for key := range query {
+					if self.denied(key) {
+						query[key] = []string{_OBSERVER_SENTRY_REDACTED_VALUE}
+					}
+				}
+
+				event.Request.QueryString = query.Encode()
+			}
+		}
+	}
+
+	if event.User.Email != "" && self.denied("email") {
+		event.User.Email = _OBSERVER_SENTRY_REDACTED_VALUE
+	}
+
+	if event.User.Username != "" && self.denied("username") {
+		event.User.Username = _OBSERVER_SENTRY_REDACTED_VALUE
+	}
+
+	self.scrubStringMap(event.User.Data)
+	self.scrubStringMap(event.Tags)
+	self.scrubMap(event.Extra)
+
+	for _, eventContext := range event.Contexts {
+		self.scrubMap(eventContext)
+	}
+
+	for _, breadcrumb := range event.Breadcrumbs {
+		self.scrubMap(breadcrumb.Data)
+	}
+
+	return event
+}
+
+type _observerFlusher struct {
+	name  string
+	flush func(ctx context.Context) error
+}
+
 type Observer struct {
-	config ObserverConfig
+	config          ObserverConfig
+	flushers        *[]_observerFlusher
+	mutex           *sync.Mutex
+	sentryTransport *_observerSentryTransport
 	Logger
 }
 
@@ -74,30 +315,66 @@ func NewObserver(ctx context.Context, config ObserverConfig, retry ...RetryConfi
 	util.Merge(&config, _OBSERVER_DEFAULT_CONFIG)
 	_retry := util.Optional(retry, _OBSERVER_DEFAULT_RETRY_CONFIG)
 
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Sentry != nil {
+		sentryConfig := *config.Sentry
+		util.Merge(&sentryConfig, _OBSERVER_SENTRY_DEFAULT_CONFIG)
+		config.Sentry = &sentryConfig
+	}
+
 	logger := NewLogger(LoggerConfig{
 		Service:        config.Service,
 		Level:          config.Level,
+		Format:         config.Format,
+		Output:         config.Output,
+		Rotation:       config.Rotation,
 		SkipFrameCount: util.Pointer(2),
 	})
 
+	logger.Extract("trace_id", _contextKeyTraceID)
+	logger.Extract("request_id", _contextKeyRequestID)
+
+	var sentryTransport *_observerSentryTransport
+
 	if config.Sentry != nil {
-		err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
-			return util.ExponentialRetry(
-				_retry.Attempts, _retry.InitialDelay, _retry.LimitDelay,
+		sentryTransport = _newObserverSentryTransport(logger)
+
+		err = util.Deadline(ctx, func(exceeded <-chan struct{}) error {
+			return util.BudgetedExponentialRetry(
+				ctx, _retry.Attempts, _retry.InitialDelay, _retry.LimitDelay, _retry.Jitter, _retry.MaxElapsed,
 				_retry.Retriables, func(attempt int) error {
-					logger.Infof("Trying to connect to the Sentry service %d/%d", attempt, _retry.Attempts)
+					logger.WithLevelf(_retryAttemptLevel(attempt, _retry.Attempts),
+						"Trying to connect to the Sentry service %d/%d", attempt, _retry.Attempts)
+
+					scrubber := _newObserverSentryScrubber(*config.Sentry.ScrubFields)
+					beforeSend := func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+						event = scrubber.Scrub(event)
+
+						if config.Sentry.BeforeSend != nil {
+							event = config.Sentry.BeforeSend(event)
+						}
+
+						return event
+					}
 
 					err := sentry.Init(sentry.ClientOptions{
-						Dsn:                config.Sentry.Dsn,
-						Environment:        string(config.Environment),
-						Release:            config.Release,
-						ServerName:         config.Service,
-						Debug:              false,
-						AttachStacktrace:   false, // Already done by errors package
-						EnableTracing:      true,
-						SampleRate:         1.0,  // Error events
-						TracesSampleRate:   0.25, // Transaction events
-						ProfilesSampleRate: 1.0,  // Profiling events out of Transaction events
+						Dsn:                   config.Sentry.Dsn,
+						Environment:           string(config.Environment),
+						Release:               config.Release,
+						ServerName:            config.Service,
+						Debug:                 false,
+						AttachStacktrace:      false, // Already done by errors package
+						EnableTracing:         *config.Sentry.TracesSampleRate > 0,
+						SampleRate:            1.0, // Error events
+						TracesSampleRate:      *config.Sentry.TracesSampleRate,
+						ProfilesSampleRate:    *config.Sentry.ProfilesSampleRate,
+						BeforeSend:            beforeSend,
+						BeforeSendTransaction: beforeSend,
+						HTTPTransport:         sentryTransport,
 					})
 					if err != nil {
 						return ErrObserverGeneric.Raise().Cause(err)
@@ -134,73 +411,103 @@ func NewObserver(ctx context.Context, config ObserverConfig, retry ...RetryConfi
 	}
 
 	return &Observer{
-		config: config,
-		Logger: *logger,
+		config:          config,
+		flushers:        &[]_observerFlusher{},
+		mutex:           &sync.Mutex{},
+		sentryTransport: sentryTransport,
+		Logger:          *logger,
 	}, nil
 }
 
-func (self Observer) Print(_ context.Context, i ...any) {
+// SentryFailures returns the number of events that failed to be sent to the Sentry service so far,
+// to be exported as a metric, or 0 when Sentry is not configured.
+func (self Observer) SentryFailures() int64 {
+	if self.sentryTransport == nil {
+		return 0
+	}
+
+	return self.sentryTransport.failures.Load()
+}
+
+// RegisterFlusher registers the flush of a telemetry backend, such as a trace exporter or a metrics
+// pushgateway, so that Flush and Close drain it within their same deadline before the process exits.
+func (self *Observer) RegisterFlusher(name string, flush func(ctx context.Context) error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	*self.flushers = append(*self.flushers, _observerFlusher{
+		name:  name,
+		flush: flush,
+	})
+}
+
+// withContext returns the logger enriched with the registered context values present in the context.
+func (self Observer) withContext(ctx context.Context) Logger {
+	return self.Logger.WithContext(ctx)
+}
+
+func (self Observer) Print(ctx context.Context, i ...any) {
 	if !(LvlTrace >= self.config.Level) {
 		return
 	}
 
-	self.Logger.Print(i...)
+	self.withContext(ctx).Print(i...)
 }
 
-func (self Observer) Printf(_ context.Context, format string, i ...any) {
+func (self Observer) Printf(ctx context.Context, format string, i ...any) {
 	if !(LvlTrace >= self.config.Level) {
 		return
 	}
 
-	self.Logger.Printf(format, i...)
+	self.withContext(ctx).Printf(format, i...)
 }
 
-func (self Observer) Debug(_ context.Context, i ...any) {
+func (self Observer) Debug(ctx context.Context, i ...any) {
 	if !(LvlDebug >= self.config.Level) {
 		return
 	}
 
-	self.Logger.Debug(i...)
+	self.withContext(ctx).Debug(i...)
 }
 
-func (self Observer) Debugf(_ context.Context, format string, i ...any) {
+func (self Observer) Debugf(ctx context.Context, format string, i ...any) {
 	if !(LvlDebug >= self.config.Level) {
 		return
 	}
 
-	self.Logger.Debugf(format, i...)
+	self.withContext(ctx).Debugf(format, i...)
 }
 
-func (self Observer) Info(_ context.Context, i ...any) {
+func (self Observer) Info(ctx context.Context, i ...any) {
 	if !(LvlInfo >= self.config.Level) {
 		return
 	}
 
-	self.Logger.Info(i...)
+	self.withContext(ctx).Info(i...)
 }
 
-func (self Observer) Infof(_ context.Context, format string, i ...any) {
+func (self Observer) Infof(ctx context.Context, format string, i ...any) {
 	if !(LvlInfo >= self.config.Level) {
 		return
 	}
 
-	self.Logger.Infof(format, i...)
+	self.withContext(ctx).Infof(format, i...)
 }
 
-func (self Observer) Warn(_ context.Context, i ...any) {
+func (self Observer) Warn(ctx context.Context, i ...any) {
 	if !(LvlWarn >= self.config.Level) {
 		return
 	}
 
-	self.Logger.Warn(i...)
+	self.withContext(ctx).Warn(i...)
 }
 
-func (self Observer) Warnf(_ context.Context, format string, i ...any) {
+func (self Observer) Warnf(ctx context.Context, format string, i ...any) {
 	if !(LvlWarn >= self.config.Level) {
 		return
 	}
 
-	self.Logger.Warnf(format, i...)
+	self.withContext(ctx).Warnf(format, i...)
 }
 
 func (self Observer) sendErrorToSentry(ctx context.Context, i ...any) {
@@ -254,7 +561,7 @@ func (self Observer) Error(ctx context.Context, i ...any) {
 		return
 	}
 
-	self.Logger.Error(i...)
+	self.withContext(ctx).Error(i...)
 
 	if self.config.Sentry != nil {
 		self.sendErrorToSentry(ctx, i...)
@@ -266,7 +573,7 @@ func (self Observer) Errorf(ctx context.Context, format string, i ...any) {
 		return
 	}
 
-	self.Logger.Errorf(format, i...)
+	self.withContext(ctx).Errorf(format, i...)
 
 	if self.config.Sentry != nil {
 		self.sendErrorToSentry(ctx, fmt.Sprintf(format, i...))
@@ -278,7 +585,7 @@ func (self Observer) Fatal(ctx context.Context, i ...any) {
 		return
 	}
 
-	self.Logger.Fatal(i...)
+	self.withContext(ctx).Fatal(i...)
 
 	if self.config.Sentry != nil {
 		self.sendErrorToSentry(ctx, i...)
@@ -290,7 +597,7 @@ func (self Observer) Fatalf(ctx context.Context, format string, i ...any) {
 		return
 	}
 
-	self.Logger.Fatalf(format, i...)
+	self.withContext(ctx).Fatalf(format, i...)
 
 	if self.config.Sentry != nil {
 		self.sendErrorToSentry(ctx, fmt.Sprintf(format, i...))
@@ -302,7 +609,7 @@ func (self Observer) Panic(ctx context.Context, i ...any) {
 		return
 	}
 
-	self.Logger.Panic(i...)
+	self.withContext(ctx).Panic(i...)
 
 	if self.config.Sentry != nil {
 		self.sendErrorToSentry(ctx, i...)
@@ -314,7 +621,7 @@ func (self Observer) Panicf(ctx context.Context, format string, i ...any) {
 		return
 	}
 
-	self.Logger.Panicf(format, i...)
+	self.withContext(ctx).Panicf(format, i...)
 
 	if self.config.Sentry != nil {
 		self.sendErrorToSentry(ctx, fmt.Sprintf(format, i...))
@@ -351,18 +658,75 @@ func (self Observer) WithLevelf(ctx context.Context, level Level, format string,
 	}
 }
 
+// Recover is meant to be deferred at the top of the goroutines that are not handled by the Recover
+// middleware, so that their panics are logged and sent to Sentry with their stack trace instead of
+// crashing the process. In development the panic is raised again to fail loudly.
+func (self Observer) Recover(ctx context.Context) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+
+	err, ok := rec.(error)
+	if !ok {
+		err = ErrObserverGeneric.Raise().Skip(1).With("recovered panic: %v", rec)
+	} else {
+		err = ErrObserverGeneric.Raise().Skip(1).With("recovered panic").Cause(err)
+	}
+
+	self.Error(ctx, err)
+
+	if self.config.Environment == EnvDevelopment {
+		panic(err)
+	}
+}
+
 func (self Observer) SetTrace(ctx context.Context, traceID string) context.Context {
-	return context.WithValue(ctx, KeyTraceID, traceID)
+	return Context.WithTraceID(ctx, traceID)
 }
 
 func (self Observer) GetTrace(ctx context.Context) string {
-	if ctxTraceID, ok := ctx.Value(KeyTraceID).(string); ok {
+	if ctxTraceID, ok := Context.TraceID(ctx); ok {
 		return ctxTraceID
 	}
 
 	return xid.New().String()
 }
 
+// LoggerFromContext returns the request-scoped logger injected by the observer middleware,
+// or a disabled logger when there is none.
+func LoggerFromContext(ctx context.Context) *zerolog.Logger {
+	if ctxLogger, ok := Context.Logger(ctx); ok {
+		return ctxLogger
+	}
+
+	return zerolog.Ctx(ctx)
+}
+
+func (self Observer) SetRequestID(ctx context.Context, requestID string) context.Context {
+	ctx = Context.WithRequestID(ctx, requestID)
+
+	if self.config.Sentry != nil {
+		sentryHub := sentry.GetHubFromContext(ctx)
+		if sentryHub == nil {
+			sentryHub = sentry.CurrentHub().Clone()
+			ctx = sentry.SetHubOnContext(ctx, sentryHub)
+		}
+
+		sentryHub.Scope().SetTag(_OBSERVER_SENTRY_REQUEST_ID_TAG, requestID)
+	}
+
+	return ctx
+}
+
+func (self Observer) GetRequestID(ctx context.Context) string {
+	if ctxRequestID, ok := Context.RequestID(ctx); ok {
+		return ctxRequestID
+	}
+
+	return ""
+}
+
 func (self Observer) TraceSpan(ctx context.Context, name ...string) (context.Context, func()) {
 	traceID := self.GetTrace(ctx)
 	ctx = self.SetTrace(ctx, traceID)
@@ -404,6 +768,11 @@ func (self Observer) TraceServerRequest(ctx context.Context, request *http.Reque
 	}
 	ctx = self.SetTrace(ctx, traceID)
 
+	// Keep the vendor specific W3C trace state so that it is propagated to the downstream services
+	if traceState := request.Header.Get(_OBSERVER_REQUEST_TRACESTATE_HEADER); traceState != "" {
+		ctx = Context.WithTraceState(ctx, traceState)
+	}
+
 	spanName := fmt.Sprintf("%s %s", request.Method, request.RequestURI)
 
 	var endGilkRequest func()
@@ -416,8 +785,12 @@ func (self Observer) TraceServerRequest(ctx context.Context, request *http.Reque
 		sentryTrace := ""
 		if request.Header.Get(sentry.SentryTraceHeader) != "" {
 			sentryTrace = request.Header.Get(sentry.SentryTraceHeader)
+		} else if request.Header.Get(_OBSERVER_REQUEST_TRACEPARENT_HEADER) != "" {
+			sentryTrace = _traceparentToSentryTrace(request.Header.Get(_OBSERVER_REQUEST_TRACEPARENT_HEADER))
 		}
 
+		sentryBaggage := request.Header.Get(sentry.SentryBaggageHeader)
+
 		sentryHub := sentry.GetHubFromContext(ctx)
 		if sentryHub == nil {
 			sentryHub = sentry.CurrentHub().Clone()
@@ -432,9 +805,9 @@ func (self Observer) TraceServerRequest(ctx context.Context, request *http.Reque
 
 		if sentry.TransactionFromContext(ctx) == nil {
 			sentrySpan = sentry.StartTransaction(ctx, spanName, sentry.WithOpName(spanName),
-				sentry.WithTransactionSource(sentry.SourceURL), sentry.ContinueFromTrace(sentryTrace))
+				sentry.WithTransactionSource(sentry.SourceURL), sentry.ContinueFromHeaders(sentryTrace, sentryBaggage))
 		} else {
-			sentrySpan = sentry.StartSpan(ctx, spanName, sentry.ContinueFromTrace(sentryTrace))
+			sentrySpan = sentry.StartSpan(ctx, spanName, sentry.ContinueFromHeaders(sentryTrace, sentryBaggage))
 		}
 
 		ctx = sentrySpan.Context()
@@ -457,6 +830,10 @@ func (self Observer) TraceClientRequest(ctx context.Context, request *http.Reque
 
 	request.Header.Set(_OBSERVER_REQUEST_TRACE_ID_HEADER, traceID)
 
+	if traceState, ok := Context.TraceState(ctx); ok {
+		request.Header.Set(_OBSERVER_REQUEST_TRACESTATE_HEADER, traceState)
+	}
+
 	spanName := fmt.Sprintf("%s %s", request.Method, request.URL)
 
 	var sentrySpan *sentry.Span
@@ -478,6 +855,8 @@ func (self Observer) TraceClientRequest(ctx context.Context, request *http.Reque
 		}
 
 		request.Header.Set(sentry.SentryTraceHeader, sentrySpan.ToSentryTrace())
+		request.Header.Set(sentry.SentryBaggageHeader, sentrySpan.ToBaggage())
+		request.Header.Set(_OBSERVER_REQUEST_TRACEPARENT_HEADER, _spanToTraceparent(sentrySpan))
 
 		ctx = sentrySpan.Context()
 	}
@@ -522,6 +901,10 @@ func (self Observer) TraceQuery(ctx context.Context, sql string, args ...any) (c
 			sentrySpan = sentry.StartSpan(ctx, spanName)
 		}
 
+		if requestID := self.GetRequestID(ctx); requestID != "" {
+			sentrySpan.SetTag(_OBSERVER_SENTRY_REQUEST_ID_TAG, requestID)
+		}
+
 		ctx = sentrySpan.Context()
 	}
 
@@ -552,8 +935,12 @@ func (self Observer) TraceTask(ctx context.Context, task *asynq.Task) (context.C
 		sentryTrace := ""
 		if data[sentry.SentryTraceHeader] != nil {
 			sentryTrace = data[sentry.SentryTraceHeader].(string)
+		} else if traceparent, ok := data[_OBSERVER_TASK_TRACEPARENT_HEADER].(string); ok {
+			sentryTrace = _traceparentToSentryTrace(traceparent)
 		}
 
+		sentryBaggage, _ := data[sentry.SentryBaggageHeader].(string)
+
 		sentryHub := sentry.GetHubFromContext(ctx)
 		if sentryHub == nil {
 			sentryHub = sentry.CurrentHub().Clone()
@@ -564,9 +951,9 @@ func (self Observer) TraceTask(ctx context.Context, task *asynq.Task) (context.C
 
 		if sentry.TransactionFromContext(ctx) == nil {
 			sentrySpan = sentry.StartTransaction(ctx, spanName, sentry.WithOpName(spanName),
-				sentry.WithTransactionSource(sentry.SourceTask), sentry.ContinueFromTrace(sentryTrace))
+				sentry.WithTransactionSource(sentry.SourceTask), sentry.ContinueFromHeaders(sentryTrace, sentryBaggage))
 		} else {
-			sentrySpan = sentry.StartSpan(ctx, spanName, sentry.ContinueFromTrace(sentryTrace))
+			sentrySpan = sentry.StartSpan(ctx, spanName, sentry.ContinueFromHeaders(sentryTrace, sentryBaggage))
 		}
 
 		ctx = sentrySpan.Context()
@@ -612,25 +999,75 @@ func (self Observer) TraceCommand(ctx context.Context, command *cli.Context) (co
 	}
 }
 
+// _spanToTraceparent serializes the span as a W3C trace context, which OpenTelemetry understands.
+func _spanToTraceparent(span *sentry.Span) string {
+	flags := "00"
+	if span.Sampled.Bool() {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", span.TraceID.Hex(), span.SpanID.Hex(), flags)
+}
+
+// _traceparentToSentryTrace converts a W3C trace context into a Sentry trace, empty if it is not valid.
+func _traceparentToSentryTrace(traceparent string) string {
+	matches := _OBSERVER_TRACEPARENT.FindStringSubmatch(strings.ToLower(strings.TrimSpace(traceparent)))
+	if matches == nil || strings.Trim(matches[1], "0") == "" || strings.Trim(matches[2], "0") == "" {
+		return ""
+	}
+
+	flags, err := strconv.ParseUint(matches[3], 16, 8)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s-%s-%d", matches[1], matches[2], flags&1)
+}
+
+// Health checks that the configured telemetry backends are initialized. Sentry sends the events
+// asynchronously, so its reachability is only noticed when flushing.
+func (self Observer) Health(ctx context.Context) error {
+	if self.config.Sentry != nil && sentry.CurrentHub().Client() == nil {
+		return ErrObserverUnhealthy.Raise().With("sentry client not initialized")
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return ErrObserverUnhealthy.Raise().Cause(err)
+	}
+
+	return nil
+}
+
 func (self Observer) Flush(ctx context.Context) error {
-	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
+	err := util.DeadlineWithBudget(ctx, _OBSERVER_SENTRY_FLUSH_TIMEOUT, func(remaining func() time.Duration) error {
 		err := self.Logger.Flush(ctx)
 		if err != nil {
 			return err
 		}
 
 		if self.config.Sentry != nil {
-			sentryFlushTimeout := _OBSERVER_SENTRY_FLUSH_TIMEOUT
-			if ctxDeadline, ok := ctx.Deadline(); ok {
-				sentryFlushTimeout = time.Until(ctxDeadline)
-			}
-
-			ok := sentry.Flush(sentryFlushTimeout)
+			ok := sentry.Flush(remaining())
 			if !ok {
 				return ErrObserverGeneric.Raise().With("sentry lost events while flushing")
 			}
 		}
 
+		self.mutex.Lock()
+		flushers := *self.flushers
+		self.mutex.Unlock()
+
+		for _, flusher := range flushers {
+			err := flusher.flush(ctx)
+			if err != nil {
+				if util.Is(err, context.DeadlineExceeded, util.ErrDeadlineExceeded) {
+					return ErrObserverTimedOut.Raise().With("%s timed out while flushing", flusher.name).Cause(err)
+				}
+
+				return ErrObserverGeneric.Raise().With("%s lost telemetry while flushing", flusher.name).Cause(err)
+			}
+		}
+
 		if self.config.Gilk != nil {
 			gilk.Reset()
 		}
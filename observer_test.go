@@ -0,0 +1,96 @@
+package kit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestObserverSentryScrub(t *testing.T) {
+	scrubber := _newObserverSentryScrubber(*_OBSERVER_SENTRY_DEFAULT_CONFIG.ScrubFields)
+
+	event := sentry.NewEvent()
+	event.Request = &sentry.Request{
+		Headers:     map[string]string{"Authorization": "Bearer token", "X-Api-Key": "key", "Accept": "*/*"},
+		Cookies:     "session=id",
+		QueryString: "access_token=token&page=2",
+	}
+	event.User = sentry.User{Email: "user@example.com", IPAddress: "127.0.0.1"}
+	event.Extra["user_email"] = "user@example.com"
+	event.Extra["params"] = map[string]any{"password": "password", "name": "name"}
+
+	event = scrubber.Scrub(event)
+
+	if event.Request.Headers["Authorization"] != _OBSERVER_SENTRY_REDACTED_VALUE ||
+		event.Request.Headers["X-Api-Key"] != _OBSERVER_SENTRY_REDACTED_VALUE ||
+		event.Request.Headers["Accept"] != "*/*" {
+		t.Fatalf("expected denied headers to be redacted, got %v", event.Request.Headers)
+	}
+
+	if event.Request.Cookies != _OBSERVER_SENTRY_REDACTED_VALUE {
+		t.Fatalf("expected cookies to be redacted, got %s", event.Request.Cookies)
+	}
+
+	query, _ := url.ParseQuery(event.Request.QueryString)
+	if query.Get("access_token") != _OBSERVER_SENTRY_REDACTED_VALUE || query.Get("page") != "2" {
+		t.Fatalf("expected denied query params to be redacted, got %s", event.Request.QueryString)
+	}
+
+	if event.User.Email != _OBSERVER_SENTRY_REDACTED_VALUE || event.User.IPAddress != "127.0.0.1" {
+		t.Fatalf("expected user email to be redacted, got %v", event.User)
+	}
+
+	params := event.Extra["params"].(map[string]any)
+	if event.Extra["user_email"] != _OBSERVER_SENTRY_REDACTED_VALUE ||
+		params["password"] != _OBSERVER_SENTRY_REDACTED_VALUE || params["name"] != "name" {
+		t.Fatalf("expected denied extra to be redacted, got %v", event.Extra)
+	}
+}
+
+func TestObserverSentryDsn(t *testing.T) {
+	config := ObserverConfig{Service: "kit", Level: LvlNone}
+
+	config.Sentry = &ObserverSentryConfig{Dsn: "https://key@o0.ingest.sentry.io/1"}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("expected valid dsn, got %v", err)
+	}
+
+	for _, dsn := range []string{"sentry.io", "https://o0.ingest.sentry.io/1", "https://key@o0.ingest.sentry.io/"} {
+		config.Sentry = &ObserverSentryConfig{Dsn: dsn}
+		if err := config.Validate(); !ErrObserverGeneric.Is(err) {
+			t.Fatalf("expected malformed dsn %s error, got %v", dsn, err)
+		}
+	}
+}
+
+func TestObserverSentryTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	transport := _newObserverSentryTransport(NewLogger(LoggerConfig{Service: "kit", Level: LvlNone}))
+	observer := Observer{sentryTransport: transport}
+
+	for i := 0; i < 3; i++ {
+		request, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+
+		response, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response.Body.Close()
+	}
+
+	if observer.SentryFailures() != 3 {
+		t.Fatalf("expected 3 failures, got %d", observer.SentryFailures())
+	}
+
+	if transport.reported.Load() != 1 {
+		t.Fatalf("expected a single throttled warning, got %d reported failures", transport.reported.Load())
+	}
+}
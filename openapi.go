@@ -0,0 +1,357 @@
+package kit
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	_OPENAPI_VERSION         = "3.0.3"
+	_OPENAPI_SCHEMA_REF      = "#/components/schemas/%s"
+	_OPENAPI_CONTENT_TYPE    = "application/json"
+	_OPENAPI_WILDCARD_PARAM  = "wildcard"
+	_OPENAPI_DEFAULT_VERSION = "0.0.0"
+)
+
+var (
+	_OPENAPI_TIME_TYPE           = reflect.TypeOf(time.Time{})
+	_OPENAPI_TEXT_MARSHALER_TYPE = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// HTTPServerRouteMeta documents a route in the OpenAPI document. Request and Response are values, or nil
+// pointers, of the types bound from the request and sent as the Status response, which defaults to 200.
+// Request fields with a param or query tag are documented as path or query parameters while the rest of
+// them, named after their json tags, as the JSON body.
+type HTTPServerRouteMeta struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Request     any
+	Response    any
+	Status      int
+}
+
+type _httpServerRouteMeta struct {
+	method string
+	path   string
+	meta   HTTPServerRouteMeta
+}
+
+// OpenAPI returns a minimal OpenAPI 3 JSON document of the routes registered with Add. Schemas
+// are reflected from the Go types, named structs being referenced as components by their name.
+func (self *HTTPServer) OpenAPI() ([]byte, error) {
+	builder := &_openAPIBuilder{
+		schemas: make(map[string]any),
+	}
+
+	paths := make(map[string]map[string]any)
+
+	for _, route := range *self.metas {
+		path, params := _openAPIPath(route.path)
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+
+		paths[path][strings.ToLower(route.method)] = builder.operation(route.meta, params)
+	}
+
+	version := self.config.Release
+	if version == "" {
+		version = _OPENAPI_DEFAULT_VERSION
+	}
+
+	document := map[string]any{
+		"openapi": _OPENAPI_VERSION,
+		"info": map[string]any{
+			"title":   self.config.Service,
+			"version": version,
+		},
+		"paths": paths,
+	}
+
+	if len(builder.schemas) > 0 {
+		document["components"] = map[string]any{
+			"schemas": builder.schemas,
+		}
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, ErrHTTPServerGeneric.Raise().Cause(err)
+	}
+
+	return data, nil
+}
+
+// _openAPIPath converts the echo path params, such as :id and *, into OpenAPI path templates.
+func _openAPIPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	params := make([]string, 0)
+
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		case segment == "*":
+			params = append(params, _OPENAPI_WILDCARD_PARAM)
+			segments[i] = "{" + _OPENAPI_WILDCARD_PARAM + "}"
+		}
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+type _openAPIBuilder struct {
+	schemas map[string]any
+}
+
+func (self *_openAPIBuilder) operation(meta HTTPServerRouteMeta, pathParams []string) map[string]any {
+	operation := map[string]any{}
+
+	if meta.Summary != "" {
+		operation["summary"] = meta.Summary
+	}
+
+	if meta.Description != "" {
+		operation["description"] = meta.Description
+	}
+
+	if len(meta.Tags) > 0 {
+		operation["tags"] = meta.Tags
+	}
+
+	pathSchemas := make(map[string]any)
+	parameters := make([]any, 0, len(pathParams))
+	properties := make(map[string]any)
+	required := make([]string, 0)
+
+	if meta.Request != nil {
+		self.fields(_openAPIElem(reflect.TypeOf(meta.Request)), func(field reflect.StructField, schema any) {
+			if name := _openAPITagName(field.Tag.Get("param")); name != "" {
+				pathSchemas[name] = schema
+				return
+			}
+
+			if name := _openAPITagName(field.Tag.Get("query")); name != "" {
+				parameters = append(parameters, map[string]any{
+					"name":   name,
+					"in":     "query",
+					"schema": schema,
+				})
+				return
+			}
+
+			name, omitEmpty := _openAPIJSONName(field)
+			if name == "" {
+				return
+			}
+
+			properties[name] = schema
+			if !omitEmpty {
+				required = append(required, name)
+			}
+		})
+	}
+
+	for _, param := range pathParams {
+		schema, ok := pathSchemas[param]
+		if !ok {
+			schema = map[string]any{"type": "string"}
+		}
+
+		parameters = append(parameters, map[string]any{
+			"name":     param,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if len(properties) > 0 {
+		body := map[string]any{
+			"type":       "object",
+			"properties": properties,
+		}
+
+		if len(required) > 0 {
+			body["required"] = required
+		}
+
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				_OPENAPI_CONTENT_TYPE: map[string]any{"schema": body},
+			},
+		}
+	}
+
+	status := meta.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	response := map[string]any{
+		"description": http.StatusText(status),
+	}
+
+	if meta.Response != nil {
+		response["content"] = map[string]any{
+			_OPENAPI_CONTENT_TYPE: map[string]any{"schema": self.schema(reflect.TypeOf(meta.Response))},
+		}
+	}
+
+	operation["responses"] = map[string]any{
+		strconv.Itoa(status): response,
+	}
+
+	return operation
+}
+
+// fields calls fn with each exported field of the struct, flattening the embedded structs as encoding/json.
+func (self *_openAPIBuilder) fields(typ reflect.Type, fn func(field reflect.StructField, schema any)) {
+	if typ.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		if field.Anonymous && field.Tag.Get("json") == "" && _openAPIElem(field.Type).Kind() == reflect.Struct {
+			self.fields(_openAPIElem(field.Type), fn)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		fn(field, self.schema(field.Type))
+	}
+}
+
+func (self *_openAPIBuilder) schema(typ reflect.Type) any {
+	nullable := typ.Kind() == reflect.Pointer
+	typ = _openAPIElem(typ)
+
+	schema := self.typeSchema(typ)
+	if nullable {
+		if _, ok := schema["$ref"]; !ok {
+			schema["nullable"] = true
+		}
+	}
+
+	return schema
+}
+
+func (self *_openAPIBuilder) typeSchema(typ reflect.Type) map[string]any {
+	switch {
+	case typ == _OPENAPI_TIME_TYPE:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case typ.Implements(_OPENAPI_TEXT_MARSHALER_TYPE) || reflect.PointerTo(typ).Implements(_OPENAPI_TEXT_MARSHALER_TYPE):
+		return map[string]any{"type": "string"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+
+		return map[string]any{"type": "array", "items": self.schema(typ.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": self.schema(typ.Elem())}
+	case reflect.Struct:
+		if typ.Name() == "" {
+			return self.object(typ)
+		}
+
+		// The name is reserved before reflecting the struct so that recursive types reference themselves
+		if _, ok := self.schemas[typ.Name()]; !ok {
+			self.schemas[typ.Name()] = nil
+			self.schemas[typ.Name()] = self.object(typ)
+		}
+
+		return map[string]any{"$ref": fmt.Sprintf(_OPENAPI_SCHEMA_REF, typ.Name())}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (self *_openAPIBuilder) object(typ reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := make([]string, 0)
+
+	self.fields(typ, func(field reflect.StructField, schema any) {
+		name, omitEmpty := _openAPIJSONName(field)
+		if name == "" {
+			return
+		}
+
+		properties[name] = schema
+		if !omitEmpty {
+			required = append(required, name)
+		}
+	})
+
+	object := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+
+	if len(required) > 0 {
+		object["required"] = required
+	}
+
+	return object
+}
+
+func _openAPIElem(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	return typ
+}
+
+func _openAPITagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
+
+// _openAPIJSONName returns the name of the field as encoded by encoding/json, empty when it is skipped.
+func _openAPIJSONName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+
+	return name, strings.Contains(options, "omitempty")
+}
@@ -0,0 +1,104 @@
+package kit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type _openAPITestUser struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name"`
+	Email     *string            `json:"email,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	Friends   []_openAPITestUser `json:"friends"`
+	secret    string
+}
+
+type _openAPITestUpdateUser struct {
+	ID     int64  `param:"id"`
+	Notify bool   `query:"notify"`
+	Name   string `json:"name"`
+	Ignore string `json:"-"`
+}
+
+func TestHTTPServerOpenAPI(t *testing.T) {
+	server := &HTTPServer{
+		config: HTTPServerConfig{Service: "kit", Release: "1.0.0"},
+		server: echo.New(),
+		metas:  &[]_httpServerRouteMeta{},
+	}
+
+	server.Add(http.MethodPut, "/users/:id", func(ctx echo.Context) error { return nil }, HTTPServerRouteMeta{
+		Summary:  "Update user",
+		Tags:     []string{"users"},
+		Request:  _openAPITestUpdateUser{},
+		Response: (*_openAPITestUser)(nil),
+	})
+
+	data, err := server.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document struct {
+		Paths map[string]map[string]struct {
+			Summary    string
+			Parameters []struct {
+				Name   string
+				In     string
+				Schema map[string]any
+			}
+			RequestBody struct {
+				Content map[string]struct {
+					Schema struct {
+						Properties map[string]any
+					}
+				}
+			}
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema map[string]any
+				}
+			}
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]any
+				Required   []string
+			}
+		}
+	}
+
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	operation, ok := document.Paths["/users/{id}"]["put"]
+	if !ok || operation.Summary != "Update user" {
+		t.Fatalf("expected documented put operation, got %s", data)
+	}
+
+	if len(operation.Parameters) != 2 || operation.Parameters[0].Name != "notify" ||
+		operation.Parameters[1].Name != "id" || operation.Parameters[1].Schema["type"] != "integer" {
+		t.Fatalf("expected query and typed path parameters, got %+v", operation.Parameters)
+	}
+
+	body := operation.RequestBody.Content["application/json"].Schema.Properties
+	if len(body) != 1 || body["name"] == nil {
+		t.Fatalf("expected only the json fields in the body, got %v", body)
+	}
+
+	if operation.Responses["200"].Content["application/json"].Schema["$ref"] != "#/components/schemas/_openAPITestUser" {
+		t.Fatalf("expected response to reference the user schema, got %s", data)
+	}
+
+	user := document.Components.Schemas["_openAPITestUser"]
+	if len(user.Properties) != 5 || len(user.Required) != 4 {
+		t.Fatalf("expected user schema with its json fields, got %+v", user)
+	}
+}
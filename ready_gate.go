@@ -0,0 +1,177 @@
+package kit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neoxelox/errors"
+
+	"github.com/neoxelox/kit/util"
+)
+
+var (
+	ErrReadyGateGeneric  = errors.New("ready gate failed")
+	ErrReadyGateTimedOut = errors.New("ready gate timed out")
+)
+
+var (
+	_READY_GATE_DEFAULT_CONFIG = ReadyGateConfig{
+		PollInterval: util.Pointer(500 * time.Millisecond),
+		CheckTimeout: util.Pointer(2 * time.Second),
+	}
+)
+
+// ReadyGateConfig PollInterval is the time waited between the checks of the dependencies
+// that have not been healthy yet, each check timing out after CheckTimeout.
+type ReadyGateConfig struct {
+	PollInterval *time.Duration
+	CheckTimeout *time.Duration
+}
+
+// ReadyGate opens once all the registered dependencies have been healthy at least once, so that
+// the server does not accept traffic before, for example, the database has finished connecting.
+// Once open it stays open, as later outages are left to the readiness probes and the components.
+type ReadyGate struct {
+	config     ReadyGateConfig
+	observer   *Observer
+	aggregator *HealthAggregator
+	pending    []_healthCheck
+	mutex      *sync.Mutex
+	ready      *atomic.Bool
+	opened     chan struct{}
+	stopPoll   context.CancelFunc
+	polled     chan struct{}
+}
+
+func NewReadyGate(observer *Observer, config ReadyGateConfig) *ReadyGate {
+	util.Merge(&config, _READY_GATE_DEFAULT_CONFIG)
+
+	switch {
+	case !_isValidTimeout(config.PollInterval):
+		observer.Panic(context.Background(), ErrReadyGateGeneric.Raise().
+			With("ready gate config poll interval is not positive"))
+	case !_isValidTimeout(config.CheckTimeout):
+		observer.Panic(context.Background(), ErrReadyGateGeneric.Raise().
+			With("ready gate config check timeout is not positive"))
+	}
+
+	return &ReadyGate{
+		config:     config,
+		observer:   observer,
+		aggregator: NewHealthAggregator(observer, HealthAggregatorConfig{CheckTimeout: config.CheckTimeout}),
+		pending:    make([]_healthCheck, 0),
+		mutex:      &sync.Mutex{},
+		ready:      &atomic.Bool{},
+		opened:     make(chan struct{}),
+		polled:     make(chan struct{}),
+	}
+}
+
+// Register adds a dependency that has to be healthy once for the gate to open.
+// It is meant to be called at startup, after constructing the dependency and before Start.
+func (self *ReadyGate) Register(name string, checker HealthChecker) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.pending = append(self.pending, _healthCheck{
+		name:    name,
+		checker: checker,
+		timeout: *self.config.CheckTimeout,
+	})
+}
+
+// Start polls the registered dependencies in the background until all of them have been healthy once.
+// It is meant to be called once, after registering all the dependencies and before starting the server.
+func (self *ReadyGate) Start(ctx context.Context) {
+	pollCtx, stopPoll := context.WithCancel(context.WithoutCancel(ctx))
+	self.stopPoll = stopPoll
+
+	go self.poll(pollCtx)
+}
+
+func (self *ReadyGate) poll(ctx context.Context) {
+	defer close(self.polled)
+	defer self.observer.Recover(ctx)
+
+	for {
+		// The checks run without holding the lock so that a slow dependency does not block Register
+		self.mutex.Lock()
+		checks := self.pending
+		self.mutex.Unlock()
+
+		pending := make([]_healthCheck, 0, len(checks))
+		for _, check := range checks {
+			report := self.aggregator.run(ctx, check)
+			if report.Status != HealthStatusOK {
+				self.observer.Debugf(ctx, "Ready gate dependency %s is not ready yet: %s", check.name, report.Error)
+				pending = append(pending, check)
+				continue
+			}
+
+			self.observer.Infof(ctx, "Ready gate dependency %s is ready", check.name)
+		}
+
+		// The dependencies registered while checking are kept pending for the next poll
+		self.mutex.Lock()
+		pending = append(pending, self.pending[len(checks):]...)
+		self.pending = pending
+		self.mutex.Unlock()
+
+		if len(pending) == 0 {
+			self.ready.Store(true)
+			close(self.opened)
+
+			self.observer.Info(ctx, "Ready gate opened")
+
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*self.config.PollInterval):
+		}
+	}
+}
+
+// Ready reports whether the gate is open.
+func (self *ReadyGate) Ready() bool {
+	return self.ready.Load()
+}
+
+// Wait blocks until the gate is open or ctx is done.
+func (self *ReadyGate) Wait(ctx context.Context) error {
+	select {
+	case <-self.opened:
+		return nil
+	case <-ctx.Done():
+		return ErrReadyGateTimedOut.Raise().Cause(ctx.Err())
+	}
+}
+
+func (self *ReadyGate) Close(ctx context.Context) error {
+	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
+		self.observer.Info(ctx, "Closing ready gate")
+
+		// The gate may have never been started
+		if self.stopPoll != nil {
+			self.stopPoll()
+			<-self.polled
+		}
+
+		self.observer.Info(ctx, "Closed ready gate")
+
+		return nil
+	})
+	if err != nil {
+		if util.ErrDeadlineExceeded.Is(err) {
+			return ErrReadyGateTimedOut.Raise().Cause(err)
+		}
+
+		return err
+	}
+
+	return nil
+}
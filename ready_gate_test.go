@@ -0,0 +1,59 @@
+package kit
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neoxelox/kit/util"
+)
+
+func TestReadyGate(t *testing.T) {
+	ctx := context.Background()
+
+	observer, err := NewObserver(ctx, ObserverConfig{
+		Environment: EnvIntegration,
+		Service:     "kit",
+		Level:       LvlNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connected := &atomic.Bool{}
+
+	gate := NewReadyGate(observer, ReadyGateConfig{PollInterval: util.Pointer(10 * time.Millisecond)})
+	gate.Register("ok", _healthTestChecker(func(ctx context.Context) error {
+		return nil
+	}))
+	gate.Register("connecting", _healthTestChecker(func(ctx context.Context) error {
+		if !connected.Load() {
+			return errors.New("not connected")
+		}
+
+		return nil
+	}))
+
+	gate.Start(ctx)
+	defer gate.Close(ctx) // nolint:errcheck
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	err = gate.Wait(waitCtx)
+	if !ErrReadyGateTimedOut.Is(err) || gate.Ready() {
+		t.Fatalf("expected the gate to be closed while a dependency is not ready, got %v", err)
+	}
+
+	connected.Store(true)
+
+	waitCtx, cancel = context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	err = gate.Wait(waitCtx)
+	if err != nil || !gate.Ready() {
+		t.Fatalf("expected the gate to be open once all the dependencies were ready, got %v", err)
+	}
+}
@@ -1,25 +1,126 @@
 package kit
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
 
+	gojson "github.com/goccy/go-json"
 	"github.com/labstack/echo/v4"
 	"github.com/neoxelox/errors"
+	"github.com/vmihailenco/msgpack/v5"
 
 	"github.com/neoxelox/kit/util"
 )
 
-// TODO: faster serializer (ffjson or sonic)
+const (
+	_SERIALIZER_STREAM_FLUSH_SIZE = 100
+	// Struct json tags are reused so that the same types can be sent in both formats
+	_SERIALIZER_MSGPACK_STRUCT_TAG = "json"
+	// Integers beyond 2^53 cannot be represented exactly by the JavaScript numbers
+	_SERIALIZER_MAX_SAFE_INTEGER = 1 << 53
+)
 
 var (
 	ErrSerializerGeneric = errors.New("serializer failed")
 )
 
 var (
-	_SERIALIZER_DEFAULT_CONFIG = SerializerConfig{}
+	_SERIALIZER_DEFAULT_CONFIG = SerializerConfig{
+		Engine:           util.Pointer(SerializerEngineStd),
+		StreamThreshold:  util.Pointer(1000),
+		BigIntsAsStrings: util.Pointer(false),
+	}
+)
+
+type SerializerEngine string
+
+var (
+	// SerializerEngineStd uses the standard encoding/json library.
+	SerializerEngineStd SerializerEngine = "std"
+	// SerializerEngineFast uses the goccy/go-json library, a drop-in faster encoding/json replacement.
+	SerializerEngineFast SerializerEngine = "fast"
 )
 
+// SerializerConfig StreamThreshold is the minimum length of a top level array or slice
+// to be streamed element by element, flushing the response periodically, when not indented.
+// A non positive StreamThreshold disables streaming.
+// BigIntsAsStrings encodes the JSON integers beyond 2^53 as strings, so that JavaScript clients do not lose
+// their precision, and decodes them back into the integer fields. Otherwise use StringInt64 or StringUint64.
+// It only applies to JSON, as MessagePack integers are already exact up to 64 bits.
 type SerializerConfig struct {
+	Engine           *SerializerEngine
+	StreamThreshold  *int
+	BigIntsAsStrings *bool
+}
+
+// StringInt64 is an int64 encoded as a JSON string when it is beyond 2^53, so that JavaScript
+// clients do not lose its precision, and decoded from both JSON numbers and strings.
+type StringInt64 int64
+
+func (self StringInt64) MarshalJSON() ([]byte, error) {
+	data := strconv.AppendInt(nil, int64(self), 10)
+	if self > _SERIALIZER_MAX_SAFE_INTEGER || self < -_SERIALIZER_MAX_SAFE_INTEGER {
+		return strconv.AppendQuote(nil, string(data)), nil
+	}
+
+	return data, nil
+}
+
+func (self *StringInt64) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	value, err := strconv.ParseInt(string(bytes.Trim(data, `"`)), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	*self = StringInt64(value)
+
+	return nil
+}
+
+// StringUint64 is an uint64 encoded as a JSON string when it is beyond 2^53, so that JavaScript
+// clients do not lose its precision, and decoded from both JSON numbers and strings.
+type StringUint64 uint64
+
+func (self StringUint64) MarshalJSON() ([]byte, error) {
+	data := strconv.AppendUint(nil, uint64(self), 10)
+	if self > _SERIALIZER_MAX_SAFE_INTEGER {
+		return strconv.AppendQuote(nil, string(data)), nil
+	}
+
+	return data, nil
+}
+
+func (self *StringUint64) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	value, err := strconv.ParseUint(string(bytes.Trim(data, `"`)), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	*self = StringUint64(value)
+
+	return nil
+}
+
+type _serializerEncoder interface {
+	Encode(v any) error
+	SetIndent(prefix string, indent string)
+	SetEscapeHTML(on bool)
+}
+
+type _serializerDecoder interface {
+	Decode(v any) error
 }
 
 type Serializer struct {
@@ -36,8 +137,54 @@ func NewSerializer(observer *Observer, config SerializerConfig) *Serializer {
 	}
 }
 
+func (self *Serializer) newEncoder(w io.Writer) _serializerEncoder {
+	if *self.config.Engine == SerializerEngineFast {
+		return gojson.NewEncoder(w)
+	}
+
+	return json.NewEncoder(w)
+}
+
+func (self *Serializer) newDecoder(r io.Reader) _serializerDecoder {
+	if *self.config.Engine == SerializerEngineFast {
+		return gojson.NewDecoder(r)
+	}
+
+	return json.NewDecoder(r)
+}
+
+// Serialize negotiates the response format, encoding it in MessagePack instead of
+// JSON when the client prefers it through the Accept header.
 func (self *Serializer) Serialize(c echo.Context, i any, indent string) error {
-	encoder := json.NewEncoder(c.Response())
+	if _serializerAcceptsMessagePack(c.Request().Header.Get(echo.HeaderAccept)) {
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationMsgpack)
+
+		err := _serializerEncodeMessagePack(c.Response(), i)
+		if err != nil {
+			return ErrSerializerGeneric.Raise().Cause(err)
+		}
+
+		return nil
+	}
+
+	if indent == "" && *self.config.StreamThreshold > 0 {
+		value := reflect.ValueOf(i)
+		if (value.Kind() == reflect.Slice && !value.IsNil() || value.Kind() == reflect.Array) &&
+			value.Type().Elem().Kind() != reflect.Uint8 && value.Len() >= *self.config.StreamThreshold {
+			return self.stream(c, value)
+		}
+	}
+
+	var writer io.Writer = c.Response()
+
+	// Big integers are quoted once the whole value is encoded
+	var buffer *bytes.Buffer
+	if *self.config.BigIntsAsStrings {
+		buffer = &bytes.Buffer{}
+		writer = buffer
+	}
+
+	encoder := self.newEncoder(writer)
 
 	if indent != "" {
 		encoder.SetIndent("", indent)
@@ -50,13 +197,98 @@ func (self *Serializer) Serialize(c echo.Context, i any, indent string) error {
 		return ErrSerializerGeneric.Raise().Cause(err)
 	}
 
+	if buffer != nil {
+		return self.write(c.Response(), buffer.Bytes())
+	}
+
 	return nil
 }
 
+// write writes the complete JSON values of the buffer, quoting their big integers if configured.
+func (self *Serializer) write(w io.Writer, data []byte) error {
+	if *self.config.BigIntsAsStrings {
+		data = _serializerQuoteBigInts(data)
+	}
+
+	_, err := w.Write(data)
+	if err != nil {
+		return ErrSerializerGeneric.Raise().Cause(err)
+	}
+
+	return nil
+}
+
+// stream encodes large arrays element by element so that the whole
+// response does not have to be buffered in memory before being written.
+func (self *Serializer) stream(c echo.Context, value reflect.Value) error {
+	response := c.Response()
+
+	buffer := &bytes.Buffer{}
+	encoder := self.newEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+
+	buffer.WriteByte('[')
+
+	for j := 0; j < value.Len(); j++ {
+		if j > 0 {
+			buffer.WriteByte(',')
+		}
+
+		err := encoder.Encode(value.Index(j).Interface())
+		if err != nil {
+			return ErrSerializerGeneric.Raise().Extra(map[string]any{"index": j}).Cause(err)
+		}
+
+		// Remove the trailing newline added by the encoder
+		buffer.Truncate(buffer.Len() - 1)
+
+		if (j+1)%_SERIALIZER_STREAM_FLUSH_SIZE == 0 {
+			err = self.write(response, buffer.Bytes())
+			if err != nil {
+				return err
+			}
+
+			buffer.Reset()
+			response.Flush()
+		}
+	}
+
+	buffer.WriteString("]\n")
+
+	return self.write(response, buffer.Bytes())
+}
+
 func (self *Serializer) Deserialize(c echo.Context, i any) error {
-	decoder := json.NewDecoder(c.Request().Body)
+	var body io.Reader = c.Request().Body
+
+	var data []byte
+	if *self.config.BigIntsAsStrings {
+		var err error
+
+		data, err = io.ReadAll(body)
+		if err != nil {
+			return ErrSerializerGeneric.Raise().Cause(err)
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	decoder := self.newDecoder(body)
 
 	err := decoder.Decode(i)
+
+	// Strings are only decoded as big integers, one at a time, when the integer fields fail to decode them as they are
+	for err != nil && *self.config.BigIntsAsStrings {
+		start, end, ok := _serializerBigIntStringOf(data, err)
+		if !ok {
+			break
+		}
+
+		data = append(append(data[:start:start], data[start+1:end]...), data[end+1:]...)
+
+		err = self.newDecoder(bytes.NewReader(data)).Decode(i)
+	}
+
 	if err != nil {
 		if ute, ok := err.(*json.UnmarshalTypeError); ok {
 			return ErrSerializerGeneric.Raise().
@@ -66,6 +298,14 @@ func (self *Serializer) Deserialize(c echo.Context, i any) error {
 				Cause(ute)
 		}
 
+		if ute, ok := err.(*gojson.UnmarshalTypeError); ok {
+			return ErrSerializerGeneric.Raise().
+				With("unmarshal type error").
+				Extra(map[string]any{
+					"field": ute.Field, "expected": ute.Type, "actual": ute.Value, "offset": ute.Offset}).
+				Cause(ute)
+		}
+
 		if se, ok := err.(*json.SyntaxError); ok {
 			return ErrSerializerGeneric.Raise().
 				With("syntax error").
@@ -73,8 +313,186 @@ func (self *Serializer) Deserialize(c echo.Context, i any) error {
 				Cause(se)
 		}
 
+		if se, ok := err.(*gojson.SyntaxError); ok {
+			return ErrSerializerGeneric.Raise().
+				With("syntax error").
+				Extra(map[string]any{"offset": se.Offset}).
+				Cause(se)
+		}
+
 		return ErrSerializerGeneric.Raise().Cause(err)
 	}
 
 	return nil
 }
+
+// _serializerAcceptsMessagePack reports whether MessagePack is preferred
+// over JSON, by quality and then by order, in the Accept header.
+func _serializerAcceptsMessagePack(accept string) bool {
+	msgpackQuality, msgpackOrder := 0.0, -1
+	jsonQuality, jsonOrder := 0.0, -1
+
+	for order, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+		quality := 1.0
+
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if name == "q" {
+				quality, _ = strconv.ParseFloat(value, 64)
+			}
+		}
+
+		switch mediaType {
+		case echo.MIMEApplicationMsgpack, "application/x-msgpack":
+			if quality > msgpackQuality {
+				msgpackQuality, msgpackOrder = quality, order
+			}
+		case echo.MIMEApplicationJSON, "application/*", "*/*":
+			if quality > jsonQuality {
+				jsonQuality, jsonOrder = quality, order
+			}
+		}
+	}
+
+	if msgpackOrder < 0 {
+		return false
+	}
+
+	return jsonOrder < 0 || msgpackQuality > jsonQuality ||
+		(msgpackQuality == jsonQuality && msgpackOrder < jsonOrder)
+}
+
+func _serializerIsMessagePack(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	return mediaType == echo.MIMEApplicationMsgpack || mediaType == "application/x-msgpack"
+}
+
+func _serializerEncodeMessagePack(w io.Writer, i any) error {
+	encoder := msgpack.NewEncoder(w)
+	encoder.SetCustomStructTag(_SERIALIZER_MSGPACK_STRUCT_TAG)
+
+	return encoder.Encode(i)
+}
+
+func _serializerDecodeMessagePack(r io.Reader, i any) error {
+	decoder := msgpack.NewDecoder(r)
+	decoder.SetCustomStructTag(_SERIALIZER_MSGPACK_STRUCT_TAG)
+
+	return decoder.Decode(i)
+}
+
+// _serializerIsBigInt reports whether the JSON number is an integer beyond 2^53.
+func _serializerIsBigInt(number []byte) bool {
+	digits := bytes.TrimPrefix(number, []byte("-"))
+	if len(digits) == 0 {
+		return false
+	}
+
+	for _, digit := range digits {
+		if digit < '0' || digit > '9' {
+			return false
+		}
+	}
+
+	value, err := strconv.ParseUint(string(digits), 10, 64)
+
+	return err != nil || value > _SERIALIZER_MAX_SAFE_INTEGER
+}
+
+// _serializerQuoteBigInts quotes the integers beyond 2^53 of the JSON data.
+func _serializerQuoteBigInts(data []byte) []byte {
+	var quoted []byte
+
+	last := 0
+	inString, escaped := false, false
+
+	for i := 0; i < len(data); i++ {
+		char := data[i]
+
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case char == '\\':
+				escaped = true
+			case char == '"':
+				inString = false
+			}
+		case char == '"':
+			inString = true
+		case char == '-' || (char >= '0' && char <= '9'):
+			j := i + 1
+			for j < len(data) && strings.IndexByte("0123456789.eE+-", data[j]) >= 0 {
+				j++
+			}
+
+			if _serializerIsBigInt(data[i:j]) {
+				quoted = append(quoted, data[last:i]...)
+				quoted = append(quoted, '"')
+				quoted = append(quoted, data[i:j]...)
+				quoted = append(quoted, '"')
+				last = j
+			}
+
+			i = j - 1
+		}
+	}
+
+	if quoted == nil {
+		return data
+	}
+
+	return append(quoted, data[last:]...)
+}
+
+// _serializerBigIntStringOf returns the positions of the quotes of the JSON string, holding an integer beyond
+// 2^53, that failed to decode into an integer field, which the std and goccy decoders report by its end and start.
+func _serializerBigIntStringOf(data []byte, err error) (int, int, bool) {
+	var offset int
+	var kind reflect.Kind
+
+	if ute, ok := err.(*json.UnmarshalTypeError); ok { // nolint:errorlint
+		offset, kind = int(ute.Offset), ute.Type.Kind()
+	} else if ute, ok := err.(*gojson.UnmarshalTypeError); ok { // nolint:errorlint
+		offset, kind = int(ute.Offset), ute.Type.Kind()
+	} else {
+		return 0, 0, false
+	}
+
+	switch kind {
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+	default:
+		return 0, 0, false
+	}
+
+	var start, end int
+
+	switch {
+	case offset >= 0 && offset < len(data) && data[offset] == '"':
+		start = offset
+		end = bytes.IndexByte(data[start+1:], '"') + start + 1
+		if end == start {
+			return 0, 0, false
+		}
+	case offset > 0 && offset <= len(data) && data[offset-1] == '"':
+		end = offset - 1
+		start = bytes.LastIndexByte(data[:end], '"')
+		if start < 0 {
+			return 0, 0, false
+		}
+	default:
+		return 0, 0, false
+	}
+
+	if !_serializerIsBigInt(data[start+1 : end]) {
+		return 0, 0, false
+	}
+
+	return start, end, true
+}
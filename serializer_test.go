@@ -0,0 +1,83 @@
+package kit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/neoxelox/kit/util"
+)
+
+type _serializerTestIDs struct {
+	ID     int64        `json:"id"`
+	Small  int64        `json:"small"`
+	Marked StringInt64  `json:"marked"`
+	Max    StringUint64 `json:"max"`
+	Name   string       `json:"name"`
+}
+
+func TestSerializerBigIntsMarker(t *testing.T) {
+	data, err := json.Marshal(_serializerTestIDs{ID: 1 << 60, Small: 1, Marked: -(1 << 60), Max: 1<<64 - 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"id":1152921504606846976,"small":1,"marked":"-1152921504606846976",` +
+		`"max":"18446744073709551615","name":""}`
+	if string(data) != expected {
+		t.Fatalf("expected %s, got %s", expected, data)
+	}
+
+	var ids _serializerTestIDs
+
+	err = json.Unmarshal([]byte(`{"marked": "-1152921504606846976", "max": 1}`), &ids)
+	if err != nil || ids.Marked != -(1<<60) || ids.Max != 1 {
+		t.Fatalf("expected marked ids to be decoded from strings and numbers, got %v %v", ids, err)
+	}
+}
+
+func TestSerializerBigIntsAsStrings(t *testing.T) {
+	serializer := NewSerializer(nil, SerializerConfig{BigIntsAsStrings: util.Pointer(true)})
+	server := echo.New()
+
+	recorder := httptest.NewRecorder()
+	ctx := server.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), recorder)
+
+	err := serializer.Serialize(ctx, _serializerTestIDs{ID: 1 << 60, Small: 1, Name: "9007199254740993"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"id":"1152921504606846976","small":1,"marked":0,"max":0,"name":"9007199254740993"}` + "\n"
+	if recorder.Body.String() != expected {
+		t.Fatalf("expected %s, got %s", expected, recorder.Body.String())
+	}
+
+	body := `{"id": "1152921504606846976", "small": 1, "name": "kit", "9007199254740993": 1}`
+	ctx = server.NewContext(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), recorder)
+
+	var ids _serializerTestIDs
+
+	err = serializer.Deserialize(ctx, &ids)
+	if err != nil || ids.ID != 1<<60 || ids.Small != 1 || ids.Name != "kit" {
+		t.Fatalf("expected big ints to be decoded from strings, got %v %v", ids, err)
+	}
+
+	for _, engine := range []SerializerEngine{SerializerEngineStd, SerializerEngineFast} {
+		serializer = NewSerializer(nil, SerializerConfig{Engine: &engine, BigIntsAsStrings: util.Pointer(true)})
+
+		body = `{"name": "9007199254740993", "id": "1152921504606846976", "max": "18446744073709551615"}`
+		ctx = server.NewContext(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), recorder)
+
+		ids = _serializerTestIDs{}
+
+		err = serializer.Deserialize(ctx, &ids)
+		if err != nil || ids.ID != 1<<60 || ids.Max != 1<<64-1 || ids.Name != "9007199254740993" {
+			t.Fatalf("expected big ints to be decoded only into integer fields with %s, got %v %v", engine, ids, err)
+		}
+	}
+}
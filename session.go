@@ -0,0 +1,379 @@
+package kit
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/neoxelox/errors"
+
+	"github.com/neoxelox/kit/util"
+)
+
+const (
+	_SESSION_MIN_SECRET_SIZE = 32
+	_SESSION_ID_SIZE         = 32
+	_SESSION_SIGN_LABEL      = "kit:session:sign:"
+	_SESSION_ENCRYPT_LABEL   = "kit:session:encrypt:"
+)
+
+var (
+	KeySession Key = KeyBase + "session"
+)
+
+var (
+	ErrSessionGeneric = errors.New("session failed")
+	ErrSessionMiss    = errors.New("session key not found")
+)
+
+var (
+	_SESSION_DEFAULT_CONFIG = SessionConfig{
+		CookieName:  util.Pointer("session"),
+		CookiePath:  util.Pointer("/"),
+		Secure:      util.Pointer(true),
+		SameSite:    util.Pointer(http.SameSiteLaxMode),
+		TTL:         util.Pointer(24 * time.Hour),
+		Encrypt:     util.Pointer(false),
+		StorePrefix: util.Pointer(string(KeyBase) + "session:"),
+	}
+)
+
+// SessionConfig Secrets sign, and optionally encrypt, the session cookies. The first secret is used to
+// sign new cookies while all of them are accepted, so that secrets can be rotated by prepending new ones.
+// StorePrefix prefixes the keys of the sessions kept in the store, so that several apps can share it.
+type SessionConfig struct {
+	Secrets      []string
+	CookieName   *string
+	CookiePath   *string
+	CookieDomain string
+	Secure       *bool
+	SameSite     *http.SameSite
+	TTL          *time.Duration
+	Encrypt      *bool
+	StorePrefix  *string
+}
+
+type _sessionKeys struct {
+	sign    []byte
+	encrypt cipher.AEAD
+}
+
+type _sessionPayload struct {
+	ID        string                     `json:"id,omitempty"`
+	Values    map[string]json.RawMessage `json:"values,omitempty"`
+	ExpiresAt int64                      `json:"expires_at"`
+}
+
+type _sessionState struct {
+	id      string
+	values  map[string]json.RawMessage
+	dirty   bool
+	cleared bool
+}
+
+// Session stores the session values in a signed cookie or, when a store is given, stores them server-side
+// referenced by a signed session ID cookie. Sessions have to be loaded with the Session middleware.
+type Session struct {
+	config   SessionConfig
+	observer *Observer
+	store    Cacher
+	keys     []_sessionKeys
+}
+
+func NewSession(observer *Observer, config SessionConfig, store ...Cacher) (*Session, error) {
+	util.Merge(&config, _SESSION_DEFAULT_CONFIG)
+
+	if len(config.Secrets) == 0 {
+		return nil, ErrSessionGeneric.Raise().With("session config secrets are empty")
+	}
+
+	if *config.StorePrefix == "" {
+		return nil, ErrSessionGeneric.Raise().With("session config store prefix is empty")
+	}
+
+	keys := make([]_sessionKeys, 0, len(config.Secrets))
+
+	for i, secret := range config.Secrets {
+		if len(secret) < _SESSION_MIN_SECRET_SIZE {
+			return nil, ErrSessionGeneric.Raise().
+				With("session config secret %d is shorter than %d bytes", i, _SESSION_MIN_SECRET_SIZE)
+		}
+
+		sign := sha256.Sum256([]byte(_SESSION_SIGN_LABEL + secret))
+		encrypt := sha256.Sum256([]byte(_SESSION_ENCRYPT_LABEL + secret))
+
+		block, err := aes.NewCipher(encrypt[:])
+		if err != nil {
+			return nil, ErrSessionGeneric.Raise().Cause(err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, ErrSessionGeneric.Raise().Cause(err)
+		}
+
+		keys = append(keys, _sessionKeys{
+			sign:    sign[:],
+			encrypt: aead,
+		})
+	}
+
+	return &Session{
+		config:   config,
+		observer: observer,
+		store:    util.Optional(store, nil),
+		keys:     keys,
+	}, nil
+}
+
+func (self *Session) storeKey(id string) string {
+	return *self.config.StorePrefix + id
+}
+
+func (self *Session) sign(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(*self.config.CookieName + "|" + payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (self *Session) encode(payload _sessionPayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", ErrSessionGeneric.Raise().Cause(err)
+	}
+
+	if *self.config.Encrypt {
+		nonce := make([]byte, self.keys[0].encrypt.NonceSize())
+
+		_, err = rand.Read(nonce)
+		if err != nil {
+			return "", ErrSessionGeneric.Raise().Cause(err)
+		}
+
+		data = self.keys[0].encrypt.Seal(nonce, nonce, data, nil)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+
+	return encoded + "." + self.sign(self.keys[0].sign, encoded), nil
+}
+
+func (self *Session) decode(cookie string) (*_sessionPayload, bool) {
+	encoded, signature, found := strings.Cut(cookie, ".")
+	if !found {
+		return nil, false
+	}
+
+	var keys *_sessionKeys
+
+	for i := range self.keys {
+		if hmac.Equal([]byte(signature), []byte(self.sign(self.keys[i].sign, encoded))) {
+			keys = &self.keys[i]
+			break
+		}
+	}
+
+	if keys == nil {
+		return nil, false
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+
+	if *self.config.Encrypt {
+		nonceSize := keys.encrypt.NonceSize()
+		if len(data) < nonceSize {
+			return nil, false
+		}
+
+		data, err = keys.encrypt.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	var payload _sessionPayload
+
+	err = json.Unmarshal(data, &payload)
+	if err != nil || time.Now().Unix() >= payload.ExpiresAt {
+		return nil, false
+	}
+
+	return &payload, true
+}
+
+// Load reads the session of the request into the context and saves it before the response is written.
+// Missing, tampered or expired sessions are loaded as new empty sessions.
+func (self *Session) Load(ctx echo.Context) error {
+	state := &_sessionState{
+		values: make(map[string]json.RawMessage),
+	}
+
+	cookie, err := ctx.Cookie(*self.config.CookieName)
+	if err == nil {
+		if payload, ok := self.decode(cookie.Value); ok {
+			if self.store == nil {
+				if payload.Values != nil {
+					state.values = payload.Values
+				}
+			} else if payload.ID != "" {
+				err = self.store.Get(ctx.Request().Context(), self.storeKey(payload.ID), &state.values)
+				if err != nil && !ErrCacheMiss.Is(err) {
+					return err
+				}
+
+				if err == nil {
+					state.id = payload.ID
+				}
+			}
+		}
+	}
+
+	ctx.Set(string(KeySession), state)
+
+	ctx.Response().Before(func() {
+		err := self.save(ctx, state)
+		if err != nil {
+			self.observer.Error(ctx.Request().Context(), err)
+		}
+	})
+
+	return nil
+}
+
+func (self *Session) save(ctx echo.Context, state *_sessionState) error {
+	cookie := &http.Cookie{
+		Name:     *self.config.CookieName,
+		Path:     *self.config.CookiePath,
+		Domain:   self.config.CookieDomain,
+		Secure:   *self.config.Secure,
+		HttpOnly: true,
+		SameSite: *self.config.SameSite,
+	}
+
+	if state.cleared && !state.dirty {
+		if self.store != nil && state.id != "" {
+			err := self.store.Delete(ctx.Request().Context(), self.storeKey(state.id))
+			if err != nil {
+				return err
+			}
+		}
+
+		cookie.MaxAge = -1
+		ctx.SetCookie(cookie)
+
+		return nil
+	}
+
+	if !state.dirty {
+		return nil
+	}
+
+	payload := _sessionPayload{
+		ExpiresAt: time.Now().Add(*self.config.TTL).Unix(),
+	}
+
+	if self.store != nil {
+		if state.id == "" {
+			id := make([]byte, _SESSION_ID_SIZE)
+
+			_, err := rand.Read(id)
+			if err != nil {
+				return ErrSessionGeneric.Raise().Cause(err)
+			}
+
+			state.id = base64.RawURLEncoding.EncodeToString(id)
+		}
+
+		err := self.store.Set(ctx.Request().Context(),
+			self.storeKey(state.id), state.values, self.config.TTL)
+		if err != nil {
+			return err
+		}
+
+		payload.ID = state.id
+	} else {
+		payload.Values = state.values
+	}
+
+	value, err := self.encode(payload)
+	if err != nil {
+		return err
+	}
+
+	cookie.Value = value
+	cookie.MaxAge = int(self.config.TTL.Seconds())
+	ctx.SetCookie(cookie)
+
+	return nil
+}
+
+func (self *Session) state(ctx echo.Context) (*_sessionState, error) {
+	state, ok := ctx.Get(string(KeySession)).(*_sessionState)
+	if !ok {
+		return nil, ErrSessionGeneric.Raise().With("session not loaded, use the session middleware")
+	}
+
+	return state, nil
+}
+
+func (self *Session) Get(ctx echo.Context, key string, dest any) error {
+	state, err := self.state(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, ok := state.values[key]
+	if !ok {
+		return ErrSessionMiss.Raise()
+	}
+
+	err = json.Unmarshal(value, dest)
+	if err != nil {
+		return ErrSessionGeneric.Raise().Cause(err)
+	}
+
+	return nil
+}
+
+func (self *Session) Set(ctx echo.Context, key string, value any) error {
+	state, err := self.state(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ErrSessionGeneric.Raise().Cause(err)
+	}
+
+	state.values[key] = data
+	state.dirty = true
+
+	return nil
+}
+
+// Clear removes all the session values and expires the session cookie.
+func (self *Session) Clear(ctx echo.Context) error {
+	state, err := self.state(ctx)
+	if err != nil {
+		return err
+	}
+
+	state.values = make(map[string]json.RawMessage)
+	state.dirty = false
+	state.cleared = true
+
+	return nil
+}
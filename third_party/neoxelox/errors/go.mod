@@ -0,0 +1,10 @@
+module github.com/neoxelox/errors
+
+go 1.21.1
+
+require github.com/getsentry/sentry-go v0.28.0
+
+require (
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+)
@@ -3,20 +3,24 @@ package util
 import (
 	"context"
 	"crypto/rand"
+	goerrors "errors"
 	"fmt"
 	"math/big"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"dario.cat/mergo"
 	"github.com/aodin/date"
+	"github.com/eapache/go-resiliency/breaker"
 	"github.com/eapache/go-resiliency/deadline"
 	"github.com/eapache/go-resiliency/retrier"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cpy/cpy"
 	"github.com/neoxelox/errors"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -24,9 +28,13 @@ const (
 	_UTIL_ASCII_LETTER_SET      = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
 	_UTIL_ASCII_LETTER_SET_SIZE = 62
 	_UTIL_ENV_SLICE_SEPARATOR   = ","
+	_UTIL_POSTGRES_MAX_PARAMS   = 65535
 )
 
-var ErrDeadlineExceeded = errors.New("deadline exceeded")
+var (
+	ErrDeadlineExceeded   = errors.New("deadline exceeded")
+	ErrCircuitBreakerOpen = errors.New("circuit breaker open")
+)
 
 var copier = cpy.New(cpy.IgnoreAllUnexported(), cpy.Shallow(time.Time{}), cpy.Shallow(date.Date{}))
 
@@ -137,6 +145,108 @@ func Deadline(ctx context.Context, fn func(exceeded <-chan struct{}) error) erro
 	return fn(nil)
 }
 
+// DeadlineWithBudget is like Deadline but passes fn the time remaining until the ctx deadline, so that fn can size
+// its own sub-operations to the budget left. When ctx has no deadline the remaining time is counted from d instead,
+// which, as fn is not run with a deadline then, is not enforced.
+func DeadlineWithBudget(ctx context.Context, d time.Duration, fn func(remaining func() time.Duration) error) error {
+	budget := time.Now().Add(d)
+	if ctxDeadline, ok := ctx.Deadline(); ok {
+		budget = ctxDeadline
+	}
+
+	remaining := func() time.Duration {
+		return max(0, time.Until(budget))
+	}
+
+	return Deadline(ctx, func(exceeded <-chan struct{}) error {
+		return fn(remaining)
+	})
+}
+
+// Timeout runs fn with a context that expires after timeout, or earlier if ctx does, with the same deadline
+// semantics that the components use internally. It fails with ErrDeadlineExceeded when fn does not finish in
+// time, even if fn ignores the context, or when fn itself fails because its context deadline was exceeded.
+func Timeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := Deadline(ctx, func(exceeded <-chan struct{}) error {
+		return fn(ctx)
+	})
+	if err != nil && !ErrDeadlineExceeded.Is(err) && goerrors.Is(err, context.DeadlineExceeded) {
+		return ErrDeadlineExceeded.Raise().Extra(map[string]any{"timeout": timeout}).Cause(err)
+	}
+
+	return err
+}
+
+// Unwrap returns the error wrapped by err, which for the errors package errors is their cause.
+func Unwrap(err error) error {
+	return goerrors.Unwrap(err)
+}
+
+// Chain returns the err chain, from err itself to its root cause.
+func Chain(err error) []error {
+	chain := []error{}
+
+	for cause := err; cause != nil; cause = Unwrap(cause) {
+		chain = append(chain, cause)
+	}
+
+	return chain
+}
+
+// RootCause returns the innermost error of the err chain.
+func RootCause(err error) error {
+	root := err
+
+	for cause := err; cause != nil; cause = Unwrap(cause) {
+		root = cause
+	}
+
+	return root
+}
+
+// Is reports whether any error in the err chain, including the causes
+// of the errors package errors, matches any of the targets.
+func Is(err error, targets ...error) bool {
+	for cause := err; cause != nil; cause = Unwrap(cause) {
+		for _, target := range targets {
+			if goerrors.Is(cause, target) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// _retryClassifier retries the errors matching any of the retriables, either through the standard
+// wrapping chain or through the errors package causes, and fails fast on the rest.
+// All errors are retried when there are no retriables.
+type _retryClassifier []error
+
+func (self _retryClassifier) Classify(err error) retrier.Action {
+	if err == nil {
+		return retrier.Succeed
+	}
+
+	if _, ok := err.(_retryBudgetError); ok { // nolint:errorlint
+		return retrier.Fail
+	}
+
+	if len(self) == 0 || IsRetriable(err, self) {
+		return retrier.Retry
+	}
+
+	return retrier.Fail
+}
+
+// IsRetriable reports whether any error in the err chain matches any of the retriables.
+func IsRetriable(err error, retriables []error) bool {
+	return Is(err, retriables...)
+}
+
 func Retry(attempts int, delay time.Duration, retriables []error, fn func(attempt int) error) error {
 	// Go resiliency package does not count the first execution as an attempt
 	attempts--
@@ -144,15 +254,10 @@ func Retry(attempts int, delay time.Duration, retriables []error, fn func(attemp
 		return nil
 	}
 
-	var classifier retrier.Classifier
-	if len(retriables) > 0 {
-		classifier = retrier.WhitelistClassifier(retriables)
-	}
-
 	attempt := 1
 
-	return retrier.New(retrier.ConstantBackoff(attempts, delay), classifier).
-		Run(func() error {
+	return retrier.New(retrier.ConstantBackoff(attempts, delay), _retryClassifier(retriables)).
+		RunCtx(context.Background(), func(_ context.Context) error {
 			err := fn(attempt)
 			attempt++
 
@@ -162,26 +267,221 @@ func Retry(attempts int, delay time.Duration, retriables []error, fn func(attemp
 
 func ExponentialRetry(attempts int, initialDelay time.Duration, limitDelay time.Duration,
 	retriables []error, fn func(attempt int) error) error {
+	return JitteredExponentialRetry(context.Background(), attempts, initialDelay, limitDelay, 0, retriables, fn)
+}
+
+// JitteredExponentialRetry randomizes each backoff delay by up to ±jitter (a factor between 0 and 1)
+// so that many instances retrying against the same dependency do not do it in lockstep.
+// It stops as soon as an error is not retriable or the context is done while backing off.
+func JitteredExponentialRetry(ctx context.Context, attempts int, initialDelay time.Duration,
+	limitDelay time.Duration, jitter float64, retriables []error, fn func(attempt int) error) error {
+	return BudgetedExponentialRetry(ctx, attempts, initialDelay, limitDelay, jitter, 0, retriables, fn)
+}
+
+// BudgetedExponentialRetry retries as JitteredExponentialRetry does but, when maxElapsed is positive, it also
+// stops, returning the last error, once the time since the first attempt exceeds it. An attempt that is already
+// running is never interrupted by it.
+func BudgetedExponentialRetry(ctx context.Context, attempts int, initialDelay time.Duration,
+	limitDelay time.Duration, jitter float64, maxElapsed time.Duration, retriables []error,
+	fn func(attempt int) error) error {
 	// Go resiliency package does not count the first execution as an attempt
 	attempts--
 	if attempts < 0 {
 		return nil
 	}
 
-	var classifier retrier.Classifier
-	if len(retriables) > 0 {
-		classifier = retrier.WhitelistClassifier(retriables)
+	attempt := 1
+	var lastErr error
+
+	budgetCtx := ctx
+	if maxElapsed > 0 {
+		var cancel context.CancelFunc
+		budgetCtx, cancel = context.WithTimeout(ctx, maxElapsed)
+		defer cancel()
 	}
 
-	attempt := 1
+	retry := retrier.New(
+		retrier.LimitedExponentialBackoff(attempts, initialDelay, limitDelay), _retryClassifier(retriables))
+	retry.SetJitter(jitter)
 
-	return retrier.New(retrier.LimitedExponentialBackoff(attempts, initialDelay, limitDelay), classifier).
-		Run(func() error {
-			err := fn(attempt)
-			attempt++
+	err := retry.RunCtx(budgetCtx, func(_ context.Context) error {
+		lastErr = fn(attempt)
+		attempt++
 
-			return err
-		})
+		// The budget is checked right away so that the last error is not replaced by the backoff one
+		if lastErr != nil && budgetCtx.Err() != nil && ctx.Err() == nil {
+			return _retryBudgetError{lastErr}
+		}
+
+		return lastErr
+	})
+
+	// Only the exhausted budget is reported as the last error, the outer context keeps its own error
+	if budgetCtx.Err() != nil && ctx.Err() == nil && lastErr != nil {
+		return lastErr
+	}
+
+	return err
+}
+
+// _retryBudgetError makes the retrier fail fast once the retry budget is exhausted.
+type _retryBudgetError struct {
+	error
+}
+
+type CircuitBreakerState string
+
+var (
+	CircuitBreakerClosed   CircuitBreakerState = "closed"
+	CircuitBreakerOpen     CircuitBreakerState = "open"
+	CircuitBreakerHalfOpen CircuitBreakerState = "half-open"
+)
+
+// CircuitBreaker opens after failures errors and fails fast until, once timeout has elapsed,
+// successes consecutive half-open probes succeed and the breaker closes again.
+type CircuitBreaker struct {
+	breaker *breaker.Breaker
+}
+
+// NewCircuitBreaker clamps failures and successes to at least 1,
+// otherwise the breaker would either never open or never close again.
+func NewCircuitBreaker(failures int, successes int, timeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		breaker: breaker.New(max(1, failures), max(1, successes), timeout),
+	}
+}
+
+func (self *CircuitBreaker) Run(fn func() error) error {
+	err := self.breaker.Run(fn)
+	if err == breaker.ErrBreakerOpen {
+		return ErrCircuitBreakerOpen.Raise().Cause(err)
+	}
+
+	return err
+}
+
+func (self *CircuitBreaker) State() CircuitBreakerState {
+	switch self.breaker.GetState() {
+	case breaker.Open:
+		return CircuitBreakerOpen
+	case breaker.HalfOpen:
+		return CircuitBreakerHalfOpen
+	default:
+		return CircuitBreakerClosed
+	}
+}
+
+// Debounce returns a function that calls fn once its calls stop for delay, collapsing rapid calls into one.
+func Debounce(delay time.Duration, fn func()) func() {
+	var mutex sync.Mutex
+	var timer *time.Timer
+
+	return func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		timer = time.AfterFunc(delay, fn)
+	}
+}
+
+// Group coalesces the concurrent calls with the same key into a single execution whose result is shared.
+// The zero value is ready to use.
+type Group[T any] struct {
+	group singleflight.Group
+}
+
+// Do runs fn once for all the concurrent calls with the key, reporting whether the result was shared.
+func (self *Group[T]) Do(key string, fn func() (T, error)) (T, bool, error) {
+	value, err, shared := self.group.Do(key, func() (any, error) {
+		return fn()
+	})
+
+	result, _ := value.(T)
+
+	return result, shared, err
+}
+
+// ChunkByParams splits rowCount rows of colCount parameters each into [start, end) index ranges
+// whose statements stay under the Postgres limit of 65535 bind parameters.
+func ChunkByParams(rowCount int, colCount int) [][2]int {
+	chunkSize := max(1, _UTIL_POSTGRES_MAX_PARAMS/max(1, colCount))
+
+	chunks := make([][2]int, 0, (rowCount+chunkSize-1)/chunkSize)
+	for start := 0; start < rowCount; start += chunkSize {
+		chunks = append(chunks, [2]int{start, min(start+chunkSize, rowCount)})
+	}
+
+	return chunks
+}
+
+// Map returns the result of fn for each of the values, in order.
+func Map[T any, R any](values []T, fn func(value T) R) []R {
+	result := make([]R, len(values))
+	for i, value := range values {
+		result[i] = fn(value)
+	}
+
+	return result
+}
+
+// Filter returns the values for which fn is true, in order.
+func Filter[T any](values []T, fn func(value T) bool) []T {
+	result := make([]T, 0, len(values))
+	for _, value := range values {
+		if fn(value) {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
+
+// Reduce folds the values, in order, into the accumulator starting from initial.
+func Reduce[T any, R any](values []T, initial R, fn func(accumulator R, value T) R) R {
+	accumulator := initial
+	for _, value := range values {
+		accumulator = fn(accumulator, value)
+	}
+
+	return accumulator
+}
+
+// Keys returns the keys of the map in an unspecified order.
+func Keys[K comparable, V any](values map[K]V) []K {
+	result := make([]K, 0, len(values))
+	for key := range values {
+		result = append(result, key)
+	}
+
+	return result
+}
+
+// Values returns the values of the map in an unspecified order.
+func Values[K comparable, V any](values map[K]V) []V {
+	result := make([]V, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
+	}
+
+	return result
+}
+
+// Chunk splits the values into chunks of at most size values without copying them. The chunks share
+// the backing array of values but their capacity is clipped so that appending to one never overwrites the next.
+func Chunk[T any](values []T, size int) [][]T {
+	size = max(1, size)
+
+	chunks := make([][]T, 0, (len(values)+size-1)/size)
+	for start := 0; start < len(values); start += size {
+		end := min(start+size, len(values))
+		chunks = append(chunks, values[start:end:end])
+	}
+
+	return chunks
 }
 
 func Equals(first any, second any) bool {
@@ -0,0 +1,449 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kitErrors "github.com/neoxelox/errors"
+)
+
+const (
+	_UTIL_TEST_RETRY_TOLERANCE = 15 * time.Millisecond
+)
+
+var (
+	errUtilTestRetry = errors.New("retry")
+)
+
+func retryDelays(t *testing.T, attempts int, initialDelay time.Duration, limitDelay time.Duration,
+	jitter float64) []time.Duration {
+	t.Helper()
+
+	times := make([]time.Time, 0, attempts)
+
+	err := JitteredExponentialRetry(context.Background(), attempts, initialDelay, limitDelay, jitter, nil,
+		func(attempt int) error {
+			times = append(times, time.Now())
+			return errUtilTestRetry
+		})
+	if err != errUtilTestRetry { // nolint:errorlint
+		t.Fatalf("expected retry error, got %v", err)
+	}
+
+	if len(times) != attempts {
+		t.Fatalf("expected %d attempts, got %d", attempts, len(times))
+	}
+
+	delays := make([]time.Duration, 0, attempts-1)
+	for i := 1; i < len(times); i++ {
+		delays = append(delays, times[i].Sub(times[i-1]))
+	}
+
+	return delays
+}
+
+func TestJitteredExponentialRetryBounds(t *testing.T) {
+	initialDelay := 20 * time.Millisecond
+	limitDelay := 80 * time.Millisecond
+	jitter := 0.5
+
+	for run := 0; run < 3; run++ {
+		delays := retryDelays(t, 5, initialDelay, limitDelay, jitter)
+
+		for i, delay := range delays {
+			expected := min(initialDelay<<i, limitDelay)
+			lower := time.Duration(float64(expected) * (1 - jitter))
+			upper := time.Duration(float64(expected)*(1+jitter)) + _UTIL_TEST_RETRY_TOLERANCE
+
+			if delay < lower || delay > upper {
+				t.Errorf("delay %d is %s, expected between %s and %s", i, delay, lower, upper)
+			}
+		}
+	}
+}
+
+func TestJitteredExponentialRetryDeterministic(t *testing.T) {
+	initialDelay := 20 * time.Millisecond
+	limitDelay := 80 * time.Millisecond
+
+	delays := retryDelays(t, 4, initialDelay, limitDelay, 0)
+
+	for i, delay := range delays {
+		expected := min(initialDelay<<i, limitDelay)
+
+		if delay < expected || delay > expected+_UTIL_TEST_RETRY_TOLERANCE {
+			t.Errorf("delay %d is %s, expected %s", i, delay, expected)
+		}
+	}
+}
+
+func TestJitteredExponentialRetryNotRetriable(t *testing.T) {
+	errNotRetriable := errors.New("not retriable")
+	attempts := 0
+
+	err := JitteredExponentialRetry(context.Background(), 3, time.Millisecond, time.Millisecond, 0,
+		[]error{errUtilTestRetry}, func(attempt int) error {
+			attempts++
+			return errNotRetriable
+		})
+	if err != errNotRetriable { // nolint:errorlint
+		t.Fatalf("expected not retriable error, got %v", err)
+	}
+
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestJitteredExponentialRetryWrappedRetriable(t *testing.T) {
+	errWrapped := errors.New("wrapped")
+	errKit := kitErrors.New("kit").Raise().Cause(fmt.Errorf("dial: %w", errWrapped))
+	attempts := 0
+
+	err := JitteredExponentialRetry(context.Background(), 3, time.Millisecond, time.Millisecond, 0,
+		[]error{errWrapped}, func(attempt int) error {
+			attempts++
+			return errKit
+		})
+	if err != errKit { // nolint:errorlint
+		t.Fatalf("expected kit error, got %v", err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestBudgetedExponentialRetryMaxElapsed(t *testing.T) {
+	attempts := 0
+	start := time.Now()
+
+	err := BudgetedExponentialRetry(context.Background(), 10, 20*time.Millisecond, 20*time.Millisecond, 0,
+		50*time.Millisecond, nil, func(attempt int) error {
+			attempts++
+			return errUtilTestRetry
+		})
+	if err != errUtilTestRetry { // nolint:errorlint
+		t.Fatalf("expected last retry error, got %v", err)
+	}
+
+	if attempts < 2 || attempts > 4 {
+		t.Fatalf("expected retrying to stop after the budget, got %d attempts", attempts)
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond+_UTIL_TEST_RETRY_TOLERANCE {
+		t.Fatalf("expected retrying to stop within the budget, took %s", elapsed)
+	}
+}
+
+func TestBudgetedExponentialRetryMaxElapsedDeadline(t *testing.T) {
+	// The outer deadline is shorter than the budget so it takes precedence
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	err := BudgetedExponentialRetry(ctx, 10, 20*time.Millisecond, 20*time.Millisecond, 0,
+		time.Second, nil, func(attempt int) error {
+			return errUtilTestRetry
+		})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected outer deadline error, got %v", err)
+	}
+
+	// The budget is shorter than the outer deadline so the last error is returned
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err = BudgetedExponentialRetry(ctx, 10, 20*time.Millisecond, 20*time.Millisecond, 0,
+		30*time.Millisecond, nil, func(attempt int) error {
+			return errUtilTestRetry
+		})
+	if err != errUtilTestRetry { // nolint:errorlint
+		t.Fatalf("expected last retry error, got %v", err)
+	}
+}
+
+func TestBudgetedExponentialRetryMaxElapsedSucceeds(t *testing.T) {
+	err := BudgetedExponentialRetry(context.Background(), 3, time.Millisecond, time.Millisecond, 0,
+		time.Nanosecond, nil, func(attempt int) error {
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("expected no error once an attempt succeeds after the budget, got %v", err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	errRoot := errors.New("root")
+	errStd := fmt.Errorf("std: %w", errRoot)
+	errKit := kitErrors.New("kit").Raise().Cause(errStd)
+	errOuter := kitErrors.New("outer").Raise().Cause(errKit)
+
+	chain := Chain(errOuter)
+	if len(chain) != 4 {
+		t.Fatalf("expected 4 errors in chain, got %d: %v", len(chain), chain)
+	}
+
+	if chain[0] != errOuter || chain[1] != errKit || chain[2] != errStd || chain[3] != errRoot { // nolint:errorlint
+		t.Fatalf("unexpected chain %v", chain)
+	}
+
+	if len(Chain(nil)) != 0 {
+		t.Fatalf("expected empty chain for nil error")
+	}
+
+	var pathErr *fs.PathError
+	if !errors.Is(errOuter, errRoot) || !errors.As(kitErrors.New("kit").Raise().Cause(&fs.PathError{}), &pathErr) {
+		t.Fatalf("expected std errors to walk the chain")
+	}
+}
+
+func TestRootCause(t *testing.T) {
+	errRoot := errors.New("root")
+	errKit := kitErrors.New("kit").Raise().Cause(fmt.Errorf("std: %w", errRoot))
+
+	if root := RootCause(errKit); root != errRoot { // nolint:errorlint
+		t.Fatalf("expected root cause %v, got %v", errRoot, root)
+	}
+
+	if root := RootCause(errRoot); root != errRoot { // nolint:errorlint
+		t.Fatalf("expected error itself as root cause, got %v", root)
+	}
+
+	if RootCause(nil) != nil {
+		t.Fatalf("expected nil root cause for nil error")
+	}
+}
+
+func TestIs(t *testing.T) {
+	errSentinel := kitErrors.New("sentinel")
+	errRoot := errors.New("root")
+	err := kitErrors.New("outer").Raise().Cause(errSentinel.Raise().Cause(fmt.Errorf("std: %w", errRoot)))
+
+	if !Is(err, errSentinel) {
+		t.Fatalf("expected sentinel to be found in chain")
+	}
+
+	if !Is(err, errRoot) {
+		t.Fatalf("expected root to be found in chain")
+	}
+
+	if Is(err, errors.New("other")) {
+		t.Fatalf("expected other not to be found in chain")
+	}
+}
+
+func TestChunkByParams(t *testing.T) {
+	chunks := ChunkByParams(70000, 3)
+	if len(chunks) != 4 {
+		t.Fatalf("expected 4 chunks, got %d: %v", len(chunks), chunks)
+	}
+
+	for i, chunk := range chunks {
+		if (chunk[1]-chunk[0])*3 > _UTIL_POSTGRES_MAX_PARAMS {
+			t.Errorf("chunk %d %v exceeds the parameter limit", i, chunk)
+		}
+
+		if i > 0 && chunk[0] != chunks[i-1][1] {
+			t.Errorf("chunk %d %v does not follow chunk %v", i, chunk, chunks[i-1])
+		}
+	}
+
+	if chunks[0][0] != 0 || chunks[len(chunks)-1][1] != 70000 {
+		t.Fatalf("expected chunks to cover all rows, got %v", chunks)
+	}
+
+	if len(ChunkByParams(0, 3)) != 0 {
+		t.Fatalf("expected no chunks for no rows")
+	}
+
+	if chunks := ChunkByParams(2, 100000); len(chunks) != 2 {
+		t.Fatalf("expected one row per chunk when a row exceeds the limit, got %v", chunks)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	err := Timeout(context.Background(), 10*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	if !ErrDeadlineExceeded.Is(err) {
+		t.Fatalf("expected deadline exceeded for ignored context, got %v", err)
+	}
+
+	err = Timeout(context.Background(), 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !ErrDeadlineExceeded.Is(err) {
+		t.Fatalf("expected deadline exceeded for context aware function, got %v", err)
+	}
+
+	err = Timeout(context.Background(), time.Second, func(ctx context.Context) error {
+		return errUtilTestRetry
+	})
+	if err != errUtilTestRetry { // nolint:errorlint
+		t.Fatalf("expected function error, got %v", err)
+	}
+}
+
+func TestDeadlineWithBudget(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := DeadlineWithBudget(ctx, time.Hour, func(remaining func() time.Duration) error {
+		if remaining() > time.Second || remaining() <= 0 {
+			t.Fatalf("expected remaining time up to the context deadline, got %v", remaining())
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = DeadlineWithBudget(context.Background(), 50*time.Millisecond, func(remaining func() time.Duration) error {
+		if remaining() > 50*time.Millisecond || remaining() <= 0 {
+			t.Fatalf("expected remaining time up to the budget, got %v", remaining())
+		}
+
+		time.Sleep(60 * time.Millisecond)
+
+		if remaining() != 0 {
+			t.Fatalf("expected no remaining time past the budget, got %v", remaining())
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected budget not to be enforced without context deadline, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err = DeadlineWithBudget(ctx, time.Hour, func(remaining func() time.Duration) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	if !ErrDeadlineExceeded.Is(err) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	var calls atomic.Int32
+
+	debounced := Debounce(20*time.Millisecond, func() {
+		calls.Add(1)
+	})
+
+	for i := 0; i < 10; i++ {
+		debounced()
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected 1 call, got %d", calls.Load())
+	}
+}
+
+func TestGroup(t *testing.T) {
+	var group Group[int]
+	var executions atomic.Int32
+	var wait sync.WaitGroup
+
+	release := make(chan struct{})
+	results := make([]int, 10)
+
+	for i := range results {
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+
+			results[i], _, _ = group.Do("key", func() (int, error) {
+				executions.Add(1)
+				<-release
+
+				return 42, nil
+			})
+		}()
+	}
+
+	// Give all the calls time to join the in-flight execution
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wait.Wait()
+
+	if executions.Load() != 1 {
+		t.Fatalf("expected 1 execution, got %d", executions.Load())
+	}
+
+	for _, result := range results {
+		if result != 42 {
+			t.Fatalf("expected shared result 42, got %d", result)
+		}
+	}
+}
+
+func TestMapFilterReduce(t *testing.T) {
+	values := []int{1, 2, 3, 4}
+
+	doubled := Map(values, func(value int) string { return fmt.Sprint(value * 2) })
+	if !Equals(doubled, []string{"2", "4", "6", "8"}) {
+		t.Fatalf("expected doubled values, got %v", doubled)
+	}
+
+	even := Filter(values, func(value int) bool { return value%2 == 0 })
+	if !Equals(even, []int{2, 4}) {
+		t.Fatalf("expected even values, got %v", even)
+	}
+
+	sum := Reduce(values, 0, func(accumulator int, value int) int { return accumulator + value })
+	if sum != 10 {
+		t.Fatalf("expected sum 10, got %d", sum)
+	}
+
+	if len(Map([]int(nil), func(value int) int { return value })) != 0 {
+		t.Fatalf("expected no values for nil")
+	}
+}
+
+func TestKeysValues(t *testing.T) {
+	values := map[string]int{"a": 1, "b": 2}
+
+	keys := Keys(values)
+	if len(keys) != 2 || values[keys[0]] == values[keys[1]] {
+		t.Fatalf("expected all keys, got %v", keys)
+	}
+
+	if sum := Reduce(Values(values), 0, func(a int, v int) int { return a + v }); sum != 3 {
+		t.Fatalf("expected all values, got %v", Values(values))
+	}
+}
+
+func TestChunk(t *testing.T) {
+	values := []int{1, 2, 3, 4, 5}
+
+	chunks := Chunk(values, 2)
+	if !Equals(chunks, [][]int{{1, 2}, {3, 4}, {5}}) {
+		t.Fatalf("expected 3 chunks, got %v", chunks)
+	}
+
+	_ = append(chunks[0], 0)
+	if values[2] != 3 {
+		t.Fatalf("expected appending to a chunk not to overwrite the next one")
+	}
+
+	if len(Chunk([]int{}, 2)) != 0 {
+		t.Fatalf("expected no chunks for no values")
+	}
+}
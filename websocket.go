@@ -0,0 +1,268 @@
+package kit
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/neoxelox/errors"
+	"github.com/scylladb/go-set/strset"
+	"golang.org/x/net/websocket"
+
+	"github.com/neoxelox/kit/util"
+)
+
+const (
+	_WEBSOCKET_ANY_ORIGIN = "*"
+)
+
+var (
+	ErrWebSocketGeneric   = errors.New("websocket failed")
+	ErrWebSocketForbidden = errors.New("websocket origin %s not allowed")
+)
+
+var (
+	_WEBSOCKET_DEFAULT_CONFIG = WebSocketConfig{
+		AllowOrigins: util.Pointer([]string{}),
+		PingInterval: nil,
+	}
+)
+
+// WebSocketConfig AllowOrigins only allows same host origins when empty.
+// PingInterval defaults to half of the server RequestKeepAliveTimeout, disabling pings when it is 0.
+type WebSocketConfig struct {
+	AllowOrigins *[]string
+	PingInterval *time.Duration
+}
+
+type WebSocketConn struct {
+	ctx   context.Context
+	conn  *websocket.Conn
+	mutex sync.Mutex
+}
+
+func _newWebSocketConn(ctx context.Context, conn *websocket.Conn) *WebSocketConn {
+	return &WebSocketConn{
+		ctx:  ctx,
+		conn: conn,
+	}
+}
+
+func (self *WebSocketConn) Context() context.Context {
+	return self.ctx
+}
+
+func (self *WebSocketConn) Request() *http.Request {
+	return self.conn.Request()
+}
+
+func (self *WebSocketConn) ReadJSON(i any) error {
+	err := websocket.JSON.Receive(self.conn, i)
+	if err != nil {
+		return ErrWebSocketGeneric.Raise().Cause(err)
+	}
+
+	return nil
+}
+
+func (self *WebSocketConn) WriteJSON(i any) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	err := websocket.JSON.Send(self.conn, i)
+	if err != nil {
+		return ErrWebSocketGeneric.Raise().Cause(err)
+	}
+
+	return nil
+}
+
+func (self *WebSocketConn) ping(timeout time.Duration) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if timeout > 0 {
+		err := self.conn.SetWriteDeadline(time.Now().Add(timeout))
+		if err != nil {
+			return err
+		}
+
+		defer self.conn.SetWriteDeadline(time.Time{}) // nolint:errcheck
+	}
+
+	payloadType := self.conn.PayloadType
+	self.conn.PayloadType = websocket.PingFrame
+
+	_, err := self.conn.Write([]byte{})
+
+	self.conn.PayloadType = payloadType
+
+	return err
+}
+
+func (self *WebSocketConn) Close() error {
+	err := self.conn.Close()
+	if err != nil {
+		return ErrWebSocketGeneric.Raise().Cause(err)
+	}
+
+	return nil
+}
+
+// _webSocketResponseWriter hijacks the connection with a read deadline of the given timeout that is
+// refreshed every time a frame, including pongs which are otherwise discarded, is received.
+type _webSocketResponseWriter struct {
+	http.ResponseWriter
+	timeout time.Duration
+}
+
+func (self *_webSocketResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buffer, err := http.NewResponseController(self.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Clear the server write deadline as the connection outlives the request
+	err = conn.SetWriteDeadline(time.Time{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if self.timeout <= 0 {
+		err = conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return conn, buffer, nil
+	}
+
+	err = conn.SetReadDeadline(time.Now().Add(self.timeout))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader := &_webSocketDeadlineReader{
+		reader:  buffer.Reader,
+		conn:    conn,
+		timeout: self.timeout,
+	}
+
+	return conn, bufio.NewReadWriter(bufio.NewReader(reader), buffer.Writer), nil
+}
+
+type _webSocketDeadlineReader struct {
+	reader  io.Reader
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (self *_webSocketDeadlineReader) Read(p []byte) (int, error) {
+	n, err := self.reader.Read(p)
+	if n > 0 {
+		errD := self.conn.SetReadDeadline(time.Now().Add(self.timeout))
+		if err == nil {
+			err = errD
+		}
+	}
+
+	return n, err
+}
+
+// WebSocket pings the client every PingInterval and closes the connection as soon as a ping cannot
+// be written or nothing, not even a pong, is received within the server RequestKeepAliveTimeout,
+// so that dead or half-open peers do not hold the handler forever.
+func (self *HTTPServer) WebSocket(path string, handler func(*WebSocketConn) error,
+	config WebSocketConfig, middleware ...echo.MiddlewareFunc) *echo.Route {
+	util.Merge(&config, _WEBSOCKET_DEFAULT_CONFIG)
+
+	if config.PingInterval == nil {
+		config.PingInterval = util.Pointer(*self.config.RequestKeepAliveTimeout / 2)
+	}
+
+	allowOrigins := strset.New(*config.AllowOrigins...)
+
+	return self.server.GET(path, func(ctx echo.Context) error {
+		server := websocket.Server{
+			Handshake: func(wsConfig *websocket.Config, request *http.Request) error {
+				origin, err := websocket.Origin(wsConfig, request)
+				if err != nil {
+					return ErrWebSocketGeneric.Raise().Cause(err)
+				}
+
+				// Non browser clients do not send the origin header
+				if origin == nil || allowOrigins.Has(_WEBSOCKET_ANY_ORIGIN) ||
+					allowOrigins.Has(origin.Scheme+"://"+origin.Host) || origin.Host == request.Host {
+					return nil
+				}
+
+				return ErrWebSocketForbidden.Raise(origin)
+			},
+			Handler: func(conn *websocket.Conn) {
+				requestCtx := ctx.Request().Context()
+				wsConn := _newWebSocketConn(requestCtx, conn)
+
+				done := make(chan struct{})
+
+				defer func() {
+					close(done)
+
+					rec := recover()
+					if rec != nil {
+						err, ok := rec.(error)
+						if !ok {
+							err = ErrHTTPServerGeneric.Raise().With("%v", rec)
+						} else {
+							err = ErrHTTPServerGeneric.Raise().Cause(err)
+						}
+
+						self.observer.Error(requestCtx, err)
+					}
+
+					conn.Close()
+				}()
+
+				go func() {
+					if *config.PingInterval <= 0 {
+						return
+					}
+
+					ticker := time.NewTicker(*config.PingInterval)
+					defer ticker.Stop()
+
+					for {
+						select {
+						case <-done:
+							return
+						case <-ticker.C:
+							err := wsConn.ping(*self.config.RequestKeepAliveTimeout)
+							if err != nil {
+								conn.Close()
+								return
+							}
+						}
+					}
+				}()
+
+				// The connection is hijacked so errors cannot be written
+				// back through the error handler and are only logged
+				err := handler(wsConn)
+				if err != nil {
+					self.observer.Error(requestCtx, err)
+				}
+			},
+		}
+
+		server.ServeHTTP(&_webSocketResponseWriter{
+			ResponseWriter: ctx.Response(),
+			timeout:        *self.config.RequestKeepAliveTimeout,
+		}, ctx.Request())
+
+		return nil
+	}, middleware...)
+}
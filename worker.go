@@ -1,13 +1,17 @@
 package kit
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/hibiken/asynq"
 	"github.com/neoxelox/errors"
 
@@ -19,8 +23,10 @@ const (
 )
 
 var (
-	ErrWorkerGeneric  = errors.New("worker failed")
-	ErrWorkerTimedOut = errors.New("worker timed out")
+	ErrWorkerGeneric    = errors.New("worker failed")
+	ErrWorkerTimedOut   = errors.New("worker timed out")
+	ErrWorkerUnhealthy  = errors.New("worker unhealthy")
+	ErrWorkerBadPayload = errors.New("worker bad payload")
 )
 
 var _KlevelToAlevel = map[Level]asynq.LogLevel{
@@ -39,10 +45,14 @@ var (
 		StopTimeout:          util.Pointer(30 * time.Second),
 		TimeZone:             time.UTC,
 		ScheduleDefaultRetry: util.Pointer(0),
+		TaskDefaultRetry:     util.Pointer(0),
 		CacheMaxConns:        util.Pointer(max(8, 4*runtime.GOMAXPROCS(-1))),
 		CacheReadTimeout:     util.Pointer(30 * time.Second),
 		CacheWriteTimeout:    util.Pointer(30 * time.Second),
 		CacheDialTimeout:     util.Pointer(30 * time.Second),
+		GroupGracePeriod:     util.Pointer(1 * time.Minute),
+		GroupMaxDelay:        util.Pointer(time.Duration(0)),
+		GroupMaxSize:         util.Pointer(0),
 	}
 )
 
@@ -53,6 +63,7 @@ type WorkerConfig struct {
 	StopTimeout          *time.Duration
 	TimeZone             *time.Location
 	ScheduleDefaultRetry *int
+	TaskDefaultRetry     *int
 	CacheHost            string
 	CachePort            int
 	CacheSSLMode         bool
@@ -61,19 +72,74 @@ type WorkerConfig struct {
 	CacheReadTimeout     *time.Duration
 	CacheWriteTimeout    *time.Duration
 	CacheDialTimeout     *time.Duration
+	GroupGracePeriod     *time.Duration
+	GroupMaxDelay        *time.Duration
+	GroupMaxSize         *int
+}
+
+// Validate returns the first invalid field of the config, nil pointers being left to the defaults.
+func (self WorkerConfig) Validate() error {
+	for queue, priority := range self.Queues {
+		if priority < 1 {
+			return ErrWorkerGeneric.Raise().With("worker config queue %s priority %d is not positive", queue, priority)
+		}
+	}
+
+	switch {
+	case self.Concurrency != nil && *self.Concurrency < 1:
+		return ErrWorkerGeneric.Raise().With("worker config concurrency %d is not positive", *self.Concurrency)
+	case !_isValidTimeout(self.StopTimeout):
+		return ErrWorkerGeneric.Raise().With("worker config stop timeout is not positive")
+	case self.ScheduleDefaultRetry != nil && *self.ScheduleDefaultRetry < 0:
+		return ErrWorkerGeneric.Raise().With(
+			"worker config schedule default retry %d is negative", *self.ScheduleDefaultRetry)
+	case self.TaskDefaultRetry != nil && *self.TaskDefaultRetry < 0:
+		return ErrWorkerGeneric.Raise().With("worker config task default retry %d is negative", *self.TaskDefaultRetry)
+	case self.CacheHost == "":
+		return ErrWorkerGeneric.Raise().With("worker config cache host is empty")
+	case !_isValidPort(self.CachePort):
+		return ErrWorkerGeneric.Raise().With("worker config cache port %d is out of range", self.CachePort)
+	case self.CacheMaxConns != nil && *self.CacheMaxConns < 1:
+		return ErrWorkerGeneric.Raise().With("worker config cache max conns %d is not positive", *self.CacheMaxConns)
+	case !_isValidTimeout(self.CacheReadTimeout):
+		return ErrWorkerGeneric.Raise().With("worker config cache read timeout is not positive")
+	case !_isValidTimeout(self.CacheWriteTimeout):
+		return ErrWorkerGeneric.Raise().With("worker config cache write timeout is not positive")
+	case !_isValidTimeout(self.CacheDialTimeout):
+		return ErrWorkerGeneric.Raise().With("worker config cache dial timeout is not positive")
+	case self.GroupGracePeriod != nil && *self.GroupGracePeriod < time.Second:
+		return ErrWorkerGeneric.Raise().With("worker config group grace period is shorter than a second")
+	case self.GroupMaxDelay != nil && *self.GroupMaxDelay < 0:
+		return ErrWorkerGeneric.Raise().With("worker config group max delay is negative")
+	case self.GroupMaxSize != nil && *self.GroupMaxSize < 0:
+		return ErrWorkerGeneric.Raise().With("worker config group max size %d is negative", *self.GroupMaxSize)
+	}
+
+	return nil
 }
 
 type Worker struct {
-	config    WorkerConfig
-	observer  *Observer
-	server    *asynq.Server
-	register  *asynq.ServeMux
-	scheduler *asynq.Scheduler
+	config       WorkerConfig
+	observer     *Observer
+	errorHandler *ErrorHandler
+	server       *asynq.Server
+	register     *asynq.ServeMux
+	scheduler    *asynq.Scheduler
+	schedules    map[string]string
+	aggregators  *sync.Map
+	mutex        sync.Mutex
+	cache        *redis.Client
+	running      atomic.Bool
 }
 
 func NewWorker(observer *Observer, errorHandler *ErrorHandler, config WorkerConfig) *Worker {
 	util.Merge(&config, _WORKER_DEFAULT_CONFIG)
 
+	err := config.Validate()
+	if err != nil {
+		observer.Panic(context.Background(), err)
+	}
+
 	dsn := fmt.Sprintf(_WORKER_REDIS_DSN, config.CacheHost, config.CachePort)
 
 	var ssl *tls.Config
@@ -101,37 +167,68 @@ func NewWorker(observer *Observer, errorHandler *ErrorHandler, config WorkerConf
 		asynqLogLevel = asynq.InfoLevel
 	}
 
+	// Aggregators are registered once the server is created, so they are dispatched by group on aggregation
+	aggregators := &sync.Map{}
+
 	serverConfig := asynq.Config{
-		Concurrency:     *config.Concurrency,
-		Queues:          config.Queues,
-		StrictPriority:  *config.StrictPriority,
-		ShutdownTimeout: *config.StopTimeout,
-		Logger:          asynqLogger,
-		LogLevel:        asynqLogLevel,
-		ErrorHandler:    asynq.ErrorHandlerFunc(errorHandler.HandleTask),
+		Concurrency:      *config.Concurrency,
+		Queues:           config.Queues,
+		StrictPriority:   *config.StrictPriority,
+		ShutdownTimeout:  *config.StopTimeout,
+		Logger:           asynqLogger,
+		LogLevel:         asynqLogLevel,
+		ErrorHandler:     asynq.ErrorHandlerFunc(errorHandler.HandleTask),
+		GroupGracePeriod: *config.GroupGracePeriod,
+		GroupMaxDelay:    *config.GroupMaxDelay,
+		GroupMaxSize:     *config.GroupMaxSize,
+		GroupAggregator: asynq.GroupAggregatorFunc(func(group string, tasks []*asynq.Task) *asynq.Task {
+			return _aggregateTasks(observer, aggregators, group, tasks)
+		}),
 	}
 
+	// Scheduler callbacks run on the cron goroutines which do not recover panics, crashing the whole worker
 	schedulerConfig := asynq.SchedulerOpts{
 		Location: config.TimeZone,
 		Logger:   asynqLogger,
 		LogLevel: asynqLogLevel,
 		PostEnqueueFunc: func(info *asynq.TaskInfo, err error) {
-			if err == nil {
-				asynqLogger.observer.Infof(context.Background(),
-					"Enqueued task %s on queue %s with id %s", info.Type, info.Queue, info.ID)
+			// Enqueue failures are handled by the enqueue error handler
+			if err != nil {
+				return
 			}
+
+			defer _recoverTask(context.Background(), errorHandler, asynq.NewTask(info.Type, info.Payload))
+
+			asynqLogger.observer.Infof(context.Background(),
+				"Enqueued task %s on queue %s with id %s", info.Type, info.Queue, info.ID)
 		},
 		EnqueueErrorHandler: func(task *asynq.Task, opts []asynq.Option, err error) {
+			defer _recoverTask(context.Background(), errorHandler, task)
+
 			errorHandler.HandleTask(context.Background(), task, err)
 		},
 	}
 
 	return &Worker{
-		config:    config,
-		observer:  observer,
-		server:    asynq.NewServer(redisConfig, serverConfig),
-		register:  asynq.NewServeMux(),
-		scheduler: asynq.NewScheduler(redisConfig, &schedulerConfig),
+		config:       config,
+		observer:     observer,
+		errorHandler: errorHandler,
+		server:       asynq.NewServer(redisConfig, serverConfig),
+		register:     asynq.NewServeMux(),
+		scheduler:    asynq.NewScheduler(redisConfig, &schedulerConfig),
+		schedules:    make(map[string]string),
+		aggregators:  aggregators,
+		// Asynq does not expose its Redis connection, so a minimal one is kept to check its health
+		// and to pipeline the batch enqueues, which would otherwise block the health checks
+		cache: redis.NewClient(&redis.Options{
+			Addr:         dsn,
+			TLSConfig:    ssl,
+			Password:     config.CachePassword,
+			DialTimeout:  *config.CacheDialTimeout,
+			ReadTimeout:  *config.CacheReadTimeout,
+			WriteTimeout: *config.CacheWriteTimeout,
+			PoolSize:     2,
+		}),
 	}
 }
 
@@ -148,6 +245,37 @@ func (self *Worker) Run(ctx context.Context) error {
 		return ErrWorkerGeneric.Raise().Cause(err)
 	}
 
+	self.running.Store(true)
+
+	return nil
+}
+
+func (self *Worker) Health(ctx context.Context) error {
+	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
+		if !self.running.Load() {
+			return ErrWorkerUnhealthy.Raise().With("server and scheduler not running")
+		}
+
+		result, err := self.cache.Ping(ctx).Result()
+		if err != nil || result != "PONG" {
+			return ErrWorkerUnhealthy.Raise().Cause(err)
+		}
+
+		err = ctx.Err()
+		if err != nil {
+			return ErrWorkerUnhealthy.Raise().Cause(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		if util.ErrDeadlineExceeded.Is(err) {
+			return ErrWorkerTimedOut.Raise().Cause(err)
+		}
+
+		return err
+	}
+
 	return nil
 }
 
@@ -155,31 +283,286 @@ func (self *Worker) Use(middleware ...asynq.MiddlewareFunc) {
 	self.register.Use(middleware...)
 }
 
+// Register registers a task handler whose permanent errors, see IsPermanent, skip the remaining retries
+// while the transient and unknown ones are retried with backoff.
 func (self *Worker) Register(task string, handler func(context.Context, *asynq.Task) error) {
-	self.register.HandleFunc(task, handler)
+	self.register.HandleFunc(task, func(ctx context.Context, t *asynq.Task) error {
+		err := handler(ctx, t)
+		if err != nil && !util.Is(err, asynq.SkipRetry) && IsPermanent(err) {
+			return _workerSkipRetryError{err}
+		}
+
+		return err
+	})
+}
+
+// RegisterAggregator registers the aggregation of the tasks enqueued within group, see Enqueuer.EnqueueGroup,
+// into the single task, handled as any other registered task, that aggregator returns. Groups are aggregated
+// once no task has been enqueued for the group grace period or the group max delay or max size are reached.
+func (self *Worker) RegisterAggregator(group string, aggregator func(tasks []*asynq.Task) *asynq.Task) {
+	self.aggregators.Store(group, aggregator)
 }
 
+// _aggregateTasks runs the aggregator of the group, which runs on the server goroutines, reporting its panics
+// and the groups without aggregator instead of crashing the worker. Their tasks are kept to be aggregated again.
+func _aggregateTasks(observer *Observer, aggregators *sync.Map, group string, tasks []*asynq.Task) (task *asynq.Task) {
+	ctx := context.Background()
+
+	aggregator, ok := aggregators.Load(group)
+	if !ok {
+		observer.Error(ctx, ErrWorkerGeneric.Raise().With("no aggregator registered for group %s", group))
+		return nil
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			observer.Error(ctx, _workerPanicToError(rec))
+			task = nil
+		}
+	}()
+
+	return aggregator.(func(tasks []*asynq.Task) *asynq.Task)(tasks)
+}
+
+// TaskCodec serializes the task params, for example to send binary data without the JSON base64 overhead.
+type TaskCodec interface {
+	Marshal(params any) ([]byte, error)
+	Unmarshal(payload []byte, params any) error
+}
+
+var (
+	TaskCodecJSON    TaskCodec = _taskJSONCodec{}
+	TaskCodecMsgPack TaskCodec = _taskMsgPackCodec{}
+)
+
+type _taskJSONCodec struct{}
+
+func (self _taskJSONCodec) Marshal(params any) ([]byte, error) {
+	return json.Marshal(params)
+}
+
+func (self _taskJSONCodec) Unmarshal(payload []byte, params any) error {
+	return json.Unmarshal(payload, params)
+}
+
+// _taskMsgPackCodec reuses the struct json tags, as the serializer does, so that the same params can be sent with
+// both codecs, while encoding the byte slices as binary instead of base64 strings.
+type _taskMsgPackCodec struct{}
+
+func (self _taskMsgPackCodec) Marshal(params any) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	err := _serializerEncodeMessagePack(&buffer, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (self _taskMsgPackCodec) Unmarshal(payload []byte, params any) error {
+	return _serializerDecodeMessagePack(bytes.NewReader(payload), params)
+}
+
+// TaskMigrator is implemented by task params that carry a "version" field so that payloads
+// enqueued with another version are handed to Migrate, which must fill the params, instead.
+type TaskMigrator interface {
+	TaskVersion() int
+	Migrate(version int, payload []byte) error
+}
+
+// _workerSkipRetryError marks an error as not retryable for asynq while keeping it reportable as is.
+type _workerSkipRetryError struct {
+	error
+}
+
+func (self _workerSkipRetryError) Unwrap() []error {
+	return []error{self.error, asynq.SkipRetry}
+}
+
+// RegisterTyped registers a task handler whose payload is unmarshaled into T. Payloads
+// that cannot be unmarshaled nor migrated fail with a non-retryable ErrWorkerBadPayload.
+func RegisterTyped[T any](worker *Worker, task string, handler func(ctx context.Context, params T) error) {
+	worker.Register(task, func(ctx context.Context, t *asynq.Task) error {
+		var params T
+
+		err := _unmarshalTaskPayload(t.Payload(), &params)
+		if err != nil {
+			return _workerSkipRetryError{ErrWorkerBadPayload.Raise().With("task %s", task).Cause(err)}
+		}
+
+		return handler(ctx, params)
+	})
+}
+
+// RegisterTypedCodec registers a task handler whose payload, enqueued with Enqueuer.EnqueueCodec, is unmarshaled
+// into T with codec. Payloads that cannot be unmarshaled fail with a non-retryable ErrWorkerBadPayload.
+// Unlike RegisterTyped, params are not migrated, as the codecs do not share a way to read their version.
+func RegisterTypedCodec[T any](worker *Worker, task string, codec TaskCodec,
+	handler func(ctx context.Context, params T) error) {
+	worker.Register(task, func(ctx context.Context, t *asynq.Task) error {
+		var params T
+
+		err := codec.Unmarshal(t.Payload(), &params)
+		if err != nil {
+			return _workerSkipRetryError{ErrWorkerBadPayload.Raise().With("task %s", task).Cause(err)}
+		}
+
+		return handler(ctx, params)
+	})
+}
+
+// RegisterRaw registers a task handler, for the tasks enqueued with Enqueuer.EnqueueRaw,
+// that receives the payload as is to manage its own serialization.
+func (self *Worker) RegisterRaw(task string, handler func(ctx context.Context, payload []byte) error) {
+	self.Register(task, func(ctx context.Context, t *asynq.Task) error {
+		return handler(ctx, t.Payload())
+	})
+}
+
+func _unmarshalTaskPayload(payload []byte, params any) error {
+	migrator, ok := params.(TaskMigrator)
+	if !ok {
+		return json.Unmarshal(payload, params)
+	}
+
+	var versioned struct {
+		Version int `json:"version"`
+	}
+
+	err := json.Unmarshal(payload, &versioned)
+	if err != nil {
+		return err
+	}
+
+	if versioned.Version != migrator.TaskVersion() {
+		return migrator.Migrate(versioned.Version, payload)
+	}
+
+	return json.Unmarshal(payload, params)
+}
+
+// Schedule registers a recurring task. Schedules failing to register before the worker runs are
+// misconfigurations and panic, while the ones failing afterwards are reported through the error handler.
 func (self *Worker) Schedule(task string, params any, cron string, options ...asynq.Option) {
+	err := self.schedule(task, params, cron, options...)
+	if err != nil {
+		if self.running.Load() {
+			self.errorHandler.HandleTask(context.Background(), asynq.NewTask(task, nil), err)
+			return
+		}
+
+		self.observer.Panic(context.Background(), err)
+	}
+}
+
+func (self *Worker) schedule(task string, params any, cron string, options ...asynq.Option) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = _workerPanicToError(rec)
+		}
+	}()
+
 	payload, err := json.Marshal(params)
 	if err != nil {
-		self.observer.Panicf(context.Background(), "%s: %v", task, err)
+		return ErrWorkerGeneric.Raise().With("%s", task).Cause(err)
 	}
 
 	_, err = self.scheduler.Register(cron,
 		asynq.NewTask(task, payload, asynq.MaxRetry(*self.config.ScheduleDefaultRetry)), options...)
 	if err != nil {
-		self.observer.Panicf(context.Background(), "%s: %v", task, err)
+		return ErrWorkerGeneric.Raise().With("%s", task).Cause(err)
 	}
+
+	return nil
+}
+
+func _workerPanicToError(rec any) error {
+	err, ok := rec.(error)
+	if !ok {
+		return ErrWorkerGeneric.Raise().Skip(2).With("recovered panic: %v", rec)
+	}
+
+	return ErrWorkerGeneric.Raise().Skip(2).With("recovered panic").Cause(err)
+}
+
+// _recoverTask reports the panic of a worker callback through the error handler instead of crashing the worker.
+func _recoverTask(ctx context.Context, errorHandler *ErrorHandler, task *asynq.Task) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+
+	errorHandler.HandleTask(ctx, task, _workerPanicToError(rec))
+}
+
+// ScheduleDynamic registers a recurring task that can be updated or removed at runtime, replacing the
+// one previously scheduled with the same id. Schedules are kept in memory, so they do not survive a
+// restart and have to be registered again on startup, for example from the database.
+func (self *Worker) ScheduleDynamic(
+	id string, task string, params any, cron string, options ...asynq.Option) (string, error) {
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return "", ErrWorkerGeneric.Raise().With("%s", task).Cause(err)
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	entryID, err := self.scheduler.Register(cron,
+		asynq.NewTask(task, payload, asynq.MaxRetry(*self.config.ScheduleDefaultRetry)), options...)
+	if err != nil {
+		return "", ErrWorkerGeneric.Raise().With("%s", task).Cause(err)
+	}
+
+	if previousEntryID, ok := self.schedules[id]; ok {
+		err = self.scheduler.Unregister(previousEntryID)
+		if err != nil {
+			_ = self.scheduler.Unregister(entryID)
+			return "", ErrWorkerGeneric.Raise().With("%s", task).Cause(err)
+		}
+	}
+
+	self.schedules[id] = entryID
+
+	return entryID, nil
+}
+
+// Unschedule removes the recurring task registered by ScheduleDynamic with the same id.
+func (self *Worker) Unschedule(id string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	entryID, ok := self.schedules[id]
+	if !ok {
+		return ErrWorkerGeneric.Raise().With("schedule %s not found", id)
+	}
+
+	err := self.scheduler.Unregister(entryID)
+	if err != nil {
+		return ErrWorkerGeneric.Raise().With("schedule %s", id).Cause(err)
+	}
+
+	delete(self.schedules, id)
+
+	return nil
 }
 
 func (self *Worker) Close(ctx context.Context) error {
 	err := util.Deadline(ctx, func(exceeded <-chan struct{}) error {
 		self.observer.Info(ctx, "Closing worker")
 
+		self.running.Store(false)
+
 		self.scheduler.Shutdown()
 		self.server.Stop()
 		self.server.Shutdown()
 
+		err := self.cache.Close()
+		if err != nil {
+			return ErrWorkerGeneric.Raise().Cause(err)
+		}
+
 		self.observer.Info(ctx, "Closed worker")
 
 		return nil
@@ -0,0 +1,248 @@
+package kit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Keys, defaults and message fields of asynq v0.24, which must be kept in sync when upgrading it
+const (
+	_WORKER_BATCH_QUEUES_KEY      = "asynq:queues"
+	_WORKER_BATCH_TASK_KEY        = "asynq:{%s}:t:%s"
+	_WORKER_BATCH_PENDING_KEY     = "asynq:{%s}:pending"
+	_WORKER_BATCH_DEFAULT_QUEUE   = "default"
+	_WORKER_BATCH_DEFAULT_TIMEOUT = 30 * time.Minute
+
+	_WORKER_BATCH_MESSAGE_TYPE      protowire.Number = 1
+	_WORKER_BATCH_MESSAGE_PAYLOAD   protowire.Number = 2
+	_WORKER_BATCH_MESSAGE_ID        protowire.Number = 3
+	_WORKER_BATCH_MESSAGE_QUEUE     protowire.Number = 4
+	_WORKER_BATCH_MESSAGE_RETRY     protowire.Number = 5
+	_WORKER_BATCH_MESSAGE_TIMEOUT   protowire.Number = 8
+	_WORKER_BATCH_MESSAGE_DEADLINE  protowire.Number = 9
+	_WORKER_BATCH_MESSAGE_RETENTION protowire.Number = 12
+)
+
+// _WORKER_BATCH_ENQUEUE_SCRIPT is the script asynq enqueues the pending tasks with, so that the batch
+// enqueues are indistinguishable from the ones of the Enqueuer for the worker servers and inspectors.
+var _WORKER_BATCH_ENQUEUE_SCRIPT = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+redis.call("HSET", KEYS[1],
+           "msg", ARGV[1],
+           "state", "pending",
+           "pending_since", ARGV[3])
+redis.call("LPUSH", KEYS[2], ARGV[2])
+return 1
+`)
+
+// TaskSpec is a task to be enqueued by EnqueueBatch along with its params and options.
+type TaskSpec struct {
+	Task    string
+	Params  any
+	Options []asynq.Option
+}
+
+// _workerBatchMessage is the asynq task message of a TaskSpec.
+type _workerBatchMessage struct {
+	id      string
+	queue   string
+	encoded []byte
+}
+
+// EnqueueBatch enqueues the tasks, which are processed right away, in a single Redis pipeline instead of a round
+// trip per task. It returns the id, empty on failure, and the error, if any, of each task in order, logging a
+// single summary line. Tasks with the Unique, Group, ProcessAt or ProcessIn, in the future, options cannot be
+// batched, as asynq enqueues them differently, and fail so that they are enqueued with the Enqueuer instead.
+func (self *Worker) EnqueueBatch(ctx context.Context, tasks []TaskSpec) ([]string, []error) {
+	ids := make([]string, len(tasks))
+	errs := make([]error, len(tasks))
+
+	now := time.Now()
+	messages := make([]*_workerBatchMessage, len(tasks))
+	queues := make(map[string]bool)
+
+	for i, task := range tasks {
+		message, err := self.batchMessage(ctx, task, now)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		messages[i] = message
+		queues[message.queue] = true
+	}
+
+	if len(queues) > 0 {
+		pipeline := self.cache.Pipeline()
+
+		// The script is loaded within the pipeline as it runs in order over the same connection
+		_WORKER_BATCH_ENQUEUE_SCRIPT.Load(ctx, pipeline)
+
+		added := make(map[string]*redis.IntCmd, len(queues))
+		for queue := range queues {
+			added[queue] = pipeline.SAdd(ctx, _WORKER_BATCH_QUEUES_KEY, queue)
+		}
+
+		enqueued := make([]*redis.Cmd, len(tasks))
+		for i, message := range messages {
+			if message == nil {
+				continue
+			}
+
+			enqueued[i] = _WORKER_BATCH_ENQUEUE_SCRIPT.EvalSha(ctx, pipeline,
+				[]string{
+					fmt.Sprintf(_WORKER_BATCH_TASK_KEY, message.queue, message.id),
+					fmt.Sprintf(_WORKER_BATCH_PENDING_KEY, message.queue),
+				},
+				message.encoded, message.id, now.UnixNano())
+		}
+
+		// Errors are checked per command, as the pipeline only returns the first one
+		_, _ = pipeline.Exec(ctx)
+
+		for i, message := range messages {
+			if message == nil {
+				continue
+			}
+
+			err := added[message.queue].Err()
+			if err != nil {
+				errs[i] = ErrWorkerGeneric.Raise().With("task %s", tasks[i].Task).Cause(err)
+				continue
+			}
+
+			result, err := enqueued[i].Int()
+			if err != nil {
+				errs[i] = ErrWorkerGeneric.Raise().With("task %s", tasks[i].Task).Cause(err)
+				continue
+			}
+
+			if result == 0 {
+				errs[i] = ErrWorkerGeneric.Raise().With("task %s", tasks[i].Task).Cause(asynq.ErrTaskIDConflict)
+				continue
+			}
+
+			ids[i] = message.id
+		}
+	}
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+
+	self.observer.Infof(ctx, "Enqueued %d out of %d tasks with trace %s",
+		len(tasks)-failed, len(tasks), self.observer.GetTrace(ctx))
+
+	return ids, errs
+}
+
+// batchMessage composes the task options as asynq does and encodes the resulting task message.
+func (self *Worker) batchMessage(ctx context.Context, task TaskSpec, now time.Time) (*_workerBatchMessage, error) {
+	if strings.TrimSpace(task.Task) == "" {
+		return nil, ErrWorkerGeneric.Raise().With("task is empty")
+	}
+
+	payload, err := _taskPayload(ctx, self.observer, task.Params)
+	if err != nil {
+		return nil, ErrWorkerGeneric.Raise().With("task %s", task.Task).Cause(err)
+	}
+
+	id := uuid.NewString()
+	queue := _WORKER_BATCH_DEFAULT_QUEUE
+	retry := *self.config.TaskDefaultRetry
+	timeout := time.Duration(0)
+	deadline := time.Time{}
+	retention := time.Duration(0)
+
+	for _, option := range task.Options {
+		switch option.Type() {
+		case asynq.MaxRetryOpt:
+			retry = option.Value().(int)
+		case asynq.QueueOpt:
+			queue = option.Value().(string)
+		case asynq.TaskIDOpt:
+			id = option.Value().(string)
+		case asynq.TimeoutOpt:
+			timeout = option.Value().(time.Duration)
+		case asynq.DeadlineOpt:
+			deadline = option.Value().(time.Time)
+		case asynq.RetentionOpt:
+			retention = option.Value().(time.Duration)
+		case asynq.ProcessAtOpt:
+			if option.Value().(time.Time).After(now) {
+				return nil, ErrWorkerGeneric.Raise().With("task %s cannot be batched with %s", task.Task, option)
+			}
+		case asynq.ProcessInOpt:
+			if option.Value().(time.Duration) > 0 {
+				return nil, ErrWorkerGeneric.Raise().With("task %s cannot be batched with %s", task.Task, option)
+			}
+		case asynq.UniqueOpt, asynq.GroupOpt:
+			return nil, ErrWorkerGeneric.Raise().With("task %s cannot be batched with %s", task.Task, option)
+		}
+	}
+
+	switch {
+	case strings.TrimSpace(queue) == "":
+		return nil, ErrWorkerGeneric.Raise().With("task %s queue is empty", task.Task)
+	case strings.TrimSpace(id) == "":
+		return nil, ErrWorkerGeneric.Raise().With("task %s id is empty", task.Task)
+	}
+
+	if deadline.IsZero() && timeout == 0 {
+		timeout = _WORKER_BATCH_DEFAULT_TIMEOUT
+	}
+
+	var deadlineUnix int64
+	if !deadline.IsZero() {
+		deadlineUnix = deadline.Unix()
+	}
+
+	// Zero values are omitted as in proto3
+	var encoded []byte
+
+	encoded = protowire.AppendTag(encoded, _WORKER_BATCH_MESSAGE_TYPE, protowire.BytesType)
+	encoded = protowire.AppendString(encoded, task.Task)
+
+	if len(payload) > 0 {
+		encoded = protowire.AppendTag(encoded, _WORKER_BATCH_MESSAGE_PAYLOAD, protowire.BytesType)
+		encoded = protowire.AppendBytes(encoded, payload)
+	}
+
+	encoded = protowire.AppendTag(encoded, _WORKER_BATCH_MESSAGE_ID, protowire.BytesType)
+	encoded = protowire.AppendString(encoded, id)
+	encoded = protowire.AppendTag(encoded, _WORKER_BATCH_MESSAGE_QUEUE, protowire.BytesType)
+	encoded = protowire.AppendString(encoded, queue)
+
+	for _, field := range []struct {
+		number protowire.Number
+		value  int64
+	}{
+		{_WORKER_BATCH_MESSAGE_RETRY, int64(int32(retry))},
+		{_WORKER_BATCH_MESSAGE_TIMEOUT, int64(timeout.Seconds())},
+		{_WORKER_BATCH_MESSAGE_DEADLINE, deadlineUnix},
+		{_WORKER_BATCH_MESSAGE_RETENTION, int64(retention.Seconds())},
+	} {
+		if field.value != 0 {
+			encoded = protowire.AppendTag(encoded, field.number, protowire.VarintType)
+			encoded = protowire.AppendVarint(encoded, uint64(field.value))
+		}
+	}
+
+	return &_workerBatchMessage{
+		id:      id,
+		queue:   queue,
+		encoded: encoded,
+	}, nil
+}
@@ -0,0 +1,181 @@
+package kit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/neoxelox/kit/util"
+)
+
+func TestWorkerBatchMessage(t *testing.T) {
+	ctx := context.Background()
+
+	observer, err := NewObserver(ctx, ObserverConfig{
+		Environment: EnvIntegration,
+		Service:     "kit",
+		Level:       LvlNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker := &Worker{observer: observer, config: WorkerConfig{TaskDefaultRetry: util.Pointer(3)}}
+
+	message, err := worker.batchMessage(ctx, TaskSpec{
+		Task:    "email",
+		Params:  map[string]any{"to": "kit"},
+		Options: []asynq.Option{asynq.Queue("low"), asynq.TaskID("task"), asynq.Retention(time.Hour)},
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if message.id != "task" || message.queue != "low" {
+		t.Fatalf("expected task id and queue from the options, got %s %s", message.id, message.queue)
+	}
+
+	fields := make(map[protowire.Number]any)
+
+	for encoded := message.encoded; len(encoded) > 0; {
+		number, kind, n := protowire.ConsumeTag(encoded)
+		encoded = encoded[n:]
+
+		switch kind {
+		case protowire.BytesType:
+			var value []byte
+			value, n = protowire.ConsumeBytes(encoded)
+			fields[number] = string(value)
+		case protowire.VarintType:
+			var value uint64
+			value, n = protowire.ConsumeVarint(encoded)
+			fields[number] = int64(value)
+		default:
+			t.Fatalf("unexpected wire type %d of field %d", kind, number)
+		}
+
+		if n < 0 {
+			t.Fatalf("malformed field %d", number)
+		}
+
+		encoded = encoded[n:]
+	}
+
+	if fields[_WORKER_BATCH_MESSAGE_TYPE] != "email" || fields[_WORKER_BATCH_MESSAGE_ID] != "task" ||
+		fields[_WORKER_BATCH_MESSAGE_QUEUE] != "low" || fields[_WORKER_BATCH_MESSAGE_RETRY] != int64(3) ||
+		fields[_WORKER_BATCH_MESSAGE_TIMEOUT] != int64(_WORKER_BATCH_DEFAULT_TIMEOUT.Seconds()) ||
+		fields[_WORKER_BATCH_MESSAGE_RETENTION] != int64(time.Hour.Seconds()) {
+		t.Fatalf("unexpected task message %v", fields)
+	}
+
+	for _, option := range []asynq.Option{asynq.Group("group"), asynq.Unique(time.Minute), asynq.ProcessIn(time.Minute)} {
+		_, err = worker.batchMessage(ctx, TaskSpec{Task: "email", Options: []asynq.Option{option}}, time.Now())
+		if !ErrWorkerGeneric.Is(err) {
+			t.Fatalf("expected task with %s not to be batched, got %v", option, err)
+		}
+	}
+}
+
+func TestWorkerErrorClassification(t *testing.T) {
+	err := ErrWorkerGeneric.Raise().Cause(ErrWorkerBadPayload.Raise())
+
+	if !IsPermanent(err) || !util.Is(_workerSkipRetryError{err}, asynq.SkipRetry) {
+		t.Fatalf("expected bad payload to be permanent and skip retries")
+	}
+
+	err = ErrDatabaseTransactionFailed.Raise().Cause(_dbErrToError(context.DeadlineExceeded))
+
+	if IsPermanent(err) || !IsRetryable(err) {
+		t.Fatalf("expected database timeout to be transient")
+	}
+
+	if IsPermanent(errors.New("task")) {
+		t.Fatalf("expected unknown error not to be permanent")
+	}
+}
+
+type _panickingParams struct{}
+
+func (self _panickingParams) MarshalJSON() ([]byte, error) {
+	panic("marshal")
+}
+
+func TestWorkerScheduleRecover(t *testing.T) {
+	err := (&Worker{}).schedule("task", _panickingParams{}, "* * * * *")
+
+	if !ErrWorkerGeneric.Is(err) {
+		t.Fatalf("expected recovered worker generic error, got %v", err)
+	}
+}
+
+func TestWorkerAggregateTasks(t *testing.T) {
+	observer, err := NewObserver(context.Background(), ObserverConfig{
+		Environment: EnvIntegration,
+		Service:     "kit",
+		Level:       LvlNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aggregators := &sync.Map{}
+	aggregators.Store("batch", func(tasks []*asynq.Task) *asynq.Task {
+		return asynq.NewTask("batch", []byte(fmt.Sprint(len(tasks))))
+	})
+	aggregators.Store("panic", func(tasks []*asynq.Task) *asynq.Task {
+		panic("aggregate")
+	})
+
+	tasks := []*asynq.Task{asynq.NewTask("item", nil), asynq.NewTask("item", nil)}
+
+	task := _aggregateTasks(observer, aggregators, "batch", tasks)
+	if task == nil || string(task.Payload()) != "2" {
+		t.Fatalf("expected tasks to be aggregated into one")
+	}
+
+	if _aggregateTasks(observer, aggregators, "panic", tasks) != nil ||
+		_aggregateTasks(observer, aggregators, "unknown", tasks) != nil {
+		t.Fatalf("expected no task for panicking and unknown aggregators")
+	}
+}
+
+func TestWorkerTaskCodec(t *testing.T) {
+	type params struct {
+		ID   string `json:"id"`
+		Data []byte `json:"data"`
+	}
+
+	expected := params{ID: "task", Data: []byte{0x00, 0xff, 0x10}}
+
+	for _, codec := range []TaskCodec{TaskCodecJSON, TaskCodecMsgPack} {
+		payload, err := codec.Marshal(expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var actual params
+
+		err = codec.Unmarshal(payload, &actual)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual.ID != expected.ID || !bytes.Equal(actual.Data, expected.Data) {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+	}
+
+	jsonPayload, _ := TaskCodecJSON.Marshal(expected)
+	msgpackPayload, _ := TaskCodecMsgPack.Marshal(expected)
+
+	if len(msgpackPayload) >= len(jsonPayload) || !bytes.Contains(msgpackPayload, []byte("id")) {
+		t.Fatalf("expected msgpack payload to be smaller and keyed by the json tags")
+	}
+}